@@ -0,0 +1,396 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AMQP URI schemes, e.g. amqp://<user>@<host>:<port>/<vhost>?queue=<queue>
+const (
+	amqpURIScheme  = "amqp://"
+	amqpsURIScheme = "amqps://"
+)
+
+// amqpPasswordEnv holds the password for AMQP URIs that give a user without one,
+// so that it does not show up in logs and audit entries
+const amqpPasswordEnv = "AMQP_PASSWORD"
+
+// Attributes carrying AMQP properties that are not headers
+const (
+	amqpContentTypeAttribute = "amqp_content_type"
+	amqpRoutingKeyAttribute  = "amqp_routing_key"
+)
+
+// xDeathHeader is the header RabbitMQ records dead-lettering events in
+const xDeathHeader = "x-death"
+
+// AMQPAddress is a RabbitMQ queue or exchange given as an AMQP URI with the
+// options queue for sources, and exchange and routing-key for destinations
+type AMQPAddress struct {
+	// URI is the connection URI without replay's options
+	URI        string
+	Queue      string
+	Exchange   string
+	RoutingKey string
+	// HasRoutingKey is set if routing-key was given, even if empty
+	HasRoutingKey bool
+}
+
+// ParseAMQPAddress parses an AMQP source or destination
+func ParseAMQPAddress(value string, source bool) (AMQPAddress, error) {
+	value = strings.TrimSpace(value)
+	if !isAMQPAddress(value) {
+		return AMQPAddress{}, fmt.Errorf("invalid AMQP address %q, expected %s<user>@<host>/<vhost>?%s", value, amqpURIScheme, amqpOptionsUsage(source))
+	}
+	uri, err := url.Parse(value)
+	if err != nil {
+		return AMQPAddress{}, fmt.Errorf("invalid AMQP address %q: %w", value, err)
+	}
+
+	var address AMQPAddress
+	query := uri.Query()
+	_, hasQueue := query["queue"]
+	_, hasExchange := query["exchange"]
+	address.Queue = query.Get("queue")
+	address.Exchange = query.Get("exchange")
+	address.RoutingKey = query.Get("routing-key")
+	_, address.HasRoutingKey = query["routing-key"]
+	query.Del("queue")
+	query.Del("exchange")
+	query.Del("routing-key")
+
+	switch {
+	case source && (hasExchange || address.HasRoutingKey):
+		return AMQPAddress{}, fmt.Errorf("AMQP source %q takes a queue, not an exchange or routing-key", value)
+	case source && address.Queue == "":
+		return AMQPAddress{}, fmt.Errorf("AMQP source %q needs ?queue=<queue>", value)
+	case !source && hasQueue:
+		return AMQPAddress{}, fmt.Errorf("AMQP destination %q takes an exchange, not a queue. Use ?exchange=&routing-key=<queue> to publish to a queue through the default exchange", value)
+	case !source && !hasExchange:
+		return AMQPAddress{}, fmt.Errorf("AMQP destination %q needs ?exchange=<exchange>, which may be empty for the default exchange", value)
+	}
+
+	uri.RawQuery = query.Encode()
+	if _, err := amqp.ParseURI(uri.String()); err != nil {
+		return AMQPAddress{}, fmt.Errorf("invalid AMQP address %q: %w", value, err)
+	}
+	address.URI = uri.String()
+	return address, nil
+}
+
+// sameServer reports whether two addresses are on the same broker and virtual host
+func (a AMQPAddress) sameServer(other AMQPAddress) bool {
+	uri, err := amqp.ParseURI(a.URI)
+	otherURI, otherErr := amqp.ParseURI(other.URI)
+	return err == nil && otherErr == nil && strings.EqualFold(uri.Host, otherURI.Host) &&
+		uri.Port == otherURI.Port && uri.Vhost == otherURI.Vhost
+}
+
+// amqpOptionsUsage describes the options of a source or destination
+func amqpOptionsUsage(source bool) string {
+	if source {
+		return "queue=<queue>"
+	}
+	return "exchange=<exchange>[&routing-key=<key>]"
+}
+
+// isAMQPAddress reports whether a source or destination is an AMQP URI
+func isAMQPAddress(value string) bool {
+	value = strings.TrimSpace(value)
+	return strings.HasPrefix(value, amqpURIScheme) || strings.HasPrefix(value, amqpsURIScheme)
+}
+
+// dialAMQP connects to a broker and opens a channel, taking the password from
+// AMQP_PASSWORD if the URI gives a user without one
+func dialAMQP(address AMQPAddress) (*amqp.Connection, *amqp.Channel, error) {
+	uri, _ := url.Parse(address.URI)
+	if uri.User != nil {
+		if _, ok := uri.User.Password(); !ok {
+			if password := os.Getenv(amqpPasswordEnv); password != "" {
+				uri.User = url.UserPassword(uri.User.Username(), password)
+			}
+		}
+	}
+
+	connection, err := amqp.DialConfig(uri.String(), amqp.Config{
+		Properties: amqp.Table{"connection_name": "replay"},
+		Locale:     "en_US",
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s:%s: %w", uri.Hostname(), uri.Port(), err)
+	}
+	channel, err := connection.Channel()
+	if err != nil {
+		connection.Close()
+		return nil, nil, fmt.Errorf("failed to open a channel: %w", err)
+	}
+	return connection, channel, nil
+}
+
+// AMQPSource implements MessageBroker for consuming a RabbitMQ queue with
+// basic.get. Acknowledging a message acks it and releasing it nacks it back
+// onto the queue. Unacknowledged messages stay with replay until its
+// connection closes, so extending the acknowledgement deadline does nothing.
+type AMQPSource struct {
+	connection *amqp.Connection
+	channel    *amqp.Channel
+	address    AMQPAddress
+}
+
+// NewAMQPSource connects to a queue, checking that it exists
+func NewAMQPSource(ctx context.Context, source string) (*AMQPSource, error) {
+	address, err := ParseAMQPAddress(source, true)
+	if err != nil {
+		return nil, err
+	}
+	connection, channel, err := dialAMQP(address)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := channel.QueueDeclarePassive(address.Queue, false, false, false, false, nil); err != nil {
+		connection.Close()
+		return nil, fmt.Errorf("failed to look up queue %s: %w", address.Queue, err)
+	}
+	return &AMQPSource{connection: connection, channel: channel, address: address}, nil
+}
+
+// Pull gets a single message, or returns nil if the queue is empty
+func (s *AMQPSource) Pull(ctx context.Context, config PullConfig) (*Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	delivery, ok, err := s.channel.Get(s.address.Queue, false)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	id := delivery.MessageId
+	if id == "" {
+		id = fmt.Sprintf("%s/%d", s.address.Queue, delivery.DeliveryTag)
+	}
+	attributes := make(map[string]string, len(delivery.Headers)+2)
+	for key, value := range delivery.Headers {
+		attributes[key] = amqpHeaderString(value)
+	}
+	if delivery.ContentType != "" {
+		attributes[amqpContentTypeAttribute] = delivery.ContentType
+	}
+	if routingKey := amqpOriginalRoutingKey(delivery); routingKey != "" {
+		attributes[amqpRoutingKeyAttribute] = routingKey
+	}
+	return &Message{
+		ID:          id,
+		Data:        delivery.Body,
+		Attributes:  attributes,
+		PublishTime: delivery.Timestamp,
+		AckID:       strconv.FormatUint(delivery.DeliveryTag, 10),
+	}, nil
+}
+
+// amqpHeaderString converts a header value to an attribute, encoding values
+// other than strings as JSON
+func amqpHeaderString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// amqpOriginalRoutingKey returns the routing key a dead-lettered message was
+// published with, or else the one it was delivered with
+func amqpOriginalRoutingKey(delivery amqp.Delivery) string {
+	if deaths, ok := delivery.Headers[xDeathHeader].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp.Table); ok {
+			if keys, ok := death["routing-keys"].([]interface{}); ok && len(keys) > 0 {
+				if key, ok := keys[0].(string); ok {
+					return key
+				}
+			}
+		}
+	}
+	return delivery.RoutingKey
+}
+
+// parseDeliveryTag parses an acknowledgement ID
+func parseDeliveryTag(ackID string) (uint64, error) {
+	tag, err := strconv.ParseUint(ackID, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid AMQP acknowledgement ID %q", ackID)
+	}
+	return tag, nil
+}
+
+// Acknowledge acks a message, removing it from the queue
+func (s *AMQPSource) Acknowledge(ctx context.Context, ackID string) error {
+	tag, err := parseDeliveryTag(ackID)
+	if err != nil {
+		return err
+	}
+	return s.channel.Ack(tag, false)
+}
+
+// ExtendAckDeadline does nothing, as the broker does not redeliver a message
+// while the channel it was delivered on is open
+func (s *AMQPSource) ExtendAckDeadline(ctx context.Context, ackID string, deadline time.Duration) error {
+	return nil
+}
+
+// Release nacks a message, requeueing it
+func (s *AMQPSource) Release(ctx context.Context, ackID string) error {
+	tag, err := parseDeliveryTag(ackID)
+	if err != nil {
+		return err
+	}
+	return s.channel.Nack(tag, false, true)
+}
+
+// Publish is not supported by a source
+func (s *AMQPSource) Publish(ctx context.Context, message *Message) error {
+	return fmt.Errorf("no destination configured")
+}
+
+// Close closes the connection, returning unacknowledged messages to the queue
+func (s *AMQPSource) Close() error {
+	return s.connection.Close()
+}
+
+// AMQPPublisher implements MessagePublisher for a RabbitMQ exchange. Messages
+// are published persistent and mandatory, and each publish waits for the
+// broker's confirmation.
+type AMQPPublisher struct {
+	connection *amqp.Connection
+	channel    *amqp.Channel
+	address    AMQPAddress
+	returns    chan amqp.Return
+}
+
+// NewAMQPPublisher connects to an exchange, checking that it exists
+func NewAMQPPublisher(ctx context.Context, destination string) (*AMQPPublisher, error) {
+	address, err := ParseAMQPAddress(destination, false)
+	if err != nil {
+		return nil, err
+	}
+	connection, channel, err := dialAMQP(address)
+	if err != nil {
+		return nil, err
+	}
+	if address.Exchange != "" {
+		// A passive declare checks the name only, whatever the kind
+		if err := channel.ExchangeDeclarePassive(address.Exchange, "direct", false, false, false, false, nil); err != nil {
+			connection.Close()
+			return nil, fmt.Errorf("failed to look up exchange %s: %w", address.Exchange, err)
+		}
+	}
+	if err := channel.Confirm(false); err != nil {
+		connection.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	returns := channel.NotifyReturn(make(chan amqp.Return, 1))
+	return &AMQPPublisher{connection: connection, channel: channel, address: address, returns: returns}, nil
+}
+
+// Publish publishes a message with its routing key, unless the destination gives
+// one, and its other attributes as headers. The broker-managed x-death header
+// is left out.
+func (p *AMQPPublisher) Publish(ctx context.Context, message *Message) error {
+	routingKey := message.Attributes[amqpRoutingKeyAttribute]
+	if p.address.HasRoutingKey {
+		routingKey = p.address.RoutingKey
+	}
+
+	headers := amqp.Table{}
+	keys := make([]string, 0, len(message.Attributes))
+	for key := range message.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch key {
+		case amqpContentTypeAttribute, amqpRoutingKeyAttribute, xDeathHeader:
+		default:
+			headers[key] = message.Attributes[key]
+		}
+	}
+
+	confirmation, err := p.channel.PublishWithDeferredConfirmWithContext(ctx, p.address.Exchange, routingKey, true, false, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  message.Attributes[amqpContentTypeAttribute],
+		DeliveryMode: amqp.Persistent,
+		MessageId:    message.ID,
+		Timestamp:    message.PublishTime,
+		Body:         message.Data,
+	})
+	if err != nil {
+		return err
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	// An unroutable message is returned before it is confirmed
+	select {
+	case returned := <-p.returns:
+		return fmt.Errorf("message was not routed to any queue by exchange %q with routing key %q: %s", returned.Exchange, returned.RoutingKey, returned.ReplyText)
+	default:
+	}
+	if !acked {
+		return errors.New("message was rejected by the broker")
+	}
+	return nil
+}
+
+// Close closes the connection
+func (p *AMQPPublisher) Close() error {
+	return p.connection.Close()
+}
+
+// AMQPDeath is an entry of the x-death header of a dead-lettered message
+type AMQPDeath struct {
+	Count       int64     `json:"count"`
+	Reason      string    `json:"reason"`
+	Queue       string    `json:"queue"`
+	Exchange    string    `json:"exchange"`
+	RoutingKeys []string  `json:"routing-keys"`
+	Time        time.Time `json:"time"`
+}
+
+// FormatDeaths renders the x-death attribute of a message taken from a RabbitMQ
+// queue, one line per queue it was dead-lettered from, or returns nil if it has none
+func FormatDeaths(message *Message) []string {
+	var deaths []AMQPDeath
+	if err := json.Unmarshal([]byte(message.Attributes[xDeathHeader]), &deaths); err != nil {
+		return nil
+	}
+	lines := make([]string, 0, len(deaths))
+	for _, death := range deaths {
+		line := fmt.Sprintf("from queue %s (%s, count %d)", death.Queue, death.Reason, death.Count)
+		if len(death.RoutingKeys) > 0 {
+			line += fmt.Sprintf(" via exchange %q with routing keys %s", death.Exchange, strings.Join(death.RoutingKeys, ", "))
+		}
+		if !death.Time.IsZero() {
+			line += ", last at " + death.Time.Local().Format(time.RFC3339)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"replay/constants"
+
+	"cloud.google.com/go/pubsub/v2"
+)
+
+// Attribute keys added to messages archived to a Pub/Sub topic
+const (
+	archiveAttrDecision  = "replay_archive_decision"
+	archiveAttrReviewer  = "replay_archive_reviewer"
+	archiveAttrTimestamp = "replay_archive_timestamp"
+	archiveAttrReason    = "replay_archive_reason"
+	archiveAttrSource    = "replay_archive_source"
+	archiveAttrMessageID = "replay_archive_message_id"
+)
+
+// ArchiveRecord is a message together with the decision that removed it from its source
+type ArchiveRecord struct {
+	Decision  ReviewAction  `json:"decision"`
+	Reviewer  string        `json:"reviewer"`
+	Timestamp time.Time     `json:"timestamp"`
+	Reason    string        `json:"reason,omitempty"`
+	Source    string        `json:"source"`
+	Message   MessageRecord `json:"message"`
+}
+
+// NewArchiveRecord builds an archive record for a message decided on now
+func NewArchiveRecord(message *Message, decision ReviewAction, source, reason string) *ArchiveRecord {
+	return &ArchiveRecord{
+		Decision:  decision,
+		Reviewer:  currentReviewer(),
+		Timestamp: time.Now().UTC(),
+		Reason:    reason,
+		Source:    source,
+		Message:   NewMessageRecord(message),
+	}
+}
+
+// Archiver durably stores a copy of a message before it is acknowledged
+type Archiver interface {
+	// Archive returns only once the record is safely stored
+	Archive(ctx context.Context, record *ArchiveRecord) error
+	Close() error
+}
+
+// NewArchiver creates an archiver for the given archive type and location
+func NewArchiver(ctx context.Context, archiveType, location string) (Archiver, error) {
+	switch archiveType {
+	case constants.ArchiveTypeJSONLFile:
+		return NewJSONLArchiver(location)
+	case constants.ArchiveTypeDirectory:
+		return NewDirectoryArchiver(location)
+	case constants.BrokerTypeGCPPubSubTopic:
+		return NewPubSubArchiver(ctx, location)
+	default:
+		return nil, fmt.Errorf("unsupported archive type: %s. Supported: %s, %s, %s", archiveType,
+			constants.ArchiveTypeJSONLFile, constants.ArchiveTypeDirectory, constants.BrokerTypeGCPPubSubTopic)
+	}
+}
+
+// JSONLArchiver appends archive records to a local JSON Lines file
+type JSONLArchiver struct {
+	file *os.File
+}
+
+// NewJSONLArchiver opens (or creates) the archive file for appending
+func NewJSONLArchiver(path string) (*JSONLArchiver, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive file: %w", err)
+	}
+	return &JSONLArchiver{file: file}, nil
+}
+
+// Archive appends the record as a single line and syncs it to disk
+func (a *JSONLArchiver) Archive(ctx context.Context, record *ArchiveRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode archive record: %w", err)
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write archive file: %w", err)
+	}
+	return a.file.Sync()
+}
+
+// Close closes the archive file
+func (a *JSONLArchiver) Close() error {
+	return a.file.Close()
+}
+
+// DirectoryArchiver writes each archive record to its own file in a local directory
+type DirectoryArchiver struct {
+	dir string
+}
+
+// unsafeFileChars matches characters that are not allowed in archive file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// NewDirectoryArchiver creates the archive directory if needed
+func NewDirectoryArchiver(dir string) (*DirectoryArchiver, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	return &DirectoryArchiver{dir: dir}, nil
+}
+
+// Archive writes the record to a temporary file and renames it into place
+func (a *DirectoryArchiver) Archive(ctx context.Context, record *ArchiveRecord) error {
+	content, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode archive record: %w", err)
+	}
+
+	id := record.Message.ID
+	if id == "" {
+		sum := sha256.Sum256(record.Message.Data)
+		id = hex.EncodeToString(sum[:8])
+	}
+	name := fmt.Sprintf("%s_%s.json", record.Timestamp.Format("20060102T150405.000000000Z"), unsafeFileChars.ReplaceAllString(id, "_"))
+
+	tmp, err := os.CreateTemp(a.dir, ".archive-*")
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync archive file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close archive file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(a.dir, name)); err != nil {
+		return fmt.Errorf("failed to store archive file: %w", err)
+	}
+	return nil
+}
+
+// Close is a no-op for directory archives
+func (a *DirectoryArchiver) Close() error {
+	return nil
+}
+
+// PubSubArchiver republishes archived messages to a separate Pub/Sub topic
+type PubSubArchiver struct {
+	client    *pubsub.Client
+	publisher *pubsub.Publisher
+}
+
+// NewPubSubArchiver creates a publisher for the archive topic
+func NewPubSubArchiver(ctx context.Context, topic string) (*PubSubArchiver, error) {
+	project, err := resourceProject(topic, collectionTopics)
+	if err != nil {
+		return nil, fmt.Errorf("archive topic: %w", err)
+	}
+
+	client, err := newPubSubClient(ctx, project, sourceCredentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive client: %w", err)
+	}
+
+	return &PubSubArchiver{
+		client:    client,
+		publisher: client.Publisher(topic),
+	}, nil
+}
+
+// Archive publishes the original data with the decision recorded in attributes
+// and waits for the server to confirm it
+func (a *PubSubArchiver) Archive(ctx context.Context, record *ArchiveRecord) error {
+	attributes := make(map[string]string, len(record.Message.Attributes)+6)
+	for k, v := range record.Message.Attributes {
+		attributes[k] = v
+	}
+	attributes[archiveAttrDecision] = string(record.Decision)
+	attributes[archiveAttrReviewer] = record.Reviewer
+	attributes[archiveAttrTimestamp] = record.Timestamp.Format(time.RFC3339Nano)
+	attributes[archiveAttrSource] = record.Source
+	if record.Reason != "" {
+		attributes[archiveAttrReason] = record.Reason
+	}
+	if record.Message.ID != "" {
+		attributes[archiveAttrMessageID] = record.Message.ID
+	}
+
+	result := a.publisher.Publish(ctx, &pubsub.Message{
+		Data:       record.Message.Data,
+		Attributes: attributes,
+	})
+	if _, err := result.Get(ctx); err != nil {
+		return fmt.Errorf("failed to publish to archive topic: %w", err)
+	}
+	return nil
+}
+
+// Close stops the publisher and closes the client
+func (a *PubSubArchiver) Close() error {
+	a.publisher.Stop()
+	return a.client.Close()
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+)
+
+// auditAttrAction is the attribute carrying the action on audit topic messages
+const auditAttrAction = "replay_audit_action"
+
+// AuditEntry records a single decision taken on a message
+type AuditEntry struct {
+	Timestamp        time.Time    `json:"timestamp"`
+	User             string       `json:"user"`
+	Host             string       `json:"host"`
+	CommandLine      string       `json:"command_line"`
+	Action           ReviewAction `json:"action"`
+	Source           string       `json:"source"`
+	Destination      string       `json:"destination,omitempty"`
+	MessageID        string       `json:"message_id,omitempty"`
+	AttributesSHA256 string       `json:"attributes_sha256"`
+	PayloadSHA256    string       `json:"payload_sha256"`
+	Reason           string       `json:"reason,omitempty"`
+	// SetAttributes are attributes set on the message before it was republished
+	SetAttributes map[string]string `json:"set_attributes,omitempty"`
+}
+
+// NewAuditEntry builds an audit entry for an action taken on a message now.
+// destination is empty for actions that do not republish the message.
+func NewAuditEntry(message *Message, action ReviewAction, source, destination, reason string) *AuditEntry {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	payloadSum := sha256.Sum256(message.Data)
+
+	return &AuditEntry{
+		Timestamp:        time.Now().UTC(),
+		User:             currentReviewer(),
+		Host:             host,
+		CommandLine:      strings.Join(os.Args, " "),
+		Action:           action,
+		Source:           source,
+		Destination:      destination,
+		MessageID:        message.ID,
+		AttributesSHA256: attributesHash(message.Attributes),
+		PayloadSHA256:    hex.EncodeToString(payloadSum[:]),
+		Reason:           reason,
+	}
+}
+
+// attributesHash hashes attributes in key order so equal maps hash equally
+func attributesHash(attributes map[string]string) string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%d:%s=%d:%s\n", len(key), key, len(attributes[key]), attributes[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Auditor records review decisions to an append-only trail
+type Auditor interface {
+	// Record returns only once the entry is written to every configured sink
+	Record(ctx context.Context, entry *AuditEntry) error
+	Close() error
+}
+
+// NewConfiguredAuditor creates the auditor requested by the command
+// configuration, or returns nil if auditing is not enabled
+func NewConfiguredAuditor(ctx context.Context, config CommandConfig) (Auditor, error) {
+	if config.AuditLog == "" && config.AuditTopic == "" {
+		return nil, nil
+	}
+	return NewAuditLog(ctx, config.AuditLog, config.AuditTopic)
+}
+
+// AuditLog writes audit entries as NDJSON to a local file and, optionally,
+// publishes them to a Pub/Sub topic
+type AuditLog struct {
+	file      *os.File
+	client    *pubsub.Client
+	publisher *pubsub.Publisher
+}
+
+// NewAuditLog opens the audit file for appending and creates a publisher for
+// the audit topic. Either path or topic may be empty, but not both.
+func NewAuditLog(ctx context.Context, path, topic string) (*AuditLog, error) {
+	if path == "" && topic == "" {
+		return nil, fmt.Errorf("an audit log file or audit topic is required")
+	}
+
+	auditLog := &AuditLog{}
+
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		auditLog.file = file
+	}
+
+	if topic != "" {
+		project, err := resourceProject(topic, collectionTopics)
+		if err != nil {
+			auditLog.Close()
+			return nil, fmt.Errorf("audit topic: %w", err)
+		}
+		client, err := newPubSubClient(ctx, project, sourceCredentials)
+		if err != nil {
+			auditLog.Close()
+			return nil, fmt.Errorf("failed to create audit client: %w", err)
+		}
+		auditLog.client = client
+		auditLog.publisher = client.Publisher(topic)
+	}
+
+	return auditLog, nil
+}
+
+// Record appends the entry to the audit file and publishes it to the audit topic
+func (a *AuditLog) Record(ctx context.Context, entry *AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	if a.file != nil {
+		if _, err := a.file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write audit log: %w", err)
+		}
+		if err := a.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync audit log: %w", err)
+		}
+	}
+
+	if a.publisher != nil {
+		result := a.publisher.Publish(ctx, &pubsub.Message{
+			Data:       line,
+			Attributes: map[string]string{auditAttrAction: string(entry.Action)},
+		})
+		if _, err := result.Get(ctx); err != nil {
+			return fmt.Errorf("failed to publish to audit topic: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Close closes the audit file and the audit topic publisher
+func (a *AuditLog) Close() error {
+	var err error
+	if a.publisher != nil {
+		a.publisher.Stop()
+	}
+	if a.client != nil {
+		err = a.client.Close()
+	}
+	if a.file != nil {
+		if closeErr := a.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/pubsub/v2"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
+)
+
+// scopeCloudPlatform is requested alongside the Pub/Sub scope so that
+// impersonated credentials also work for Cloud Monitoring
+const scopeCloudPlatform = "https://www.googleapis.com/auth/cloud-platform"
+
+// Credentials selects how clients authenticate. The zero value uses
+// application default credentials, i.e. those of 'gcloud auth application-default login'
+// or GOOGLE_APPLICATION_CREDENTIALS.
+type Credentials struct {
+	// File is a service account key file
+	File string
+	// ImpersonateServiceAccount is the email of a service account to act as,
+	// using the base credentials to obtain its tokens
+	ImpersonateServiceAccount string
+}
+
+var (
+	// sourceCredentials are used for subscriptions, snapshots, metrics and the
+	// archive and audit topics
+	sourceCredentials Credentials
+	// destinationCredentials are used for the topics messages are moved to. If
+	// empty, sourceCredentials are used.
+	destinationCredentials Credentials
+)
+
+// IsZero reports whether application default credentials are used
+func (c Credentials) IsZero() bool {
+	return c.File == "" && c.ImpersonateServiceAccount == ""
+}
+
+// String describes the credentials for messages
+func (c Credentials) String() string {
+	switch {
+	case c.File != "" && c.ImpersonateServiceAccount != "":
+		return fmt.Sprintf("service account %s impersonated with key file %s", c.ImpersonateServiceAccount, c.File)
+	case c.File != "":
+		return "service account key file " + c.File
+	case c.ImpersonateServiceAccount != "":
+		return "service account " + c.ImpersonateServiceAccount + " impersonated with application default credentials"
+	default:
+		return "application default credentials"
+	}
+}
+
+// ClientOptions returns the options that make a client use the credentials.
+// No options are needed when an emulator is used.
+func (c Credentials) ClientOptions(ctx context.Context) ([]option.ClientOption, error) {
+	if c.IsZero() || os.Getenv("PUBSUB_EMULATOR_HOST") != "" {
+		return nil, nil
+	}
+	var base []option.ClientOption
+	if c.File != "" {
+		if _, err := os.Stat(c.File); err != nil {
+			return nil, fmt.Errorf("credentials file: %w", err)
+		}
+		base = append(base, option.WithCredentialsFile(c.File))
+	}
+	if c.ImpersonateServiceAccount == "" {
+		return base, nil
+	}
+	tokens, err := c.impersonatedTokens(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+	return []option.ClientOption{option.WithTokenSource(tokens)}, nil
+}
+
+// impersonatedTokens returns tokens of the impersonated service account, obtained
+// with the base credentials
+func (c Credentials) impersonatedTokens(ctx context.Context, base []option.ClientOption) (oauth2.TokenSource, error) {
+	tokens, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+		TargetPrincipal: c.ImpersonateServiceAccount,
+		Scopes:          []string{pubsub.ScopePubSub, scopeCloudPlatform},
+	}, base...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to impersonate %s: %w", c.ImpersonateServiceAccount, err)
+	}
+	return tokens, nil
+}
+
+// TokenSource returns a token source for the credentials, to check that they work
+func (c Credentials) TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	if c.IsZero() {
+		credentials, err := google.FindDefaultCredentials(ctx, pubsub.ScopePubSub)
+		if err != nil {
+			return nil, err
+		}
+		return credentials.TokenSource, nil
+	}
+	if c.ImpersonateServiceAccount == "" {
+		data, err := os.ReadFile(c.File)
+		if err != nil {
+			return nil, fmt.Errorf("credentials file: %w", err)
+		}
+		credentials, err := google.CredentialsFromJSON(ctx, data, pubsub.ScopePubSub)
+		if err != nil {
+			return nil, fmt.Errorf("credentials file %s: %w", c.File, err)
+		}
+		return credentials.TokenSource, nil
+	}
+	var base []option.ClientOption
+	if c.File != "" {
+		base = append(base, option.WithCredentialsFile(c.File))
+	}
+	return c.impersonatedTokens(ctx, base)
+}
+
+// effectiveDestinationCredentials returns the credentials for destination topics.
+// A destination service account is impersonated with the source key file, if any.
+func effectiveDestinationCredentials() Credentials {
+	credentials := destinationCredentials
+	if credentials.IsZero() {
+		return sourceCredentials
+	}
+	if credentials.File == "" {
+		credentials.File = sourceCredentials.File
+	}
+	return credentials
+}
+
+// newPubSubClient creates a Pub/Sub client for a project using the given credentials
+func newPubSubClient(ctx context.Context, project string, credentials Credentials) (*pubsub.Client, error) {
+	opts, err := credentials.ClientOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pubsub.NewClient(ctx, project, opts...)
+}
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&sourceCredentials.File, "credentials-file", "", "Service account key file to authenticate with (default: application default credentials)")
+	flags.StringVar(&sourceCredentials.ImpersonateServiceAccount, "impersonate-service-account", "", "Service account email to impersonate")
+	flags.StringVar(&destinationCredentials.File, "destination-credentials-file", "", "Service account key file for destination topics, if they need other credentials than the source")
+	flags.StringVar(&destinationCredentials.ImpersonateServiceAccount, "destination-impersonate-service-account", "", "Service account email to impersonate for destination topics, if they need other credentials than the source")
+}
@@ -0,0 +1,521 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"replay/constants"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// defaultAWSRegion signs requests to an SQS-compatible stand-in when no region is configured
+const defaultAWSRegion = "us-east-1"
+
+// sqsMaxWait is the longest SQS long-polls a receive
+const sqsMaxWait = 20 * time.Second
+
+// fifoSuffix ends the names of FIFO queues and topics
+const fifoSuffix = ".fifo"
+
+// sqsHostPattern matches SQS endpoints and captures their region, e.g.
+// sqs.eu-west-1.amazonaws.com, the legacy eu-west-1.queue.amazonaws.com or
+// queue.amazonaws.com, which is in us-east-1
+var sqsHostPattern = regexp.MustCompile(`^(?:sqs\.([a-z0-9-]+)\.|([a-z0-9-]+)\.queue\.|queue\.)amazonaws\.com(?:\.cn)?$`)
+
+// awsMaxMessageAttributes is the most message attributes SQS and SNS accept
+const awsMaxMessageAttributes = 10
+
+// awsExtraAttributes holds, as a JSON object, the attributes of a message that
+// do not fit into SQS or SNS message attributes
+const awsExtraAttributes = "replay_attributes"
+
+// awsAttributeNamePattern is what SQS and SNS accept as message attribute names,
+// besides rules on dots and reserved prefixes checked by validAWSAttributeName
+var awsAttributeNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,256}$`)
+
+// snsTopicARNPattern matches SNS topic ARNs and captures their region and name
+var snsTopicARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:sns:([a-z0-9-]+):[0-9]+:([A-Za-z0-9_-]{1,256}(?:\.fifo)?)$`)
+
+// sqsIDPattern is what SQS and SNS accept as FIFO group and deduplication IDs
+var sqsIDPattern = regexp.MustCompile(`^[\x21-\x7e]{1,128}$`)
+
+// SQSQueue is an SQS queue given by its URL, e.g.
+// https://sqs.<region>.amazonaws.com/<account>/<queue>. A URL on any other host
+// is taken as an SQS-compatible stand-in, e.g. http://localhost:9324/000000000000/<queue>.
+type SQSQueue struct {
+	URL  string
+	Name string
+	// Region is empty if the URL does not give it
+	Region string
+	// Endpoint is set for queues that are not on AWS
+	Endpoint string
+	FIFO     bool
+}
+
+// ParseSQSQueueURL parses an SQS source or destination
+func ParseSQSQueueURL(value string) (SQSQueue, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "https://") && !strings.HasPrefix(value, "http://") {
+		return SQSQueue{}, fmt.Errorf("invalid SQS queue %q, expected https://sqs.<region>.amazonaws.com/<account>/<queue>", value)
+	}
+	uri, err := url.Parse(value)
+	if err != nil {
+		return SQSQueue{}, fmt.Errorf("invalid SQS queue %q: %w", value, err)
+	}
+	segments := strings.Split(strings.Trim(uri.Path, "/"), "/")
+	if uri.Host == "" || len(segments) != 2 || segments[0] == "" || segments[1] == "" || uri.RawQuery != "" {
+		return SQSQueue{}, fmt.Errorf("invalid SQS queue %q, expected https://sqs.<region>.amazonaws.com/<account>/<queue>", value)
+	}
+
+	queue := SQSQueue{
+		URL:  value,
+		Name: segments[1],
+		FIFO: strings.HasSuffix(segments[1], fifoSuffix),
+	}
+	if match := sqsHostPattern.FindStringSubmatch(strings.ToLower(uri.Hostname())); match != nil {
+		queue.Region = match[1] + match[2]
+		if queue.Region == "" {
+			queue.Region = defaultAWSRegion
+		}
+	} else {
+		queue.Endpoint = uri.Scheme + "://" + uri.Host
+	}
+	return queue, nil
+}
+
+// isSQSAddress reports whether a source or destination is an SQS queue URL on
+// AWS. Queues on SQS-compatible stand-ins are only recognised by their type.
+func isSQSAddress(value string) bool {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "https://") && !strings.HasPrefix(value, "http://") {
+		return false
+	}
+	uri, err := url.Parse(value)
+	return err == nil && sqsHostPattern.MatchString(strings.ToLower(uri.Hostname()))
+}
+
+// SNSTopic is an SNS topic given by its ARN, arn:aws:sns:<region>:<account>:<topic>
+type SNSTopic struct {
+	ARN    string
+	Name   string
+	Region string
+	FIFO   bool
+}
+
+// ParseSNSTopicARN parses an SNS destination
+func ParseSNSTopicARN(value string) (SNSTopic, error) {
+	value = strings.TrimSpace(value)
+	match := snsTopicARNPattern.FindStringSubmatch(value)
+	if match == nil {
+		return SNSTopic{}, fmt.Errorf("invalid SNS topic %q, expected arn:aws:sns:<region>:<account>:<topic>", value)
+	}
+	return SNSTopic{ARN: value, Name: match[2], Region: match[1], FIFO: strings.HasSuffix(match[2], fifoSuffix)}, nil
+}
+
+// isSNSAddress reports whether a destination is an SNS topic ARN
+func isSNSAddress(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), "arn:aws") && strings.Contains(value, ":sns:")
+}
+
+// loadAWSConfig loads the default AWS configuration and credentials, e.g. from
+// AWS_PROFILE or the AWS_ACCESS_KEY_ID environment variables, in region if given
+func loadAWSConfig(ctx context.Context, region string) (aws.Config, error) {
+	var options []func(*config.LoadOptions) error
+	if region != "" {
+		options = append(options, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = defaultAWSRegion
+	}
+	return cfg, nil
+}
+
+// newSQSClient creates a client for a queue's region, or for its endpoint if
+// it is not on AWS
+func newSQSClient(ctx context.Context, queue SQSQueue) (*sqs.Client, error) {
+	cfg, err := loadAWSConfig(ctx, queue.Region)
+	if err != nil {
+		return nil, err
+	}
+	return sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		if queue.Endpoint != "" {
+			o.BaseEndpoint = aws.String(queue.Endpoint)
+		}
+	}), nil
+}
+
+// SQSSource implements MessageBroker for consuming an SQS queue. A received
+// message is leased for its visibility timeout: acknowledging it deletes it,
+// extending the deadline changes its visibility timeout, and releasing it makes
+// it visible again straight away.
+type SQSSource struct {
+	client *sqs.Client
+	queue  SQSQueue
+}
+
+// NewSQSSource connects to a queue, checking that it exists
+func NewSQSSource(ctx context.Context, source string) (*SQSSource, error) {
+	queue, err := ParseSQSQueueURL(source)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newSQSClient(ctx, queue)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{QueueUrl: aws.String(queue.URL)}); err != nil {
+		return nil, fmt.Errorf("failed to look up queue %s: %w", queue.URL, err)
+	}
+	return &SQSSource{client: client, queue: queue}, nil
+}
+
+// Pull receives a single message, long-polling for up to the pull timeout, or
+// returns nil if none arrives
+func (s *SQSSource) Pull(ctx context.Context, config PullConfig) (*Message, error) {
+	deadline := time.Now().Add(config.Timeout)
+	for {
+		wait := min(time.Until(deadline), sqsMaxWait)
+		output, err := s.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    aws.String(s.queue.URL),
+			MaxNumberOfMessages:         1,
+			VisibilityTimeout:           int32(constants.DefaultLeaseExtension / time.Second),
+			WaitTimeSeconds:             int32(max(wait, 0) / time.Second),
+			MessageAttributeNames:       []string{"All"},
+			MessageSystemAttributeNames: []sqstypes.MessageSystemAttributeName{sqstypes.MessageSystemAttributeNameAll},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(output.Messages) > 0 {
+			return s.message(output.Messages[0]), nil
+		}
+		if time.Until(deadline) < time.Second {
+			return nil, nil
+		}
+	}
+}
+
+// message converts a received message, keeping its FIFO group ID as the ordering key
+func (s *SQSSource) message(received sqstypes.Message) *Message {
+	attributes := make(map[string]string, len(received.MessageAttributes))
+	for name, value := range received.MessageAttributes {
+		switch {
+		case value.StringValue != nil:
+			attributes[name] = *value.StringValue
+		case value.BinaryValue != nil:
+			attributes[name] = base64.StdEncoding.EncodeToString(value.BinaryValue)
+		}
+	}
+	var extra map[string]string
+	if err := json.Unmarshal([]byte(attributes[awsExtraAttributes]), &extra); err == nil {
+		delete(attributes, awsExtraAttributes)
+		for name, value := range extra {
+			if _, ok := attributes[name]; !ok {
+				attributes[name] = value
+			}
+		}
+	}
+	message := &Message{
+		ID:          aws.ToString(received.MessageId),
+		Data:        []byte(aws.ToString(received.Body)),
+		Attributes:  attributes,
+		OrderingKey: received.Attributes[string(sqstypes.MessageSystemAttributeNameMessageGroupId)],
+		AckID:       aws.ToString(received.ReceiptHandle),
+	}
+	if sent, err := strconv.ParseInt(received.Attributes[string(sqstypes.MessageSystemAttributeNameSentTimestamp)], 10, 64); err == nil {
+		message.PublishTime = time.UnixMilli(sent)
+	}
+	if count, err := strconv.Atoi(received.Attributes[string(sqstypes.MessageSystemAttributeNameApproximateReceiveCount)]); err == nil {
+		message.DeliveryAttempt = count
+	}
+	return message
+}
+
+// Acknowledge deletes a message from the queue
+func (s *SQSSource) Acknowledge(ctx context.Context, ackID string) error {
+	_, err := s.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(s.queue.URL),
+		ReceiptHandle: aws.String(ackID),
+	})
+	return err
+}
+
+// ExtendAckDeadline sets the visibility timeout of a message to deadline
+func (s *SQSSource) ExtendAckDeadline(ctx context.Context, ackID string, deadline time.Duration) error {
+	_, err := s.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(s.queue.URL),
+		ReceiptHandle:     aws.String(ackID),
+		VisibilityTimeout: int32(deadline / time.Second),
+	})
+	return err
+}
+
+// ExtendAckDeadlines changes the visibility timeout of messages, ten per request
+func (s *SQSSource) ExtendAckDeadlines(ctx context.Context, ackIDs []string, deadline time.Duration) error {
+	var errs []error
+	for batch := range slices.Chunk(ackIDs, 10) {
+		entries := make([]sqstypes.ChangeMessageVisibilityBatchRequestEntry, len(batch))
+		for i, ackID := range batch {
+			entries[i] = sqstypes.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				ReceiptHandle:     aws.String(ackID),
+				VisibilityTimeout: int32(deadline / time.Second),
+			}
+		}
+		output, err := s.client.ChangeMessageVisibilityBatch(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String(s.queue.URL),
+			Entries:  entries,
+		})
+		if err != nil {
+			return err
+		}
+		for _, failed := range output.Failed {
+			errs = append(errs, fmt.Errorf("failed to change the visibility of message %s: %s", aws.ToString(failed.Id), aws.ToString(failed.Message)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Release makes a message visible in the queue again
+func (s *SQSSource) Release(ctx context.Context, ackID string) error {
+	return s.ExtendAckDeadline(ctx, ackID, 0)
+}
+
+// Publish is not supported by a source
+func (s *SQSSource) Publish(ctx context.Context, message *Message) error {
+	return fmt.Errorf("no destination configured")
+}
+
+// Close does nothing, as the client holds no connections that need closing
+func (s *SQSSource) Close() error {
+	return nil
+}
+
+// awsMessageBody checks that message data can be sent as an SQS or SNS message,
+// which must be non-empty text
+func awsMessageBody(message *Message) (string, error) {
+	if len(message.Data) == 0 {
+		return "", errors.New("message data is empty, which SQS and SNS do not accept")
+	}
+	if !utf8.Valid(message.Data) {
+		return "", errors.New("message data is not UTF-8 text, which SQS and SNS require")
+	}
+	return string(message.Data), nil
+}
+
+// awsAttributes returns the message attributes to send a message with. Empty
+// attributes are left out, as SQS and SNS reject them. As they also take at most
+// awsMaxMessageAttributes attributes with restricted names, attributes with other
+// names, and those beyond the limit in name order after the redrive count, are sent together as a JSON
+// object in awsExtraAttributes, which an SQS source unpacks again.
+func awsAttributes(message *Message) (map[string]string, error) {
+	names := make([]string, 0, len(message.Attributes))
+	for name, value := range message.Attributes {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	// The redrive count comes first, so that it stays a message attribute of its own
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == redriveCountAttribute) != (names[j] == redriveCountAttribute) {
+			return names[i] == redriveCountAttribute
+		}
+		return names[i] < names[j]
+	})
+
+	valid := make([]string, 0, len(names))
+	extra := make(map[string]string)
+	for _, name := range names {
+		if validAWSAttributeName(name) && name != awsExtraAttributes {
+			valid = append(valid, name)
+		} else {
+			extra[name] = message.Attributes[name]
+		}
+	}
+	limit := awsMaxMessageAttributes
+	if len(extra) > 0 || len(valid) > limit {
+		// Leave room for awsExtraAttributes
+		limit--
+	}
+	for _, name := range valid[min(len(valid), limit):] {
+		extra[name] = message.Attributes[name]
+	}
+	valid = valid[:min(len(valid), limit)]
+
+	attributes := make(map[string]string, len(valid)+1)
+	for _, name := range valid {
+		attributes[name] = message.Attributes[name]
+	}
+	if len(extra) > 0 {
+		encoded, err := json.Marshal(extra)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", awsExtraAttributes, err)
+		}
+		attributes[awsExtraAttributes] = string(encoded)
+	}
+	return attributes, nil
+}
+
+// validAWSAttributeName reports whether SQS and SNS accept a message attribute name
+func validAWSAttributeName(name string) bool {
+	lower := strings.ToLower(name)
+	return awsAttributeNamePattern.MatchString(name) && !strings.HasPrefix(name, ".") && !strings.HasSuffix(name, ".") &&
+		!strings.Contains(name, "..") && !strings.HasPrefix(lower, "aws.") && !strings.HasPrefix(lower, "amazon.")
+}
+
+// fifoIDs returns the group ID and deduplication ID to send a message to a FIFO
+// queue or topic with. The group is the ordering key, or else the message ID, so
+// messages without one are not held up behind each other. The deduplication ID
+// is derived from the message ID, so a retried move is not delivered twice.
+func fifoIDs(message *Message) (group, deduplication *string) {
+	fifoID := func(value string) string {
+		if sqsIDPattern.MatchString(value) {
+			return value
+		}
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:])
+	}
+	group = aws.String(fifoID(message.OrderingKey))
+	if message.OrderingKey == "" {
+		group = aws.String(fifoID(message.ID))
+	}
+	return group, aws.String(fifoID(message.ID))
+}
+
+// SQSPublisher implements MessagePublisher for an SQS queue. Attributes are sent
+// as String message attributes as far as SQS allows, and FIFO queues get the ordering key as the
+// message group ID.
+type SQSPublisher struct {
+	client *sqs.Client
+	queue  SQSQueue
+}
+
+// NewSQSPublisher connects to a queue, checking that it exists
+func NewSQSPublisher(ctx context.Context, destination string) (*SQSPublisher, error) {
+	queue, err := ParseSQSQueueURL(destination)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newSQSClient(ctx, queue)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{QueueUrl: aws.String(queue.URL)}); err != nil {
+		return nil, fmt.Errorf("failed to look up queue %s: %w", queue.URL, err)
+	}
+	return &SQSPublisher{client: client, queue: queue}, nil
+}
+
+// Publish sends a message to the queue
+func (p *SQSPublisher) Publish(ctx context.Context, message *Message) error {
+	body, err := awsMessageBody(message)
+	if err != nil {
+		return err
+	}
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(p.queue.URL),
+		MessageBody:       aws.String(body),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{},
+	}
+	attributes, err := awsAttributes(message)
+	if err != nil {
+		return err
+	}
+	for name, value := range attributes {
+		input.MessageAttributes[name] = sqstypes.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+	if p.queue.FIFO {
+		input.MessageGroupId, input.MessageDeduplicationId = fifoIDs(message)
+	}
+	_, err = p.client.SendMessage(ctx, input)
+	return err
+}
+
+// Close does nothing, as the client holds no connections that need closing
+func (p *SQSPublisher) Close() error {
+	return nil
+}
+
+// SNSPublisher implements MessagePublisher for an SNS topic. Attributes are sent
+// as String message attributes as far as SNS allows, and FIFO topics get the ordering key as the
+// message group ID.
+type SNSPublisher struct {
+	client *sns.Client
+	topic  SNSTopic
+}
+
+// NewSNSPublisher connects to a topic, checking that it exists
+func NewSNSPublisher(ctx context.Context, destination string) (*SNSPublisher, error) {
+	topic, err := ParseSNSTopicARN(destination)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadAWSConfig(ctx, topic.Region)
+	if err != nil {
+		return nil, err
+	}
+	client := sns.NewFromConfig(cfg)
+	if _, err := client.GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{TopicArn: aws.String(topic.ARN)}); err != nil {
+		return nil, fmt.Errorf("failed to look up topic %s: %w", topic.ARN, err)
+	}
+	return &SNSPublisher{client: client, topic: topic}, nil
+}
+
+// Publish publishes a message to the topic
+func (p *SNSPublisher) Publish(ctx context.Context, message *Message) error {
+	body, err := awsMessageBody(message)
+	if err != nil {
+		return err
+	}
+	input := &sns.PublishInput{
+		TopicArn:          aws.String(p.topic.ARN),
+		Message:           aws.String(body),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{},
+	}
+	attributes, err := awsAttributes(message)
+	if err != nil {
+		return err
+	}
+	for name, value := range attributes {
+		input.MessageAttributes[name] = snstypes.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+	if p.topic.FIFO {
+		input.MessageGroupId, input.MessageDeduplicationId = fifoIDs(message)
+	}
+	_, err = p.client.Publish(ctx, input)
+	return err
+}
+
+// Close does nothing, as the client holds no connections that need closing
+func (p *SNSPublisher) Close() error {
+	return nil
+}
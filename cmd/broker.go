@@ -2,19 +2,27 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"slices"
 	"time"
 
+	"replay/constants"
+
 	"cloud.google.com/go/pubsub/v2"
 	pubsubpb "cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
 )
 
 // Message represents a message with its data and metadata
 type Message struct {
-	Data       []byte
-	Attributes map[string]string
-	AckID      string
+	ID          string
+	Data        []byte
+	Attributes  map[string]string
+	PublishTime time.Time
+	OrderingKey string
+	AckID       string
+	// DeliveryAttempt is only set for subscriptions with a dead-letter policy
+	DeliveryAttempt int
 }
 
 // PullConfig contains configuration for message pulling
@@ -28,6 +36,42 @@ type MessageBroker interface {
 	Pull(ctx context.Context, config PullConfig) (*Message, error)
 	Publish(ctx context.Context, message *Message) error
 	Acknowledge(ctx context.Context, ackID string) error
+	ExtendAckDeadline(ctx context.Context, ackID string, deadline time.Duration) error
+	Release(ctx context.Context, ackID string) error
+	Close() error
+}
+
+// StreamingBroker is implemented by brokers that can deliver messages as they arrive
+type StreamingBroker interface {
+	// Receive calls handle for each message, one at a time, until ctx is done. The
+	// message is acknowledged if handle returns true and redelivered otherwise.
+	Receive(ctx context.Context, handle func(ctx context.Context, message *Message) bool) error
+}
+
+// BatchExtender is implemented by brokers that can extend the ack deadlines of
+// many messages with fewer requests than one per message
+type BatchExtender interface {
+	ExtendAckDeadlines(ctx context.Context, ackIDs []string, deadline time.Duration) error
+}
+
+// extendAckDeadlines extends the ack deadlines of messages in batches if the
+// source supports it, or one message at a time otherwise
+func extendAckDeadlines(ctx context.Context, source MessageSource, ackIDs []string, deadline time.Duration) error {
+	if batch, ok := source.(BatchExtender); ok {
+		return batch.ExtendAckDeadlines(ctx, ackIDs, deadline)
+	}
+	var errs []error
+	for _, ackID := range ackIDs {
+		if err := source.ExtendAckDeadline(ctx, ackID, deadline); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MessagePublisher publishes messages to a single destination
+type MessagePublisher interface {
+	Publish(ctx context.Context, message *Message) error
 	Close() error
 }
 
@@ -40,34 +84,42 @@ type PubSubBroker struct {
 	topic        string
 }
 
-// NewPubSubBroker creates a new PubSubBroker
+// NewPubSubBroker creates a new PubSubBroker. topic may be empty for commands
+// that only read from the subscription.
 func NewPubSubBroker(ctx context.Context, subscription, topic string) (*PubSubBroker, error) {
 	// Parse subscription project
-	subParts := strings.Split(subscription, "/")
-	if len(subParts) < 4 {
-		return nil, fmt.Errorf("invalid subscription resource format: %s", subscription)
-	}
-	subProj := subParts[1]
-
-	// Parse topic project
-	topicParts := strings.Split(topic, "/")
-	if len(topicParts) < 4 {
-		return nil, fmt.Errorf("invalid topic resource format: %s", topic)
+	subProj, err := resourceProject(subscription, collectionSubscriptions)
+	if err != nil {
+		return nil, err
 	}
-	topicProj := topicParts[1]
 
 	// Create subscription client
-	subClient, err := pubsub.NewClient(ctx, subProj)
+	subClient, err := newPubSubClient(ctx, subProj, sourceCredentials)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create subscription client: %w", err)
 	}
 
-	// Create topic client (reuse if same project)
+	if topic == "" {
+		return &PubSubBroker{
+			subClient:    subClient,
+			subscription: subscription,
+		}, nil
+	}
+
+	// Parse topic project
+	topicProj, err := resourceProject(topic, collectionTopics)
+	if err != nil {
+		subClient.Close()
+		return nil, err
+	}
+
+	// Create topic client (reuse if same project and credentials)
 	var topicClient *pubsub.Client
-	if topicProj == subProj {
+	topicCredentials := effectiveDestinationCredentials()
+	if topicProj == subProj && topicCredentials == sourceCredentials {
 		topicClient = subClient
 	} else {
-		topicClient, err = pubsub.NewClient(ctx, topicProj)
+		topicClient, err = newPubSubClient(ctx, topicProj, topicCredentials)
 		if err != nil {
 			subClient.Close()
 			return nil, fmt.Errorf("failed to create topic client: %w", err)
@@ -106,14 +158,45 @@ func (b *PubSubBroker) Pull(ctx context.Context, config PullConfig) (*Message, e
 
 	receivedMsg := resp.ReceivedMessages[0]
 	return &Message{
-		Data:       receivedMsg.Message.Data,
-		Attributes: receivedMsg.Message.Attributes,
-		AckID:      receivedMsg.AckId,
+		ID:              receivedMsg.Message.MessageId,
+		Data:            receivedMsg.Message.Data,
+		Attributes:      receivedMsg.Message.Attributes,
+		PublishTime:     receivedMsg.Message.PublishTime.AsTime(),
+		OrderingKey:     receivedMsg.Message.OrderingKey,
+		AckID:           receivedMsg.AckId,
+		DeliveryAttempt: int(receivedMsg.DeliveryAttempt),
 	}, nil
 }
 
+// Receive streams messages from the subscription until ctx is done
+func (b *PubSubBroker) Receive(ctx context.Context, handle func(ctx context.Context, message *Message) bool) error {
+	subscriber := b.subClient.Subscriber(b.subscription)
+	subscriber.ReceiveSettings.MaxOutstandingMessages = 1
+
+	return subscriber.Receive(ctx, func(ctx context.Context, received *pubsub.Message) {
+		message := &Message{
+			ID:          received.ID,
+			Data:        received.Data,
+			Attributes:  received.Attributes,
+			PublishTime: received.PublishTime,
+			OrderingKey: received.OrderingKey,
+		}
+		if received.DeliveryAttempt != nil {
+			message.DeliveryAttempt = *received.DeliveryAttempt
+		}
+		if handle(ctx, message) {
+			received.Ack()
+		} else {
+			received.Nack()
+		}
+	})
+}
+
 // Publish publishes a message to the topic
 func (b *PubSubBroker) Publish(ctx context.Context, message *Message) error {
+	if b.publisher == nil {
+		return fmt.Errorf("no destination topic configured")
+	}
 	result := b.publisher.Publish(ctx, &pubsub.Message{
 		Data:       message.Data,
 		Attributes: message.Attributes,
@@ -122,6 +205,13 @@ func (b *PubSubBroker) Publish(ctx context.Context, message *Message) error {
 	return err
 }
 
+// Subscription returns the source subscription's configuration
+func (b *PubSubBroker) Subscription(ctx context.Context) (*pubsubpb.Subscription, error) {
+	return b.subClient.SubscriptionAdminClient.GetSubscription(ctx, &pubsubpb.GetSubscriptionRequest{
+		Subscription: b.subscription,
+	})
+}
+
 // Acknowledge acknowledges a message
 func (b *PubSubBroker) Acknowledge(ctx context.Context, ackID string) error {
 	req := &pubsubpb.AcknowledgeRequest{
@@ -131,14 +221,101 @@ func (b *PubSubBroker) Acknowledge(ctx context.Context, ackID string) error {
 	return b.subClient.SubscriptionAdminClient.Acknowledge(ctx, req)
 }
 
+// ExtendAckDeadline extends the lease on a pulled message so it is not redelivered
+func (b *PubSubBroker) ExtendAckDeadline(ctx context.Context, ackID string, deadline time.Duration) error {
+	req := &pubsubpb.ModifyAckDeadlineRequest{
+		Subscription:       b.subscription,
+		AckIds:             []string{ackID},
+		AckDeadlineSeconds: int32(deadline / time.Second),
+	}
+	return b.subClient.SubscriptionAdminClient.ModifyAckDeadline(ctx, req)
+}
+
+// ExtendAckDeadlines extends the ack deadlines of messages, up to
+// MaxAckIDsPerRequest per request
+func (b *PubSubBroker) ExtendAckDeadlines(ctx context.Context, ackIDs []string, deadline time.Duration) error {
+	for batch := range slices.Chunk(ackIDs, constants.MaxAckIDsPerRequest) {
+		req := &pubsubpb.ModifyAckDeadlineRequest{
+			Subscription:       b.subscription,
+			AckIds:             batch,
+			AckDeadlineSeconds: int32(deadline / time.Second),
+		}
+		if err := b.subClient.SubscriptionAdminClient.ModifyAckDeadline(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release returns a pulled message to the subscription for immediate redelivery
+func (b *PubSubBroker) Release(ctx context.Context, ackID string) error {
+	return b.ExtendAckDeadline(ctx, ackID, 0)
+}
+
 // Close cleans up resources
 func (b *PubSubBroker) Close() error {
-	b.publisher.Stop()
+	if b.publisher != nil {
+		b.publisher.Stop()
+	}
 	if b.subClient != nil && b.subClient.SubscriptionAdminClient != nil {
 		b.subClient.SubscriptionAdminClient.Close()
 	}
-	if b.topicClient != b.subClient {
+	if b.topicClient != nil && b.topicClient != b.subClient {
 		b.topicClient.Close()
 	}
 	return b.subClient.Close()
 }
+
+// PubSubPublisher implements MessagePublisher for a Google Cloud Pub/Sub topic
+type PubSubPublisher struct {
+	client    *pubsub.Client
+	publisher *pubsub.Publisher
+	ordered   bool
+}
+
+// NewPubSubPublisher creates a publisher for a full topic resource name
+func NewPubSubPublisher(ctx context.Context, topic string) (*PubSubPublisher, error) {
+	project, err := resourceProject(topic, collectionTopics)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newPubSubClient(ctx, project, effectiveDestinationCredentials())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create topic client: %w", err)
+	}
+
+	return &PubSubPublisher{
+		client:    client,
+		publisher: client.Publisher(topic),
+	}, nil
+}
+
+// EnableOrdering publishes messages with their ordering keys
+func (p *PubSubPublisher) EnableOrdering() {
+	p.publisher.EnableMessageOrdering = true
+	p.ordered = true
+}
+
+// Publish publishes a message to the topic
+func (p *PubSubPublisher) Publish(ctx context.Context, message *Message) error {
+	msg := &pubsub.Message{
+		Data:       message.Data,
+		Attributes: message.Attributes,
+	}
+	if p.ordered {
+		msg.OrderingKey = message.OrderingKey
+	}
+	_, err := p.publisher.Publish(ctx, msg).Get(ctx)
+	if err != nil && msg.OrderingKey != "" {
+		// A failed publish pauses its ordering key until it is resumed
+		p.publisher.ResumePublish(msg.OrderingKey)
+	}
+	return err
+}
+
+// Close stops the publisher and closes the client
+func (p *PubSubPublisher) Close() error {
+	p.publisher.Stop()
+	return p.client.Close()
+}
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"replay/constants"
@@ -9,6 +11,12 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// NamedDestination is an additional destination a reviewer can choose by name
+type NamedDestination struct {
+	Name     string
+	Resource string
+}
+
 // CommandConfig holds the configuration for message processing commands
 type CommandConfig struct {
 	SourceType      string
@@ -18,6 +26,22 @@ type CommandConfig struct {
 	Count           int
 	PollTimeout     time.Duration
 	PrettyJSON      bool
+	ArchiveType     string
+	Archive         string
+	AuditLog        string
+	AuditTopic      string
+	Destinations    []NamedDestination
+	UndoWindow      time.Duration
+	UndoDepth       int
+	SnapshotBefore  bool
+	Delay           time.Duration
+	NotBefore       time.Time
+	MaxRedrives     int
+	Quarantine      string
+	AllowLoop       bool
+	AllowFanout     bool
+	SkipPreflight   bool
+	SubscriptionTTL time.Duration
 }
 
 // ParseCommandConfig extracts and validates command configuration from cobra command
@@ -35,12 +59,208 @@ func ParseCommandConfig(cmd *cobra.Command) (*CommandConfig, error) {
 		prettyJSON, _ = cmd.Flags().GetBool("pretty-json")
 	}
 
-	// Validate supported types
-	if sourceType != constants.BrokerTypeGCPPubSubSubscription {
-		return nil, fmt.Errorf("unsupported source type: %s. Supported: %s", sourceType, constants.BrokerTypeGCPPubSubSubscription)
+	// Check if archive flags exist (for dlr command)
+	archiveType, archive := "", ""
+	if cmd.Flags().Lookup("archive") != nil {
+		archiveType, _ = cmd.Flags().GetString("archive-type")
+		archive, _ = cmd.Flags().GetString("archive")
+		if (archiveType == "") != (archive == "") {
+			return nil, fmt.Errorf("--archive-type and --archive must be set together")
+		}
+	}
+
+	// Check if audit flags exist
+	auditLog, auditTopic := "", ""
+	if cmd.Flags().Lookup("audit-log") != nil {
+		auditLog, _ = cmd.Flags().GetString("audit-log")
+		auditTopic, _ = cmd.Flags().GetString("audit-topic")
+	}
+
+	// Check if named destination flags exist (for dlr command)
+	var destinations []NamedDestination
+	if cmd.Flags().Lookup("named-destination") != nil {
+		values, _ := cmd.Flags().GetStringArray("named-destination")
+		parsed, err := parseNamedDestinations(values)
+		if err != nil {
+			return nil, err
+		}
+		destinations = parsed
+	}
+
+	// Check if undo flags exist (for dlr command)
+	var undoWindow time.Duration
+	undoDepth := 0
+	if cmd.Flags().Lookup("undo-window-seconds") != nil {
+		undoWindowSec, _ := cmd.Flags().GetInt("undo-window-seconds")
+		undoDepth, _ = cmd.Flags().GetInt("undo-depth")
+		if undoWindowSec < 0 || undoDepth < 0 {
+			return nil, fmt.Errorf("--undo-window-seconds and --undo-depth must not be negative")
+		}
+		undoWindow = time.Duration(undoWindowSec) * time.Second
+	}
+
+	// Check if snapshot flag exists (for move and purge commands)
+	snapshotBefore := false
+	if cmd.Flags().Lookup("snapshot-before") != nil {
+		snapshotBefore, _ = cmd.Flags().GetBool("snapshot-before")
+	}
+
+	// Check if delay flags exist (for move and schedule commands)
+	var delay time.Duration
+	var notBefore time.Time
+	if cmd.Flags().Lookup("delay") != nil {
+		if value, _ := cmd.Flags().GetString("delay"); value != "" {
+			parsed, err := parseAge(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --delay: %w", err)
+			}
+			delay = parsed
+		}
+		if value, _ := cmd.Flags().GetString("not-before"); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --not-before %q, expected RFC 3339 such as 2025-01-02T15:04:05Z", value)
+			}
+			notBefore = parsed
+		}
+	}
+
+	// Check if redrive flags exist (for move and schedule commands, and allow-loop for grep)
+	maxRedrives, quarantine, allowLoop, allowFanout := 0, "", false, false
+	if cmd.Flags().Lookup("allow-loop") != nil {
+		allowLoop, _ = cmd.Flags().GetBool("allow-loop")
 	}
-	if destType != constants.BrokerTypeGCPPubSubTopic {
-		return nil, fmt.Errorf("unsupported destination type: %s. Supported: %s", destType, constants.BrokerTypeGCPPubSubTopic)
+	if cmd.Flags().Lookup("max-redrives") != nil {
+		allowFanout, _ = cmd.Flags().GetBool("allow-fanout")
+		maxRedrives, _ = cmd.Flags().GetInt("max-redrives")
+		quarantine, _ = cmd.Flags().GetString("quarantine")
+		if maxRedrives < 0 {
+			return nil, fmt.Errorf("--max-redrives must not be negative")
+		}
+		if quarantine != "" && maxRedrives == 0 {
+			return nil, fmt.Errorf("--quarantine requires --max-redrives")
+		}
+	}
+
+	// Check if preflight flag exists (for move, schedule and dlr commands)
+	skipPreflight := false
+	if cmd.Flags().Lookup("skip-preflight") != nil {
+		skipPreflight, _ = cmd.Flags().GetBool("skip-preflight")
+	}
+
+	// Check if topic source flag exists (for move and export commands)
+	var subscriptionTTL time.Duration
+	if cmd.Flags().Lookup("subscription-ttl") != nil {
+		value, _ := cmd.Flags().GetString("subscription-ttl")
+		parsed, err := parseAge(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --subscription-ttl: %w", err)
+		}
+		if parsed < constants.MinSubscriptionTTL {
+			return nil, fmt.Errorf("--subscription-ttl must be at least %v", constants.MinSubscriptionTTL)
+		}
+		subscriptionTTL = parsed
+	}
+
+	// Validate the types this command supports
+	if cmd.Flags().Lookup("source-type") != nil {
+		if err := checkSupportedType("source", sourceType, supportedTypes(cmd, sourceTypesAnnotation)); err != nil {
+			return nil, err
+		}
+	}
+	if cmd.Flags().Lookup("destination-type") != nil {
+		if err := checkSupportedType("destination", destType, supportedTypes(cmd, destinationTypesAnnotation)); err != nil {
+			return nil, err
+		}
+	}
+	if snapshotBefore && sourceType != constants.BrokerTypeGCPPubSubSubscription {
+		return nil, fmt.Errorf("--snapshot-before is not supported with %s", snapshotUnsupportedReasons[sourceType])
+	}
+	// A Kafka source commits up to its lowest unacknowledged offset, so a message left
+	// in place would make the next run move every later message again
+	if sourceType == constants.BrokerTypeKafkaTopic {
+		if delay > 0 {
+			return nil, fmt.Errorf("--delay is not supported with a Kafka source, as a message left in place holds back the committed offset of its partition")
+		}
+		if maxRedrives > 0 && quarantine == "" {
+			return nil, fmt.Errorf("--max-redrives requires --quarantine with a Kafka source, as a message left in place holds back the committed offset of its partition")
+		}
+	}
+
+	// Kafka, AMQP, AWS, NATS and Redis addresses are validated rather than expanded
+	if !isPubSubType(sourceType) {
+		if err := validateAddress(sourceType, source, true); err != nil {
+			return nil, fmt.Errorf("--source: %w", err)
+		}
+	}
+	if !isPubSubType(destType) && destination != "" {
+		if err := validateAddress(destType, destination, false); err != nil {
+			return nil, fmt.Errorf("--destination: %w", err)
+		}
+	}
+	if isExternalAddress(quarantine) {
+		if err := validateDestinationAddress(quarantine); err != nil {
+			return nil, fmt.Errorf("--quarantine: %w", err)
+		}
+	}
+
+	// Expand short names and URIs to full resource names, rejecting mismatched types
+	type resourceFlag struct {
+		flag  string
+		value *string
+	}
+	var subscriptions []resourceFlag
+	topics := []resourceFlag{{"audit-topic", &auditTopic}}
+	if !isExternalAddress(quarantine) {
+		topics = append(topics, resourceFlag{"quarantine", &quarantine})
+	}
+	switch sourceType {
+	case constants.BrokerTypeGCPPubSubTopic:
+		topics = append(topics, resourceFlag{"source", &source})
+	case constants.BrokerTypeGCPPubSubSubscription, "":
+		subscriptions = append(subscriptions, resourceFlag{"source", &source})
+	}
+	switch destType {
+	case constants.BrokerTypeGCPPubSubSubscription:
+		subscriptions = append(subscriptions, resourceFlag{"destination", &destination})
+	case constants.BrokerTypeGCPPubSubTopic, "":
+		topics = append([]resourceFlag{{"destination", &destination}}, topics...)
+	}
+	if archiveType == constants.BrokerTypeGCPPubSubTopic {
+		topics = append(topics, resourceFlag{"archive", &archive})
+	}
+	for _, subscription := range subscriptions {
+		if *subscription.value == "" {
+			continue
+		}
+		expanded, err := expandResourceName(cmd, *subscription.value, collectionSubscriptions)
+		if err != nil {
+			return nil, fmt.Errorf("--%s: %w", subscription.flag, err)
+		}
+		*subscription.value = expanded
+	}
+	for _, topic := range topics {
+		if *topic.value == "" {
+			continue
+		}
+		expanded, err := expandResourceName(cmd, *topic.value, collectionTopics)
+		if err != nil {
+			return nil, fmt.Errorf("--%s: %w", topic.flag, err)
+		}
+		*topic.value = expanded
+	}
+	for i, named := range destinations {
+		if isExternalAddress(named.Resource) {
+			if err := validateDestinationAddress(named.Resource); err != nil {
+				return nil, fmt.Errorf("--named-destination %s: %w", named.Name, err)
+			}
+			continue
+		}
+		expanded, err := expandResourceName(cmd, named.Resource, collectionTopics)
+		if err != nil {
+			return nil, fmt.Errorf("--named-destination %s: %w", named.Name, err)
+		}
+		destinations[i].Resource = expanded
 	}
 
 	return &CommandConfig{
@@ -51,20 +271,192 @@ func ParseCommandConfig(cmd *cobra.Command) (*CommandConfig, error) {
 		Count:           count,
 		PollTimeout:     time.Duration(pollTimeoutSec) * time.Second,
 		PrettyJSON:      prettyJSON,
+		ArchiveType:     archiveType,
+		Archive:         archive,
+		AuditLog:        auditLog,
+		AuditTopic:      auditTopic,
+		Destinations:    destinations,
+		UndoWindow:      undoWindow,
+		UndoDepth:       undoDepth,
+		SnapshotBefore:  snapshotBefore,
+		Delay:           delay,
+		NotBefore:       notBefore,
+		MaxRedrives:     maxRedrives,
+		Quarantine:      quarantine,
+		AllowLoop:       allowLoop,
+		AllowFanout:     allowFanout,
+		SkipPreflight:   skipPreflight,
+		SubscriptionTTL: subscriptionTTL,
 	}, nil
 }
 
+// parseNamedDestinations parses name=resource pairs, keeping their order
+func parseNamedDestinations(values []string) ([]NamedDestination, error) {
+	var destinations []NamedDestination
+	seen := map[string]bool{defaultDestinationName: true}
+	for _, value := range values {
+		name, resource, ok := strings.Cut(value, "=")
+		name = strings.TrimSpace(name)
+		resource = strings.TrimSpace(resource)
+		if !ok || name == "" || resource == "" {
+			return nil, fmt.Errorf("invalid named destination %q, expected name=projects/<proj>/topics/<topic>", value)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate named destination: %s", name)
+		}
+		seen[name] = true
+		destinations = append(destinations, NamedDestination{Name: name, Resource: resource})
+	}
+	return destinations, nil
+}
+
 // AddCommonFlags adds common flags to a cobra command
 func AddCommonFlags(cmd *cobra.Command) {
+	AddSourceFlags(cmd)
+	AddDestinationFlags(cmd)
+}
+
+// AddSourceFlags adds flags for commands that pull messages from a source
+func AddSourceFlags(cmd *cobra.Command) {
 	cmd.Flags().String("source-type", "", "Message source type")
-	cmd.Flags().String("destination-type", "", "Message destination type")
-	cmd.Flags().String("source", "", "Full source resource name (e.g. projects/<proj>/subscriptions/<sub>)")
-	cmd.Flags().String("destination", "", "Full destination resource name (e.g. projects/<proj>/topics/<topic>)")
+	AddSourceTypes(cmd, constants.BrokerTypeGCPPubSubSubscription)
+	cmd.Flags().String("source", "", "Source subscription, as projects/<proj>/subscriptions/<sub>, pubsub://<proj>/subscriptions/<sub> or a short name in --project")
 	cmd.Flags().Int("count", 0, "Number of messages to process (0 for all messages)")
 	cmd.Flags().Int("polling-timeout-seconds", constants.DefaultPollTimeoutSeconds, "Timeout in seconds for polling a single message")
 
 	_ = cmd.MarkFlagRequired("source-type")
-	_ = cmd.MarkFlagRequired("destination-type")
 	_ = cmd.MarkFlagRequired("source")
+}
+
+// AddDestinationFlags adds flags for commands that publish messages to a destination
+func AddDestinationFlags(cmd *cobra.Command) {
+	cmd.Flags().String("destination-type", "", "Message destination type")
+	AddDestinationTypes(cmd, constants.BrokerTypeGCPPubSubTopic)
+	cmd.Flags().String("destination", "", "Destination topic, as projects/<proj>/topics/<topic>, pubsub://<proj>/topics/<topic> or a short name in --project")
+
+	_ = cmd.MarkFlagRequired("destination-type")
 	_ = cmd.MarkFlagRequired("destination")
 }
+
+// snapshotUnsupportedReasons explains for each source type other than a
+// subscription why --snapshot-before cannot be used with it
+var snapshotUnsupportedReasons = map[string]string{
+	constants.BrokerTypeGCPPubSubTopic: "a topic source, as its temporary subscription is deleted on exit",
+	constants.BrokerTypeKafkaTopic:     "a Kafka source, whose committed offsets can be reset with the Kafka tools instead",
+	constants.BrokerTypeAMQPQueue:      "an AMQP source, as a queue cannot be rewound",
+	constants.BrokerTypeAWSSQSQueue:    "an SQS source, as a queue cannot be rewound",
+	constants.BrokerTypeNATSJetStream:  "a NATS source, whose consumer can be reset with the NATS tools instead",
+	constants.BrokerTypeRedisStream:    "a Redis source, whose consumer group can be reset with XGROUP SETID instead",
+}
+
+// Annotations listing the broker types a command supports
+const (
+	sourceTypesAnnotation      = "replay-source-types"
+	destinationTypesAnnotation = "replay-destination-types"
+)
+
+// AddSourceTypes adds broker types to those a command supports for --source-type
+func AddSourceTypes(cmd *cobra.Command, types ...string) {
+	addSupportedTypes(cmd, sourceTypesAnnotation, "source-type", "Message source type", types)
+}
+
+// AddDestinationTypes adds broker types to those a command supports for --destination-type
+func AddDestinationTypes(cmd *cobra.Command, types ...string) {
+	addSupportedTypes(cmd, destinationTypesAnnotation, "destination-type", "Message destination type", types)
+}
+
+// addSupportedTypes records supported types in a command annotation and lists
+// them in the usage of the type flag
+func addSupportedTypes(cmd *cobra.Command, annotation, flag, usage string, types []string) {
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	supported := supportedTypes(cmd, annotation)
+	for _, t := range types {
+		if !slices.Contains(supported, t) {
+			supported = append(supported, t)
+		}
+	}
+	cmd.Annotations[annotation] = strings.Join(supported, ",")
+	if f := cmd.Flags().Lookup(flag); f != nil {
+		f.Usage = fmt.Sprintf("%s (%s)", usage, strings.Join(supported, ", "))
+	}
+}
+
+// supportedTypes returns the broker types recorded in a command annotation
+func supportedTypes(cmd *cobra.Command, annotation string) []string {
+	if cmd.Annotations[annotation] == "" {
+		return nil
+	}
+	return strings.Split(cmd.Annotations[annotation], ",")
+}
+
+// checkSupportedType returns an error if a source or destination type is not supported
+func checkSupportedType(kind, value string, supported []string) error {
+	if slices.Contains(supported, value) {
+		return nil
+	}
+	return fmt.Errorf("unsupported %s type: %s. Supported: %s", kind, value, strings.Join(supported, ", "))
+}
+
+// AddArchiveFlags adds flags for archiving discarded messages to a cobra command
+func AddArchiveFlags(cmd *cobra.Command) {
+	cmd.Flags().String("archive-type", "", fmt.Sprintf("Archive type for discarded messages (%s, %s or %s)",
+		constants.ArchiveTypeJSONLFile, constants.ArchiveTypeDirectory, constants.BrokerTypeGCPPubSubTopic))
+	cmd.Flags().String("archive", "", "Archive location: a JSONL file path, a directory path or a full topic resource name")
+}
+
+// AddFilterFlags adds flags for selecting messages by attributes and JSON data to a cobra command
+func AddFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("attribute", nil, "Require an attribute, as key=value or key for presence only (repeatable)")
+	cmd.Flags().StringArray("jsonpath", nil, "Require a JSONPath predicate on JSON data, e.g. '$.order.id == 12345' (repeatable)")
+}
+
+// parseMessageFilter builds a message filter from a data pattern and the filter flags
+func parseMessageFilter(cmd *cobra.Command, pattern string) (*MessageFilter, error) {
+	attributes, _ := cmd.Flags().GetStringArray("attribute")
+	jsonPaths, _ := cmd.Flags().GetStringArray("jsonpath")
+	return NewMessageFilter(pattern, attributes, jsonPaths)
+}
+
+// AddSnapshotFlags adds a flag for snapshotting the source before consuming it to a cobra command
+func AddSnapshotFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("snapshot-before", false, "Snapshot the source subscription before consuming anything, so it can be rolled back with seek")
+}
+
+// AddDelayFlags adds flags for postponing a redrive to a cobra command
+func AddDelayFlags(cmd *cobra.Command) {
+	cmd.Flags().String("delay", "", "Move only messages published at least this long ago, e.g. 30m, 2h or 1d")
+	cmd.Flags().String("not-before", "", "Wait until this time (RFC 3339) before moving anything")
+}
+
+// subscriptionDestinationUsage describes --destination for commands that can move to a subscription
+const subscriptionDestinationUsage = "Destination topic, or with destination type GCP_PUBSUB_SUBSCRIPTION a subscription to route messages to, as a full resource name, pubsub:// URI or short name in --project"
+
+// AddRedriveFlags adds flags for keeping messages from being redriven in circles to a cobra command
+func AddRedriveFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("allow-loop", false, "Move even if the destination feeds the source subscription")
+	cmd.Flags().Bool("allow-fanout", false, "Move to a destination subscription even if other subscriptions of its topic would receive the messages too")
+	cmd.Flags().Int("max-redrives", 0, "Stop moving messages already redriven this many times (0 for no limit)")
+	cmd.Flags().String("quarantine", "", "Topic to publish messages exceeding --max-redrives to instead of leaving them in the source, as a full topic resource name or a Kafka, AMQP, SQS, SNS, NATS or Redis address")
+	AddDestinationTypes(cmd, constants.BrokerTypeGCPPubSubSubscription)
+}
+
+// AddTopicSourceFlags adds a flag for reading a topic source through a temporary
+// subscription to a cobra command, and describes --source accordingly
+func AddTopicSourceFlags(cmd *cobra.Command) {
+	AddSourceTypes(cmd, constants.BrokerTypeGCPPubSubTopic)
+	cmd.Flags().String("subscription-ttl", "1d", "With source type GCP_PUBSUB_TOPIC, how long the temporary subscription lives on if it cannot be deleted on exit (at least 1d)")
+	cmd.Flags().Lookup("source").Usage = "Source subscription, or with source type GCP_PUBSUB_TOPIC a topic to read through a temporary subscription, as a full resource name, pubsub:// URI or short name in --project"
+}
+
+// AddPreflightFlags adds a flag for skipping the checks run before a command starts to a cobra command
+func AddPreflightFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("skip-preflight", false, "Skip checking credentials, resources and permissions before starting")
+}
+
+// AddAuditFlags adds flags for recording an audit trail of decisions to a cobra command
+func AddAuditFlags(cmd *cobra.Command) {
+	cmd.Flags().String("audit-log", "", "Append an NDJSON audit entry for every decision to this file")
+	cmd.Flags().String("audit-topic", "", "Also publish audit entries to this full topic resource name")
+}
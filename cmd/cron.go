@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronAliases maps the supported @ shorthands to their five field specs
+var cronAliases = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+// cronField is the set of values a cron field matches
+type cronField map[int]bool
+
+// CronSchedule is a parsed five field cron spec: minute, hour, day of month,
+// month and day of week. Fields support *, lists, ranges and steps.
+type CronSchedule struct {
+	spec   string
+	minute cronField
+	hour   cronField
+	dom    cronField
+	month  cronField
+	dow    cronField
+	anyDOM bool
+	anyDOW bool
+}
+
+// ParseCronSchedule parses a cron spec such as "*/15 * * * *", "0 9-17 * * 1-5" or "@daily"
+func ParseCronSchedule(spec string) (*CronSchedule, error) {
+	expanded := strings.TrimSpace(spec)
+	if alias, ok := cronAliases[expanded]; ok {
+		expanded = alias
+	}
+	fields := strings.Fields(expanded)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron spec %q, expected 5 fields: minute hour day-of-month month day-of-week", spec)
+	}
+
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	parsed := make([]cronField, 5)
+	for i, field := range fields {
+		values, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron spec %q: %w", spec, err)
+		}
+		parsed[i] = values
+	}
+	// Sunday is both 0 and 7
+	if parsed[4][7] {
+		parsed[4][0] = true
+	}
+
+	return &CronSchedule{
+		spec:   spec,
+		minute: parsed[0],
+		hour:   parsed[1],
+		dom:    parsed[2],
+		month:  parsed[3],
+		dow:    parsed[4],
+		anyDOM: strings.HasPrefix(fields[2], "*"),
+		anyDOW: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField parses a comma separated list of *, n, a-b, */s, a-b/s or n/s
+func parseCronField(field string, low, high int) (cronField, error) {
+	values := cronField{}
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+
+		start, end := low, high
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err1, err2 error
+			start, err1 = strconv.Atoi(from)
+			end, err2 = strconv.Atoi(to)
+			if err1 != nil || err2 != nil || start > end {
+				return nil, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", rangePart)
+			}
+			start = n
+			if !hasStep {
+				end = n
+			}
+		}
+		if start < low || end > high {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, low, high)
+		}
+
+		for v := start; v <= end; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// String returns the spec the schedule was parsed from
+func (s *CronSchedule) String() string {
+	return s.spec
+}
+
+// Next returns the first time after t that matches the schedule, or the zero
+// time if there is none within five years
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !s.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchesDay applies the cron rule that when both day of month and day of week
+// are restricted, a day matching either one matches
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	dom := s.dom[t.Day()]
+	dow := s.dow[int(t.Weekday())]
+	switch {
+	case s.anyDOM && s.anyDOW:
+		return true
+	case s.anyDOM:
+		return dow
+	case s.anyDOW:
+		return dom
+	default:
+		return dom || dow
+	}
+}
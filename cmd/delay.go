@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"replay/constants"
+)
+
+// DelayHandler passes a message on to another handler only once it was
+// published at least delay ago. When waiting, it blocks until the message is
+// old enough; otherwise younger messages are held until the end of the run and
+// then released, so they stay in the source for a later run.
+type DelayHandler struct {
+	next   MessageHandler
+	broker MessageBroker
+	delay  time.Duration
+	wait   bool
+	leases *LeaseKeeper
+	held   []*Message
+	output io.Writer
+}
+
+// NewDelayHandler creates a delay handler in front of next. With wait set,
+// messages that are too young are waited for instead of held.
+func NewDelayHandler(next MessageHandler, broker MessageBroker, delay time.Duration, wait bool, output io.Writer) *DelayHandler {
+	h := &DelayHandler{
+		next:   next,
+		broker: broker,
+		delay:  delay,
+		wait:   wait,
+		output: output,
+	}
+	if !wait {
+		h.leases = NewLeaseKeeper(broker, constants.DefaultLeaseExtension)
+	}
+	return h
+}
+
+// HandleMessage hands the message on once it is old enough
+func (h *DelayHandler) HandleMessage(ctx context.Context, message *Message, msgNum int) (bool, error) {
+	remaining := time.Until(message.PublishTime.Add(h.delay))
+	if remaining > 0 && h.wait {
+		fmt.Fprintf(h.output, "Waiting %v until message %d was published %v ago\n", remaining.Round(time.Second), msgNum, h.delay)
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(remaining):
+		}
+	} else if remaining > 0 {
+		h.leases.Hold(message.AckID)
+		h.held = append(h.held, message)
+		return false, nil
+	}
+	return h.next.HandleMessage(ctx, message, msgNum)
+}
+
+// Flush releases the held messages and flushes the next handler
+func (h *DelayHandler) Flush(ctx context.Context) int {
+	failed := 0
+	if flusher, ok := h.next.(Flusher); ok {
+		failed = flusher.Flush(ctx)
+	}
+	if h.leases == nil {
+		return failed
+	}
+
+	h.leases.Stop()
+	for _, message := range h.held {
+		if err := h.broker.Release(ctx, message.AckID); err != nil {
+			fmt.Fprintf(h.output, "Warning: failed to release message %s: %v\n", message.ID, err)
+		}
+	}
+	if len(h.held) > 0 {
+		fmt.Fprintf(h.output, "Left %d messages published less than %v ago in the source\n", len(h.held), h.delay)
+	}
+	h.held = nil
+	return failed
+}
@@ -8,32 +8,83 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"replay/constants"
 
 	"github.com/spf13/cobra"
 )
 
+// defaultDestinationName labels the --destination topic when named destinations are configured
+const defaultDestinationName = "default"
+
+// ReviewDestination is a destination a reviewer can move messages to
+type ReviewDestination struct {
+	Name      string
+	Resource  string
+	Publisher MessagePublisher
+}
+
 // DLRHandler implements MessageHandler for interactive dead-letter review
 type DLRHandler struct {
-	broker MessageBroker
-	config CommandConfig
-	reader *bufio.Reader
-	output io.Writer
+	broker       MessageBroker
+	config       CommandConfig
+	destinations []ReviewDestination
+	archiver     Archiver
+	auditor      Auditor
+	reader       *bufio.Reader
+	output       io.Writer
+	rules        []MatchRule
+	undo         *UndoBuffer
 }
 
-// NewDLRHandler creates a new DLR handler
-func NewDLRHandler(broker MessageBroker, config CommandConfig) *DLRHandler {
-	return &DLRHandler{
-		broker: broker,
-		config: config,
-		reader: bufio.NewReader(os.Stdin),
-		output: os.Stdout,
+// NewDLRHandler creates a new DLR handler. Moves go to the broker's destination
+// unless named destinations are given, in which case the reviewer chooses between
+// them. archiver and auditor may be nil when discarded messages are not archived
+// or decisions are not audited. When the configuration sets an undo window or
+// depth, decisions are held in an undo buffer instead of being carried out at once.
+func NewDLRHandler(broker MessageBroker, config CommandConfig, named []ReviewDestination, archiver Archiver, auditor Auditor) *DLRHandler {
+	destinations := append([]ReviewDestination{{
+		Name:      defaultDestinationName,
+		Resource:  config.Destination,
+		Publisher: broker,
+	}}, named...)
+
+	h := &DLRHandler{
+		broker:       broker,
+		config:       config,
+		destinations: destinations,
+		archiver:     archiver,
+		auditor:      auditor,
+		reader:       bufio.NewReader(os.Stdin),
+		output:       os.Stdout,
+	}
+	if config.UndoWindow > 0 || config.UndoDepth > 0 {
+		h.undo = NewUndoBuffer(broker, config.UndoWindow, config.UndoDepth, h.output)
 	}
+	return h
 }
 
 // HandleMessage implements the interactive message handling for DLR
 func (h *DLRHandler) HandleMessage(ctx context.Context, message *Message, msgNum int) (bool, error) {
+	// Commit held decisions that can no longer be undone and keep this message leased
+	if h.undo != nil {
+		h.undo.CommitDue(ctx)
+		h.undo.Hold(message)
+	}
+
+	// Apply a previously confirmed bulk rule without prompting
+	for _, rule := range h.rules {
+		if rule.Matches(message) {
+			fmt.Fprintf(h.output, "\nMessage %d matched rule: %s\n", msgNum, rule)
+			return h.decideRule(ctx, message, msgNum, rule)
+		}
+	}
+
 	// Display message details
 	fmt.Fprintf(h.output, "\nMessage %d:\n", msgNum)
 
@@ -44,37 +95,300 @@ func (h *DLRHandler) HandleMessage(ctx context.Context, message *Message, msgNum
 	} else {
 		fmt.Fprintf(h.output, "Data:\n%s\n", dataStr)
 	}
-	fmt.Fprintf(h.output, "Attributes: %v\n", message.Attributes)
+	if deaths := FormatDeaths(message); len(deaths) > 0 {
+		attributes := maps.Clone(message.Attributes)
+		delete(attributes, xDeathHeader)
+		fmt.Fprintf(h.output, "Attributes: %v\n", attributes)
+		fmt.Fprintln(h.output, "Dead-lettered:")
+		for _, death := range deaths {
+			fmt.Fprintf(h.output, "  %s\n", death)
+		}
+	} else {
+		fmt.Fprintf(h.output, "Attributes: %v\n", message.Attributes)
+	}
 
 	// Interactive prompt loop
 	for {
-		fmt.Fprint(h.output, "Choose action ([m]ove / [d]iscard / [q]uit): ")
-		input, _ := h.reader.ReadString('\n')
-		input = strings.TrimSpace(strings.ToLower(input))
+		if h.undo != nil && h.undo.Len() > 0 {
+			fmt.Fprint(h.output, "Choose action ([m]ove / [d]iscard / [a]ll matching / [u]ndo / [q]uit): ")
+		} else {
+			fmt.Fprint(h.output, "Choose action ([m]ove / [d]iscard / [a]ll matching / [q]uit): ")
+		}
+		input := h.readInput()
 
 		switch input {
 		case "m":
-			// Move the message
-			if err := h.broker.Publish(ctx, message); err != nil {
-				return false, fmt.Errorf("failed to move message %d", msgNum)
+			destination, ok := h.promptDestination()
+			if !ok {
+				continue
 			}
-			fmt.Fprintf(h.output, "Message %d moved successfully\n", msgNum)
-			return true, nil
+			return h.decide(ctx, message, msgNum, ReviewActionMove, destination, "", nil)
 
 		case "d":
-			// Discard the message
-			fmt.Fprintf(h.output, "Message %d discarded (acked)\n", msgNum)
-			return true, nil
+			reason := ""
+			if h.archiver != nil {
+				fmt.Fprint(h.output, "Reason for discarding (optional): ")
+				reason = h.readLine()
+			}
+			return h.decide(ctx, message, msgNum, ReviewActionDiscard, nil, reason, nil)
+
+		case "a":
+			// Build a bulk rule from this message and apply it here too
+			rule, ok := h.promptRule(message)
+			if !ok {
+				continue
+			}
+			h.rules = append(h.rules, rule)
+			return h.decideRule(ctx, message, msgNum, rule)
+
+		case "u":
+			if h.undo == nil {
+				fmt.Fprintln(h.output, "Invalid input. Please enter 'm', 'd', 'a', or 'q'.")
+				continue
+			}
+			// Revert the last decision and review that message again
+			decision, expired := h.undo.Undo(ctx)
+			if decision == nil && expired {
+				fmt.Fprintf(h.output, "Nothing to undo: decisions older than %v have been carried out.\n", h.config.UndoWindow)
+				continue
+			}
+			if decision == nil {
+				fmt.Fprintln(h.output, "Nothing to undo.")
+				continue
+			}
+			if decision.rule != nil && h.removeRule(*decision.rule) {
+				fmt.Fprintf(h.output, "Removed rule: %s\n", decision.rule)
+			}
+			fmt.Fprintf(h.output, "Undid %s of message %d\n", decision.summary, decision.msgNum)
+			return false, &UndoError{Message: decision.message, MsgNum: decision.msgNum}
 
 		case "q":
 			// Quit without acknowledging
+			if h.undo != nil {
+				h.undo.Release(message)
+			}
 			fmt.Fprintln(h.output, "Quitting review...")
 			return false, ErrQuit
 
 		default:
-			fmt.Fprintln(h.output, "Invalid input. Please enter 'm', 'd', or 'q'.")
+			if h.undo != nil {
+				fmt.Fprintln(h.output, "Invalid input. Please enter 'm', 'd', 'a', 'u', or 'q'.")
+			} else {
+				fmt.Fprintln(h.output, "Invalid input. Please enter 'm', 'd', 'a', or 'q'.")
+			}
+		}
+	}
+}
+
+// apply carries out a review action on a message and reports whether to acknowledge it.
+// Discarded messages are archived first, moves are audited before publishing, and a
+// message is not acknowledged if archiving or auditing the decision fails.
+func (h *DLRHandler) apply(ctx context.Context, message *Message, msgNum int, action ReviewAction, destination *ReviewDestination, reason string) (bool, error) {
+	switch action {
+	case ReviewActionMove:
+		if err := h.audit(ctx, message, action, destination.Resource, reason); err != nil {
+			return false, fmt.Errorf("failed to audit message %d, leaving it unacknowledged: %w", msgNum, err)
+		}
+		if err := destination.Publisher.Publish(ctx, message); err != nil {
+			return false, fmt.Errorf("failed to move message %d", msgNum)
+		}
+		if len(h.destinations) > 1 {
+			fmt.Fprintf(h.output, "Message %d moved successfully to %s\n", msgNum, destination.Name)
+		} else {
+			fmt.Fprintf(h.output, "Message %d moved successfully\n", msgNum)
+		}
+		return true, nil
+
+	case ReviewActionDiscard:
+		if h.archiver != nil {
+			record := NewArchiveRecord(message, ReviewActionDiscard, h.config.Source, reason)
+			if err := h.archiver.Archive(ctx, record); err != nil {
+				return false, fmt.Errorf("failed to archive message %d, leaving it unacknowledged: %w", msgNum, err)
+			}
+			fmt.Fprintf(h.output, "Message %d archived to %s\n", msgNum, h.config.Archive)
+		}
+		if err := h.audit(ctx, message, action, "", reason); err != nil {
+			return false, fmt.Errorf("failed to audit message %d, leaving it unacknowledged: %w", msgNum, err)
+		}
+		fmt.Fprintf(h.output, "Message %d discarded (acked)\n", msgNum)
+		return true, nil
+
+	default:
+		return false, fmt.Errorf("unknown action %q for message %d", action, msgNum)
+	}
+}
+
+// decide carries out a decision immediately, or holds it in the undo buffer
+// when undo is enabled so that it can still be reverted
+func (h *DLRHandler) decide(ctx context.Context, message *Message, msgNum int, action ReviewAction, destination *ReviewDestination, reason string, rule *MatchRule) (bool, error) {
+	if h.undo == nil {
+		return h.apply(ctx, message, msgNum, action, destination, reason)
+	}
+
+	summary := string(action)
+	if destination != nil && len(h.destinations) > 1 {
+		summary = fmt.Sprintf("%s to %s", action, destination.Name)
+	}
+
+	h.undo.Add(&pendingDecision{
+		message:   message,
+		msgNum:    msgNum,
+		summary:   summary,
+		rule:      rule,
+		decidedAt: time.Now(),
+		commit: func(ctx context.Context) (bool, error) {
+			return h.apply(ctx, message, msgNum, action, destination, reason)
+		},
+	})
+	fmt.Fprintf(h.output, "Message %d queued for %s (press u at the next prompt to undo)\n", msgNum, summary)
+	return false, ErrDeferred
+}
+
+// decideRule decides a matching message according to a bulk rule
+func (h *DLRHandler) decideRule(ctx context.Context, message *Message, msgNum int, rule MatchRule) (bool, error) {
+	var destination *ReviewDestination
+	if rule.Action == ReviewActionMove {
+		destination = h.destinationByName(rule.Destination)
+	}
+	return h.decide(ctx, message, msgNum, rule.Action, destination, "matched rule: "+rule.String(), &rule)
+}
+
+// removeRule forgets a bulk rule, reporting whether it was still active
+func (h *DLRHandler) removeRule(rule MatchRule) bool {
+	for i, existing := range h.rules {
+		if existing.Equal(rule) {
+			h.rules = append(h.rules[:i], h.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Flush commits decisions still held in the undo buffer
+func (h *DLRHandler) Flush(ctx context.Context) int {
+	if h.undo == nil {
+		return 0
+	}
+	return h.undo.Flush(ctx)
+}
+
+// destinationByName finds a destination by name, falling back to the default destination
+func (h *DLRHandler) destinationByName(name string) *ReviewDestination {
+	for i := range h.destinations {
+		if h.destinations[i].Name == name {
+			return &h.destinations[i]
+		}
+	}
+	return &h.destinations[0]
+}
+
+// promptDestination asks which destination to move to when there is more than one
+func (h *DLRHandler) promptDestination() (*ReviewDestination, bool) {
+	if len(h.destinations) == 1 {
+		return &h.destinations[0], true
+	}
+
+	options := make([]string, len(h.destinations))
+	for i, destination := range h.destinations {
+		options[i] = fmt.Sprintf("[%d] %s", i+1, destination.Name)
+	}
+
+	for {
+		fmt.Fprintf(h.output, "Choose destination (%s, blank to cancel): ", strings.Join(options, " / "))
+		input := h.readLine()
+		if input == "" {
+			return nil, false
+		}
+		if choice, err := strconv.Atoi(input); err == nil && choice >= 1 && choice <= len(h.destinations) {
+			return &h.destinations[choice-1], true
+		}
+		for i := range h.destinations {
+			if h.destinations[i].Name == input {
+				return &h.destinations[i], true
+			}
+		}
+		fmt.Fprintf(h.output, "Invalid input. Please enter a number between 1 and %d or a destination name.\n", len(h.destinations))
+	}
+}
+
+// audit records the decision when auditing is enabled
+func (h *DLRHandler) audit(ctx context.Context, message *Message, action ReviewAction, destination, reason string) error {
+	if h.auditor == nil {
+		return nil
+	}
+	return h.auditor.Record(ctx, NewAuditEntry(message, action, h.config.Source, destination, reason))
+}
+
+// promptRule walks the reviewer through building and confirming a bulk rule
+func (h *DLRHandler) promptRule(message *Message) (MatchRule, bool) {
+	var action ReviewAction
+	for action == "" {
+		fmt.Fprint(h.output, "Apply to all matching messages. Choose action ([m]ove / [d]iscard / [c]ancel): ")
+		switch h.readInput() {
+		case "m":
+			action = ReviewActionMove
+		case "d":
+			action = ReviewActionDiscard
+		case "c":
+			return MatchRule{}, false
+		default:
+			fmt.Fprintln(h.output, "Invalid input. Please enter 'm', 'd', or 'c'.")
+		}
+	}
+
+	destination := ""
+	if action == ReviewActionMove && len(h.destinations) > 1 {
+		chosen, ok := h.promptDestination()
+		if !ok {
+			return MatchRule{}, false
+		}
+		destination = chosen.Name
+	}
+
+	candidates := matchCandidates(message, action, destination)
+	if len(candidates) == 0 {
+		fmt.Fprintln(h.output, "This message has no attributes or JSON data fields to match on.")
+		return MatchRule{}, false
+	}
+
+	fmt.Fprintln(h.output, "Match on:")
+	for i, candidate := range candidates {
+		fmt.Fprintf(h.output, "  [%d] %s\n", i+1, candidate.Condition())
+	}
+
+	var rule MatchRule
+	for {
+		fmt.Fprintf(h.output, "Choose a field (1-%d, blank to cancel): ", len(candidates))
+		input := h.readInput()
+		if input == "" {
+			return MatchRule{}, false
+		}
+		choice, err := strconv.Atoi(input)
+		if err == nil && choice >= 1 && choice <= len(candidates) {
+			rule = candidates[choice-1]
+			break
 		}
+		fmt.Fprintf(h.output, "Invalid input. Please enter a number between 1 and %d.\n", len(candidates))
+	}
+
+	fmt.Fprintf(h.output, "Rule: %s\n", rule)
+	fmt.Fprint(h.output, "Confirm rule? [y/N]: ")
+	if h.readInput() != "y" {
+		fmt.Fprintln(h.output, "Rule cancelled.")
+		return MatchRule{}, false
 	}
+	return rule, true
+}
+
+// readInput reads one line of reviewer input, normalized for comparison
+func (h *DLRHandler) readInput() string {
+	return strings.ToLower(h.readLine())
+}
+
+// readLine reads one line of reviewer input as typed
+func (h *DLRHandler) readLine() string {
+	input, _ := h.reader.ReadString('\n')
+	return strings.TrimSpace(input)
 }
 
 // dlrCmd represents the dlr command
@@ -82,7 +396,30 @@ var dlrCmd = &cobra.Command{
 	Use:   "dlr",
 	Short: "Review and process dead-lettered messages",
 	Long: `Interactively review dead-lettered messages and choose to discard or move each message.
-For moved messages, the message is republished to the destination.`,
+For moved messages, the message is republished to the destination.
+
+Choosing [a]ll matching builds a rule from the current message's attributes or JSON
+data fields. Once confirmed, every remaining message that matches the rule is moved or
+discarded automatically, while non-matching messages are still prompted for.
+
+Use --named-destination name=<topic> (repeatable) to offer additional destinations.
+When moving a message, the reviewer then chooses between the default --destination
+and the named destinations, e.g. [1] default / [2] retry / [3] quarantine.
+
+With --undo-window-seconds and/or --undo-depth, decisions are held back instead of being
+carried out immediately. Held messages keep their lease and the last decision can be
+reverted with [u]ndo until it is committed, which happens once it is older than the
+window, once more than depth decisions are held, or when the review ends.
+
+With --archive-type and --archive, every discarded message is written to the archive
+together with the decision, reviewer, timestamp and reason before it is acknowledged.
+If the archive write fails the message is left unacknowledged.
+
+With --audit-log and/or --audit-topic, every move and discard decision is recorded
+as an NDJSON audit entry before the message is published or acknowledged.
+
+Before the review starts, credentials, resources and permissions are checked as by
+'replay doctor', unless --skip-preflight is given.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Parse and validate configuration
 		config, err := ParseCommandConfig(cmd)
@@ -94,16 +431,59 @@ For moved messages, the message is republished to the destination.`,
 		fmt.Printf("Starting DLR review from %s\n", config.Source)
 		ctx := context.Background()
 
+		// Check credentials, resources and permissions before the review starts
+		if err := runPreflight(ctx, *config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
 		// Create message broker
-		broker, err := NewPubSubBroker(ctx, config.Source, config.Destination)
+		broker, err := NewMessageBroker(ctx, config.SourceType, config.Source, config.DestinationType, config.Destination)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			return
 		}
 		defer broker.Close()
 
+		// Create archiver for discarded messages
+		var archiver Archiver
+		if config.ArchiveType != "" {
+			archiver, err = NewArchiver(ctx, config.ArchiveType, config.Archive)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			defer archiver.Close()
+		}
+
+		// Create auditor for review decisions
+		auditor, err := NewConfiguredAuditor(ctx, *config)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if auditor != nil {
+			defer auditor.Close()
+		}
+
+		// Create publishers for named destinations
+		var named []ReviewDestination
+		for _, destination := range config.Destinations {
+			publisher, err := NewMessagePublisher(ctx, destination.Resource)
+			if err != nil {
+				fmt.Printf("Error: destination %s: %v\n", destination.Name, err)
+				return
+			}
+			defer publisher.Close()
+			named = append(named, ReviewDestination{
+				Name:      destination.Name,
+				Resource:  destination.Resource,
+				Publisher: publisher,
+			})
+		}
+
 		// Create handler and processor
-		handler := NewDLRHandler(broker, *config)
+		handler := NewDLRHandler(broker, *config, named, archiver, auditor)
 		processor := NewMessageProcessor(broker, *config, handler, os.Stdout)
 
 		// Process messages
@@ -118,7 +498,15 @@ func init() {
 
 	// Add common flags
 	AddCommonFlags(dlrCmd)
+	AddSourceTypes(dlrCmd, constants.BrokerTypeKafkaTopic, constants.BrokerTypeAMQPQueue, constants.BrokerTypeAWSSQSQueue, constants.BrokerTypeNATSJetStream, constants.BrokerTypeRedisStream)
+	AddDestinationTypes(dlrCmd, constants.BrokerTypeKafkaTopic, constants.BrokerTypeAMQPExchange, constants.BrokerTypeAWSSQSQueue, constants.BrokerTypeAWSSNSTopic, constants.BrokerTypeNATSJetStream, constants.BrokerTypeRedisStream)
 
 	// Add DLR-specific flags
 	dlrCmd.Flags().Bool("pretty-json", false, "Display message data as pretty JSON")
+	dlrCmd.Flags().StringArray("named-destination", nil, "Additional destination offered when moving, as name=projects/<proj>/topics/<topic>, name=kafka://<broker>/<topic>, name=amqp://<host>/<vhost>?exchange=<exchange>, an SQS queue URL, an SNS topic ARN, name=nats://<server>/<subject> or name=redis://<host>/<stream> (repeatable)")
+	dlrCmd.Flags().Int("undo-window-seconds", 0, "Hold each decision for this many seconds so it can be undone (0 to disable)")
+	dlrCmd.Flags().Int("undo-depth", 0, "Hold up to this many decisions so they can be undone (0 to disable)")
+	AddArchiveFlags(dlrCmd)
+	AddAuditFlags(dlrCmd)
+	AddPreflightFlags(dlrCmd)
 }
@@ -0,0 +1,372 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"replay/constants"
+
+	iampb "cloud.google.com/go/iam/apiv1/iampb"
+	"cloud.google.com/go/pubsub/v2"
+	pubsubpb "cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"github.com/spf13/cobra"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Permissions a command needs on the resources it uses
+const (
+	permissionConsume = "pubsub.subscriptions.consume"
+	permissionPublish = "pubsub.topics.publish"
+	permissionGet     = "pubsub.subscriptions.get"
+)
+
+// permissionRoles are the predefined roles granting each permission
+var permissionRoles = map[string]string{
+	permissionConsume: "roles/pubsub.subscriber",
+	permissionPublish: "roles/pubsub.publisher",
+	permissionGet:     "roles/pubsub.viewer",
+}
+
+// PreflightCheck is the outcome of a single preflight check
+type PreflightCheck struct {
+	Name string
+	// Detail describes a passed check
+	Detail string
+	Err    error
+	// Remediation explains how to fix a failed check
+	Remediation string
+}
+
+// Preflight checks that credentials are available and that the subscriptions a
+// command consumes and the topics it publishes to exist and are accessible
+type Preflight struct {
+	Subscriptions []string
+	// Topics are published to with the destination credentials
+	Topics []string
+	// DestinationSubscriptions are looked up with the destination credentials to
+	// route messages to them
+	DestinationSubscriptions []string
+	// AuditTopics, such as the archive and audit topics, are published to with
+	// the source credentials
+	AuditTopics []string
+}
+
+// NewPreflight builds the preflight for a command configuration, covering its
+// source, destinations, quarantine, archive topic and audit topic. Kafka, AMQP,
+// AWS, NATS and Redis resources are not covered.
+func NewPreflight(config CommandConfig) Preflight {
+	preflight := Preflight{}
+	if isPubSubType(config.SourceType) || config.SourceType == "" {
+		preflight.Subscriptions = []string{config.Source}
+	}
+	topics := []string{config.Quarantine}
+	switch config.DestinationType {
+	case constants.BrokerTypeGCPPubSubSubscription:
+		preflight.DestinationSubscriptions = []string{config.Destination}
+	case constants.BrokerTypeGCPPubSubTopic, "":
+		topics = append([]string{config.Destination}, topics...)
+	}
+	for _, destination := range config.Destinations {
+		topics = append(topics, destination.Resource)
+	}
+	topics = slices.DeleteFunc(topics, isExternalAddress)
+	preflight.Topics = uniqueNames(topics)
+
+	auditTopics := []string{config.AuditTopic}
+	if config.ArchiveType == constants.BrokerTypeGCPPubSubTopic {
+		auditTopics = append(auditTopics, config.Archive)
+	}
+	preflight.AuditTopics = uniqueNames(auditTopics)
+	return preflight
+}
+
+// IsEmpty reports whether there are no Pub/Sub resources to check
+func (p Preflight) IsEmpty() bool {
+	return len(p.Subscriptions)+len(p.Topics)+len(p.DestinationSubscriptions)+len(p.AuditTopics) == 0
+}
+
+// uniqueNames drops empty and repeated names, keeping their order
+func uniqueNames(names []string) []string {
+	var unique []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+// Run performs the checks. Resources are not checked with credentials that do not work.
+func (p Preflight) Run(ctx context.Context) []PreflightCheck {
+	type clientKey struct {
+		project     string
+		credentials Credentials
+	}
+	clients := map[clientKey]*pubsub.Client{}
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+	clientWith := func(credentials Credentials) func(string) (*pubsub.Client, error) {
+		return func(project string) (*pubsub.Client, error) {
+			key := clientKey{project, credentials}
+			if c, ok := clients[key]; ok {
+				return c, nil
+			}
+			c, err := newPubSubClient(ctx, project, credentials)
+			if err != nil {
+				return nil, err
+			}
+			clients[key] = c
+			return c, nil
+		}
+	}
+
+	source := checkCredentials(ctx, "Credentials", sourceCredentials)
+	checks := []PreflightCheck{source}
+	destinationUsable := source.Err == nil
+	destination := effectiveDestinationCredentials()
+	if destination != sourceCredentials && len(p.Topics)+len(p.DestinationSubscriptions) > 0 {
+		check := checkCredentials(ctx, "Destination credentials", destination)
+		checks = append(checks, check)
+		destinationUsable = check.Err == nil
+	}
+
+	if source.Err == nil {
+		for _, subscription := range p.Subscriptions {
+			checks = append(checks, checkResource(ctx, clientWith(sourceCredentials), subscription, "subscriptions", permissionConsume))
+		}
+	}
+	if destinationUsable {
+		for _, subscription := range p.DestinationSubscriptions {
+			checks = append(checks, checkResource(ctx, clientWith(destination), subscription, "subscriptions", permissionGet))
+		}
+		for _, topic := range p.Topics {
+			checks = append(checks, checkResource(ctx, clientWith(destination), topic, "topics", permissionPublish))
+		}
+	}
+	if source.Err == nil {
+		for _, topic := range p.AuditTopics {
+			checks = append(checks, checkResource(ctx, clientWith(sourceCredentials), topic, "topics", permissionPublish))
+		}
+	}
+	return checks
+}
+
+// checkCredentials checks that credentials can obtain a token, unless an emulator is used
+func checkCredentials(ctx context.Context, name string, credentials Credentials) PreflightCheck {
+	check := PreflightCheck{Name: name}
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+		check.Detail = "using the Pub/Sub emulator at " + host
+		return check
+	}
+	if credentials.IsZero() {
+		found, err := google.FindDefaultCredentials(ctx, pubsub.ScopePubSub)
+		if err != nil {
+			check.Err = errors.New("no application default credentials found")
+			check.Remediation = "Run 'gcloud auth application-default login', set GOOGLE_APPLICATION_CREDENTIALS or use --credentials-file with a service account key file"
+			return check
+		}
+		check.Detail = "application default credentials found"
+		if found.ProjectID != "" {
+			check.Detail += " (project " + found.ProjectID + ")"
+		}
+		return check
+	}
+
+	tokens, err := credentials.TokenSource(ctx)
+	if err == nil {
+		_, err = tokens.Token()
+	}
+	if err != nil {
+		check.Err = fmt.Errorf("%s: %w", credentials, err)
+		if credentials.ImpersonateServiceAccount != "" {
+			check.Remediation = fmt.Sprintf("Grant roles/iam.serviceAccountTokenCreator on %s to the base credentials, and check that the service account exists", credentials.ImpersonateServiceAccount)
+		} else {
+			check.Remediation = "Check that the file is a service account key in JSON format and that the key has not been deleted or disabled"
+		}
+		return check
+	}
+	check.Detail = "using " + credentials.String()
+	return check
+}
+
+// checkResource verifies that a subscription or topic exists and that the caller
+// has permission on it
+func checkResource(ctx context.Context, client func(string) (*pubsub.Client, error), resource, collection, permission string) PreflightCheck {
+	kind := strings.TrimSuffix(collection, "s")
+	check := PreflightCheck{Name: strings.ToUpper(kind[:1]) + kind[1:] + " " + resource}
+
+	parsed, err := ParseResourceName(resource, collection, "")
+	if err != nil {
+		check.Err = err
+		check.Remediation = fmt.Sprintf("Use the full resource name, e.g. projects/<project>/%s/<name>", collection)
+		return check
+	}
+	project := parsed.Project
+	c, err := client(project)
+	if err != nil {
+		check.Err = fmt.Errorf("failed to create client: %w", err)
+		return check
+	}
+
+	// Permissions can be tested without any permission on the resource, and a
+	// missing resource is reported as not found
+	request := &iampb.TestIamPermissionsRequest{Resource: resource, Permissions: []string{permission}}
+	var response *iampb.TestIamPermissionsResponse
+	if collection == "subscriptions" {
+		response, err = c.SubscriptionAdminClient.TestIamPermissions(ctx, request)
+	} else {
+		response, err = c.TopicAdminClient.TestIamPermissions(ctx, request)
+	}
+
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.Unimplemented:
+		// Emulators do not implement IAM, so only check that the resource exists
+		if collection == "subscriptions" {
+			_, err = c.SubscriptionAdminClient.GetSubscription(ctx, &pubsubpb.GetSubscriptionRequest{Subscription: resource})
+		} else {
+			_, err = c.TopicAdminClient.GetTopic(ctx, &pubsubpb.GetTopicRequest{Topic: resource})
+		}
+		if err == nil {
+			check.Detail = "exists (permissions not checked)"
+			return check
+		}
+		if status.Code(err) != codes.NotFound {
+			check.Err = err
+			return check
+		}
+		fallthrough
+	case codes.NotFound:
+		check.Err = fmt.Errorf("%s does not exist", kind)
+		check.Remediation = fmt.Sprintf("Check the name, or list the project's %s with 'gcloud pubsub %s list --project %s'", collection, collection, project)
+		return check
+	case codes.Unauthenticated:
+		check.Err = errors.New("credentials were rejected")
+		check.Remediation = "Run 'gcloud auth application-default login' again, or check GOOGLE_APPLICATION_CREDENTIALS and the credential flags"
+		return check
+	default:
+		check.Err = err
+		return check
+	}
+
+	for _, granted := range response.GetPermissions() {
+		if granted == permission {
+			check.Detail = "exists, " + permission + " granted"
+			return check
+		}
+	}
+	role := permissionRoles[permission]
+	check.Err = fmt.Errorf("missing permission %s", permission)
+	check.Remediation = fmt.Sprintf("Grant %s on the %s: 'gcloud pubsub %s add-iam-policy-binding %s --member=<principal> --role=%s'",
+		role, kind, collection, resource, role)
+	return check
+}
+
+// WritePreflightChecks prints each check and its remediation if it failed, and
+// returns how many checks failed
+func WritePreflightChecks(w io.Writer, checks []PreflightCheck) int {
+	failed := 0
+	for _, check := range checks {
+		if check.Err == nil {
+			fmt.Fprintf(w, "[OK]   %s: %s\n", check.Name, check.Detail)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "[FAIL] %s: %v\n", check.Name, check.Err)
+		if check.Remediation != "" {
+			fmt.Fprintf(w, "       Fix: %s\n", check.Remediation)
+		}
+	}
+	return failed
+}
+
+// preflightError summarises failed checks as a single error, or returns nil if all passed
+func preflightError(checks []PreflightCheck) error {
+	var failures []string
+	for _, check := range checks {
+		if check.Err == nil {
+			continue
+		}
+		failure := fmt.Sprintf("%s: %v", check.Name, check.Err)
+		if check.Remediation != "" {
+			failure += ". Fix: " + check.Remediation
+		}
+		failures = append(failures, failure)
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("preflight checks failed (use --skip-preflight to run anyway):\n  %s", strings.Join(failures, "\n  "))
+}
+
+// runPreflight runs the preflight for a command unless --skip-preflight was given
+// or the command uses no Pub/Sub resources
+func runPreflight(ctx context.Context, config CommandConfig) error {
+	preflight := NewPreflight(config)
+	if config.SkipPreflight || preflight.IsEmpty() {
+		return nil
+	}
+	return preflightError(preflight.Run(ctx))
+}
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Checks credentials, resources and permissions",
+	Long: `Checks that everything a command needs is in place, and explains how to fix what is not:
+- credentials are available: application default credentials, or those given with
+  --credentials-file, --impersonate-service-account and their --destination-* variants
+- the --source subscription exists and pubsub.subscriptions.consume is granted on it
+- every --destination topic exists and pubsub.topics.publish is granted on it
+
+move and dlr run the same checks automatically before they start, unless
+--skip-preflight is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		source, _ := cmd.Flags().GetString("source")
+		destinations, _ := cmd.Flags().GetStringArray("destination")
+
+		// Names that cannot be expanded are reported by their check
+		preflight := Preflight{}
+		if source != "" {
+			if expanded, err := expandResourceName(cmd, source, collectionSubscriptions); err == nil {
+				source = expanded
+			}
+			preflight.Subscriptions = []string{source}
+		}
+		for _, destination := range destinations {
+			if expanded, err := expandResourceName(cmd, destination, collectionTopics); err == nil {
+				destination = expanded
+			}
+			preflight.Topics = append(preflight.Topics, destination)
+		}
+
+		checks := preflight.Run(context.Background())
+		if failed := WritePreflightChecks(os.Stdout, checks); failed > 0 {
+			fmt.Printf("\n%d of %d checks failed\n", failed, len(checks))
+			return
+		}
+		fmt.Printf("\nAll %d checks passed\n", len(checks))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().String("source", "", "Subscription to check (e.g. projects/<proj>/subscriptions/<sub>)")
+	doctorCmd.Flags().StringArray("destination", nil, "Topic to check (e.g. projects/<proj>/topics/<topic>, repeatable)")
+}
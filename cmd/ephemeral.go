@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"replay/constants"
+
+	"cloud.google.com/go/pubsub/v2"
+	pubsubpb "cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ephemeralPurposeLabel tells the temporary subscriptions replay creates to read
+// a topic apart from other resources created by replay
+const ephemeralPurposeLabel = "replay-purpose"
+
+// ephemeralDeleteTimeout bounds deleting a temporary subscription on exit, when
+// the command's own context may already be cancelled
+const ephemeralDeleteTimeout = 30 * time.Second
+
+// EphemeralSubscription is a temporary subscription for reading messages
+// published to a topic. It is deleted when the command exits, and expires on
+// its own if the command is killed before it can delete it.
+type EphemeralSubscription struct {
+	client *pubsub.Client
+	Name   string
+	Topic  string
+}
+
+// CreateEphemeralSubscription creates a temporary subscription on a topic, in the
+// topic's project, that expires after ttl without activity
+func CreateEphemeralSubscription(ctx context.Context, topic string, ttl time.Duration) (*EphemeralSubscription, error) {
+	project, err := resourceProject(topic, collectionTopics)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newPubSubClient(ctx, project, sourceCredentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	name := fmt.Sprintf("projects/%s/subscriptions/%s", project, ephemeralSubscriptionID(topic))
+	_, err = client.SubscriptionAdminClient.CreateSubscription(ctx, &pubsubpb.Subscription{
+		Name:             name,
+		Topic:            topic,
+		Labels:           map[string]string{snapshotLabel: "replay", ephemeralPurposeLabel: "topic-source"},
+		ExpirationPolicy: &pubsubpb.ExpirationPolicy{Ttl: durationpb.New(ttl)},
+	})
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to create a temporary subscription on %s: %w", topic, err)
+	}
+	return &EphemeralSubscription{client: client, Name: name, Topic: topic}, nil
+}
+
+// ephemeralSubscriptionID names a temporary subscription after its topic and the
+// time it was created, with a random suffix so concurrent runs do not collide
+func ephemeralSubscriptionID(topic string) string {
+	topicID := topic[strings.LastIndex(topic, "/")+1:]
+	if len(topicID) > 200 {
+		topicID = topicID[:200]
+	}
+	return fmt.Sprintf("replay-%s-%s-%04x", topicID, time.Now().UTC().Format("20060102-150405"), rand.IntN(0x10000))
+}
+
+// Delete deletes the subscription and closes its client
+func (s *EphemeralSubscription) Delete() error {
+	defer s.client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), ephemeralDeleteTimeout)
+	defer cancel()
+	return s.client.SubscriptionAdminClient.DeleteSubscription(ctx, &pubsubpb.DeleteSubscriptionRequest{Subscription: s.Name})
+}
+
+// openTopicSource replaces a topic source with a temporary subscription on it,
+// and returns a function deleting the subscription again. It does nothing for
+// subscription sources.
+func openTopicSource(ctx context.Context, config *CommandConfig) (func(), error) {
+	if config.SourceType != constants.BrokerTypeGCPPubSubTopic {
+		return func() {}, nil
+	}
+	subscription, err := CreateEphemeralSubscription(ctx, config.Source, config.SubscriptionTTL)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Created temporary subscription %s on %s, it is deleted on exit or expires after %v", subscription.Name, config.Source, config.SubscriptionTTL)
+	config.Source = subscription.Name
+	return func() {
+		if err := subscription.Delete(); err != nil {
+			log.Printf("Warning: failed to delete temporary subscription %s, it expires after %v: %v", subscription.Name, config.SubscriptionTTL, err)
+			return
+		}
+		log.Printf("Deleted temporary subscription %s", subscription.Name)
+	}, nil
+}
@@ -0,0 +1,243 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"replay/constants"
+
+	"github.com/spf13/cobra"
+)
+
+// ExportConfig holds the export-specific options
+type ExportConfig struct {
+	Format       string
+	Output       string
+	NoAck        bool
+	Gzip         bool
+	Overwrite    bool
+	MaxFileBytes int64
+}
+
+// parseExportConfig extracts and validates the export-specific flags
+func parseExportConfig(cmd *cobra.Command) (*ExportConfig, error) {
+	format, _ := cmd.Flags().GetString("format")
+	output, _ := cmd.Flags().GetString("output")
+	noAck, _ := cmd.Flags().GetBool("no-ack")
+	gzip, _ := cmd.Flags().GetBool("gzip")
+	overwrite, _ := cmd.Flags().GetBool("overwrite")
+	maxFileBytes, _ := cmd.Flags().GetInt64("max-file-bytes")
+
+	if maxFileBytes < 0 {
+		return nil, fmt.Errorf("--max-file-bytes must not be negative")
+	}
+	if maxFileBytes > 0 && format == constants.ExportFormatRawDir {
+		return nil, fmt.Errorf("--max-file-bytes is not supported with the %s format", constants.ExportFormatRawDir)
+	}
+	// Name compressed files for what they hold
+	if gzip && format != constants.ExportFormatRawDir && !strings.HasSuffix(output, ".gz") {
+		output += ".gz"
+	}
+
+	return &ExportConfig{
+		Format:       format,
+		Output:       output,
+		NoAck:        noAck,
+		Gzip:         gzip,
+		Overwrite:    overwrite,
+		MaxFileBytes: maxFileBytes,
+	}, nil
+}
+
+// ExportHandler implements MessageHandler by writing each message to local files.
+// Messages are acknowledged in batches once the batch is durable on disk, or
+// held and released at the end when exporting without acknowledging.
+type ExportHandler struct {
+	broker MessageBroker
+	writer MessageWriter
+	noAck  bool
+	leases *LeaseKeeper
+	batch  []*Message
+	held   []*Message
+	failed int
+	logger *log.Logger
+}
+
+// NewExportHandler creates a new export handler
+func NewExportHandler(broker MessageBroker, writer MessageWriter, noAck bool) *ExportHandler {
+	return &ExportHandler{
+		broker: broker,
+		writer: writer,
+		noAck:  noAck,
+		leases: NewLeaseKeeper(broker, constants.DefaultLeaseExtension),
+		logger: log.New(os.Stdout, "", log.LstdFlags),
+	}
+}
+
+// HandleMessage writes the message and holds it until its batch is synced
+func (h *ExportHandler) HandleMessage(ctx context.Context, message *Message, msgNum int) (bool, error) {
+	if err := h.writer.Write(NewMessageRecord(message)); err != nil {
+		h.logger.Printf("Failed to export message %d: %v", msgNum, err)
+		return false, ErrQuit
+	}
+	h.logger.Printf("Exported message %d", msgNum)
+
+	h.leases.Hold(message.AckID)
+	h.batch = append(h.batch, message)
+	if len(h.batch) >= constants.DefaultExportBatchSize {
+		h.commit(ctx)
+	}
+	return false, ErrDeferred
+}
+
+// commit syncs the output and acknowledges (or keeps holding) the current batch
+func (h *ExportHandler) commit(ctx context.Context) {
+	batch := h.batch
+	h.batch = nil
+
+	if err := h.writer.Sync(); err != nil {
+		h.logger.Printf("Failed to sync exported messages, leaving %d messages unacknowledged: %v", len(batch), err)
+		h.failed += len(batch)
+		for _, message := range batch {
+			h.leases.Drop(message.AckID)
+		}
+		return
+	}
+
+	if h.noAck {
+		h.held = append(h.held, batch...)
+		return
+	}
+	for _, message := range batch {
+		if err := h.broker.Acknowledge(ctx, message.AckID); err != nil {
+			h.logger.Printf("Warning: failed to acknowledge message %s: %v", message.ID, err)
+		}
+		h.leases.Drop(message.AckID)
+	}
+}
+
+// Flush commits the last batch and, without acknowledging, releases every held message
+func (h *ExportHandler) Flush(ctx context.Context) int {
+	h.commit(ctx)
+	for _, message := range h.held {
+		if err := h.broker.Release(ctx, message.AckID); err != nil {
+			h.logger.Printf("Warning: failed to release message %s: %v", message.ID, err)
+		}
+	}
+	h.held = nil
+	h.leases.Stop()
+	return h.failed
+}
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports messages from a source to local files",
+	Long: `Exports messages from a source to local files for offline analysis.
+
+Each message's data bytes, attributes, message ID, publish time and ordering key are
+written in one of the following formats:
+- jsonl:   one JSON object per line, with data base64-encoded
+- json:    a JSON array of the same objects
+- csv:     one row per message, with attributes as JSON and data base64-encoded
+- raw-dir: a directory with a .data file of raw bytes and a .json metadata file per message
+
+By default the source is drained: messages are acknowledged once they are safely
+written to disk. With --no-ack, messages are copied and released back to the source
+at the end of the export. Existing output files are never replaced unless
+--overwrite is given, since drained messages could not be exported again.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(os.Stdout)
+
+		// Parse and validate configuration
+		config, err := ParseCommandConfig(cmd)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return
+		}
+		exportConfig, err := parseExportConfig(cmd)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return
+		}
+
+		writer, err := NewMessageWriter(exportConfig.Format, exportConfig.Output, exportConfig.Gzip, exportConfig.Overwrite, exportConfig.MaxFileBytes)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return
+		}
+
+		// Informational output
+		log.Printf("Exporting messages from %s to %s", config.Source, exportConfig.Output)
+
+		// Stop on Ctrl+C, so that a topic source can delete its temporary subscription
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// Read a topic source through a temporary subscription
+		closeSource, err := openTopicSource(ctx, config)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return
+		}
+		defer closeSource()
+
+		// Create message broker
+		broker, err := NewMessageBroker(ctx, config.SourceType, config.Source, "", "")
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return
+		}
+		defer broker.Close()
+
+		// Create handler and processor
+		handler := NewExportHandler(broker, writer, exportConfig.NoAck)
+		processor := NewMessageProcessor(broker, *config, handler, os.Stdout)
+
+		// Process messages
+		exported, err := processor.Process(ctx)
+		if err != nil {
+			log.Printf("Error during processing: %v", err)
+		}
+		if err := writer.Close(); err != nil {
+			log.Printf("Error closing output: %v", err)
+		}
+
+		for _, file := range writer.Files() {
+			log.Printf("Wrote %s", file)
+		}
+		if exportConfig.NoAck {
+			log.Printf("Export completed. Total messages copied: %d (released back to the source)", exported)
+		} else {
+			log.Printf("Export completed. Total messages exported: %d", exported)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	// Add source flags
+	AddSourceFlags(exportCmd)
+	AddTopicSourceFlags(exportCmd)
+	AddSourceTypes(exportCmd, constants.BrokerTypeKafkaTopic, constants.BrokerTypeAMQPQueue, constants.BrokerTypeAWSSQSQueue, constants.BrokerTypeNATSJetStream, constants.BrokerTypeRedisStream)
+	exportCmd.Flags().Lookup("count").Usage = "Number of messages to export (0 for all messages)"
+
+	// Add export-specific flags
+	exportCmd.Flags().String("format", constants.ExportFormatJSONL, fmt.Sprintf("Output format (%s)", strings.Join(exportFormats(), ", ")))
+	exportCmd.Flags().String("output", "", "Output file path, or directory for the raw-dir format")
+	exportCmd.Flags().Bool("no-ack", false, "Copy messages without acknowledging them, releasing them back to the source when done")
+	exportCmd.Flags().Bool("gzip", false, "Compress output files with gzip, adding .gz to the output name")
+	exportCmd.Flags().Bool("overwrite", false, "Replace existing output files instead of refusing to export")
+	exportCmd.Flags().Int64("max-file-bytes", 0, "Start a new numbered output file once the current one reaches about this many bytes (0 for a single file)")
+
+	_ = exportCmd.MarkFlagRequired("output")
+}
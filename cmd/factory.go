@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"replay/constants"
+)
+
+// MessageSource is the consuming side of a MessageBroker
+type MessageSource interface {
+	Pull(ctx context.Context, config PullConfig) (*Message, error)
+	Acknowledge(ctx context.Context, ackID string) error
+	ExtendAckDeadline(ctx context.Context, ackID string, deadline time.Duration) error
+	Release(ctx context.Context, ackID string) error
+	Close() error
+}
+
+// splitBroker implements MessageBroker for a source and a destination of different broker types
+type splitBroker struct {
+	MessageSource
+	publisher MessagePublisher
+}
+
+// Publish publishes a message to the destination
+func (b *splitBroker) Publish(ctx context.Context, message *Message) error {
+	if b.publisher == nil {
+		return fmt.Errorf("no destination configured")
+	}
+	return b.publisher.Publish(ctx, message)
+}
+
+// ExtendAckDeadlines extends the ack deadlines of messages in batches if the source supports it
+func (b *splitBroker) ExtendAckDeadlines(ctx context.Context, ackIDs []string, deadline time.Duration) error {
+	return extendAckDeadlines(ctx, b.MessageSource, ackIDs, deadline)
+}
+
+// Receive streams messages if the source supports it
+func (b *splitBroker) Receive(ctx context.Context, handle func(ctx context.Context, message *Message) bool) error {
+	streaming, ok := b.MessageSource.(StreamingBroker)
+	if !ok {
+		return fmt.Errorf("the source does not support streaming")
+	}
+	return streaming.Receive(ctx, handle)
+}
+
+// Close closes the source and the destination
+func (b *splitBroker) Close() error {
+	if b.publisher != nil {
+		b.publisher.Close()
+	}
+	return b.MessageSource.Close()
+}
+
+// NewMessageBroker creates a broker reading from source and publishing to
+// destination, which may be empty for commands that only read from the source.
+// A destination subscription must already be resolved to its topic.
+func NewMessageBroker(ctx context.Context, sourceType, source, destinationType, destination string) (MessageBroker, error) {
+	pubSubDestination := destination == "" || isPubSubType(destinationType)
+	if isPubSubType(sourceType) && pubSubDestination {
+		return NewPubSubBroker(ctx, source, destination)
+	}
+
+	var messageSource MessageSource
+	var err error
+	switch sourceType {
+	case constants.BrokerTypeKafkaTopic:
+		messageSource, err = NewKafkaSource(ctx, source)
+	case constants.BrokerTypeAMQPQueue:
+		messageSource, err = NewAMQPSource(ctx, source)
+	case constants.BrokerTypeAWSSQSQueue:
+		messageSource, err = NewSQSSource(ctx, source)
+	case constants.BrokerTypeNATSJetStream:
+		messageSource, err = NewNATSSource(ctx, source)
+	case constants.BrokerTypeRedisStream:
+		messageSource, err = NewRedisSource(ctx, source)
+	default:
+		messageSource, err = NewPubSubBroker(ctx, source, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if destination == "" {
+		return &splitBroker{MessageSource: messageSource}, nil
+	}
+
+	publisher, err := NewDestinationPublisher(ctx, destinationType, destination)
+	if err != nil {
+		messageSource.Close()
+		return nil, err
+	}
+	return &splitBroker{MessageSource: messageSource, publisher: publisher}, nil
+}
+
+// NewMessagePublisher creates a publisher for a kafka:// topic, an amqp://
+// exchange, an SQS queue URL, an SNS topic ARN, a nats:// subject, a redis:// stream
+// or a Pub/Sub topic
+func NewMessagePublisher(ctx context.Context, destination string) (MessagePublisher, error) {
+	switch {
+	case isKafkaAddress(destination):
+		return NewKafkaPublisher(ctx, destination)
+	case isAMQPAddress(destination):
+		return NewAMQPPublisher(ctx, destination)
+	case isSQSAddress(destination):
+		return NewSQSPublisher(ctx, destination)
+	case isSNSAddress(destination):
+		return NewSNSPublisher(ctx, destination)
+	case isNATSAddress(destination):
+		return NewNATSPublisher(ctx, destination)
+	case isRedisAddress(destination):
+		return NewRedisPublisher(ctx, destination)
+	}
+	return NewPubSubPublisher(ctx, destination)
+}
+
+// NewDestinationPublisher creates a publisher for a destination of a given type.
+// Queues on SQS-compatible stand-ins are only recognised by their type, so they
+// are created here rather than picked by NewMessagePublisher.
+func NewDestinationPublisher(ctx context.Context, destinationType, destination string) (MessagePublisher, error) {
+	if destinationType == constants.BrokerTypeAWSSQSQueue {
+		return NewSQSPublisher(ctx, destination)
+	}
+	return NewMessagePublisher(ctx, destination)
+}
+
+// isPubSubType reports whether a broker type is a Pub/Sub subscription or topic
+func isPubSubType(brokerType string) bool {
+	return brokerType == constants.BrokerTypeGCPPubSubSubscription || brokerType == constants.BrokerTypeGCPPubSubTopic
+}
+
+// isExternalAddress reports whether a destination is the URI of a broker other than Pub/Sub
+func isExternalAddress(value string) bool {
+	return isKafkaAddress(value) || isAMQPAddress(value) || isSQSAddress(value) || isSNSAddress(value) || isNATSAddress(value) ||
+		isRedisAddress(value)
+}
+
+// validateAddress checks the URI of a source or destination of a broker type
+// other than Pub/Sub
+func validateAddress(brokerType, value string, source bool) error {
+	var err error
+	switch brokerType {
+	case constants.BrokerTypeKafkaTopic:
+		_, err = ParseKafkaAddress(value, source)
+	case constants.BrokerTypeAMQPQueue, constants.BrokerTypeAMQPExchange:
+		_, err = ParseAMQPAddress(value, source)
+	case constants.BrokerTypeAWSSQSQueue:
+		_, err = ParseSQSQueueURL(value)
+	case constants.BrokerTypeAWSSNSTopic:
+		_, err = ParseSNSTopicARN(value)
+	case constants.BrokerTypeNATSJetStream:
+		_, err = ParseNATSAddress(value, source)
+	case constants.BrokerTypeRedisStream:
+		_, err = ParseRedisAddress(value, source)
+	}
+	return err
+}
+
+// validateDestinationAddress checks the URI of a destination given without a type
+func validateDestinationAddress(value string) error {
+	switch {
+	case isKafkaAddress(value):
+		return validateAddress(constants.BrokerTypeKafkaTopic, value, false)
+	case isSQSAddress(value):
+		return validateAddress(constants.BrokerTypeAWSSQSQueue, value, false)
+	case isSNSAddress(value):
+		return validateAddress(constants.BrokerTypeAWSSNSTopic, value, false)
+	case isNATSAddress(value):
+		return validateAddress(constants.BrokerTypeNATSJetStream, value, false)
+	case isRedisAddress(value):
+		return validateAddress(constants.BrokerTypeRedisStream, value, false)
+	}
+	return validateAddress(constants.BrokerTypeAMQPExchange, value, false)
+}
+
+// isKafkaAddress reports whether a source or destination is a Kafka topic
+func isKafkaAddress(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), kafkaURIScheme)
+}
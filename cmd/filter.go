@@ -0,0 +1,351 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MessageFilter selects messages by data pattern, attributes and JSON data
+// predicates. A message matches when it satisfies every configured condition.
+type MessageFilter struct {
+	Pattern    *regexp.Regexp
+	Attributes []AttributeMatch
+	JSONPaths  []JSONPathPredicate
+}
+
+// NewMessageFilter builds a filter from a data regular expression (may be empty),
+// key[=value] attribute conditions and JSONPath predicates
+func NewMessageFilter(pattern string, attributes, jsonPaths []string) (*MessageFilter, error) {
+	filter := &MessageFilter{}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		filter.Pattern = re
+	}
+	for _, value := range attributes {
+		match, err := ParseAttributeMatch(value)
+		if err != nil {
+			return nil, err
+		}
+		filter.Attributes = append(filter.Attributes, match)
+	}
+	for _, value := range jsonPaths {
+		predicate, err := ParseJSONPathPredicate(value)
+		if err != nil {
+			return nil, err
+		}
+		filter.JSONPaths = append(filter.JSONPaths, predicate)
+	}
+	return filter, nil
+}
+
+// Empty reports whether the filter has no conditions and so matches every message
+func (f *MessageFilter) Empty() bool {
+	return f.Pattern == nil && len(f.Attributes) == 0 && len(f.JSONPaths) == 0
+}
+
+// Matches reports whether the message satisfies every condition
+func (f *MessageFilter) Matches(message *Message) bool {
+	if f.Pattern != nil && !f.Pattern.Match(message.Data) {
+		return false
+	}
+	for _, match := range f.Attributes {
+		if !match.Matches(message) {
+			return false
+		}
+	}
+	if len(f.JSONPaths) > 0 {
+		root, ok := decodeJSONData(message.Data)
+		if !ok {
+			return false
+		}
+		for _, predicate := range f.JSONPaths {
+			if !predicate.Matches(root) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// String describes the filter's conditions
+func (f *MessageFilter) String() string {
+	var conditions []string
+	if f.Pattern != nil {
+		conditions = append(conditions, fmt.Sprintf("data =~ /%s/", f.Pattern))
+	}
+	for _, match := range f.Attributes {
+		conditions = append(conditions, match.String())
+	}
+	for _, predicate := range f.JSONPaths {
+		conditions = append(conditions, predicate.Expression)
+	}
+	if len(conditions) == 0 {
+		return "all messages"
+	}
+	return strings.Join(conditions, " and ")
+}
+
+// AttributeMatch requires an attribute to be present, optionally with a given value
+type AttributeMatch struct {
+	Key      string
+	Value    string
+	HasValue bool
+}
+
+// ParseAttributeMatch parses key=value, or key alone to require only presence
+func ParseAttributeMatch(value string) (AttributeMatch, error) {
+	key, expected, hasValue := strings.Cut(value, "=")
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return AttributeMatch{}, fmt.Errorf("invalid attribute condition %q, expected key or key=value", value)
+	}
+	return AttributeMatch{Key: key, Value: expected, HasValue: hasValue}, nil
+}
+
+// Matches reports whether the message carries the attribute
+func (m AttributeMatch) Matches(message *Message) bool {
+	value, ok := message.Attributes[m.Key]
+	return ok && (!m.HasValue || value == m.Value)
+}
+
+func (m AttributeMatch) String() string {
+	if m.HasValue {
+		return fmt.Sprintf("attribute %s = %q", m.Key, m.Value)
+	}
+	return fmt.Sprintf("attribute %s present", m.Key)
+}
+
+// jsonPathOperators lists two-character operators first so that >= is not read as >
+var jsonPathOperators = []string{"==", "!=", "=~", ">=", "<=", ">", "<"}
+
+// JSONPathPredicate compares the value at a JSONPath in the message data. Paths
+// support a subset of JSONPath: $.field, nested fields, [n] indexes and [*]
+// wildcards. Without an operator the predicate only requires the path to exist.
+type JSONPathPredicate struct {
+	Expression string
+	Path       []string
+	Operator   string
+	Operand    string
+	pattern    *regexp.Regexp
+}
+
+// ParseJSONPathPredicate parses expressions such as $.order.id == 12345,
+// $.items[*].sku =~ ^AB or $.customer.email
+func ParseJSONPathPredicate(expression string) (JSONPathPredicate, error) {
+	predicate := JSONPathPredicate{Expression: strings.TrimSpace(expression)}
+
+	// The first operator in the expression separates the path from the operand
+	path, position := predicate.Expression, -1
+	for _, operator := range jsonPathOperators {
+		if i := strings.Index(predicate.Expression, operator); i > 0 && (position < 0 || i < position) {
+			position, predicate.Operator = i, operator
+		}
+	}
+	if position > 0 {
+		path = strings.TrimSpace(predicate.Expression[:position])
+		predicate.Operand = unquoteOperand(strings.TrimSpace(predicate.Expression[position+len(predicate.Operator):]))
+	}
+
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return JSONPathPredicate{}, fmt.Errorf("invalid JSONPath predicate %q: %w", expression, err)
+	}
+	predicate.Path = segments
+
+	if predicate.Operator == "=~" {
+		if predicate.pattern, err = regexp.Compile(predicate.Operand); err != nil {
+			return JSONPathPredicate{}, fmt.Errorf("invalid JSONPath predicate %q: %w", expression, err)
+		}
+	}
+	return predicate, nil
+}
+
+// parseJSONPath splits $.a.b[0].c[*] into the segments a, b, [0], c, [*]
+func parseJSONPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path must start with $")
+	}
+	rest := path[1:]
+	var segments []string
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			field := rest[1 : end+1]
+			if field == "" {
+				return nil, fmt.Errorf("empty field name")
+			}
+			segments = append(segments, field)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [")
+			}
+			index := rest[1:end]
+			if index != "*" {
+				if _, err := strconv.Atoi(index); err != nil {
+					if unquoted, err := strconv.Unquote(strings.ReplaceAll(index, "'", `"`)); err == nil {
+						// Bracket notation for a field name, e.g. ['field name']
+						segments = append(segments, unquoted)
+						rest = rest[end+1:]
+						continue
+					}
+					return nil, fmt.Errorf("invalid index %q", index)
+				}
+			}
+			segments = append(segments, "["+index+"]")
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest[0])
+		}
+	}
+	return segments, nil
+}
+
+// unquoteOperand strips the quotes of a JSON string literal operand
+func unquoteOperand(operand string) string {
+	if len(operand) >= 2 && (operand[0] == '"' || operand[0] == '\'') && operand[len(operand)-1] == operand[0] {
+		return operand[1 : len(operand)-1]
+	}
+	return operand
+}
+
+// Matches reports whether any value at the path satisfies the predicate
+func (p JSONPathPredicate) Matches(root interface{}) bool {
+	for _, value := range resolveJSONPath(root, p.Path) {
+		if p.Operator == "" {
+			return true
+		}
+		if p.compare(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare applies the operator to a single value
+func (p JSONPathPredicate) compare(value interface{}) bool {
+	scalar, ok := jsonScalarString(value)
+	if !ok {
+		return false
+	}
+	switch p.Operator {
+	case "==":
+		return scalar == p.Operand || numbersEqual(scalar, p.Operand)
+	case "!=":
+		return scalar != p.Operand && !numbersEqual(scalar, p.Operand)
+	case "=~":
+		return p.pattern.MatchString(scalar)
+	}
+
+	left, leftErr := strconv.ParseFloat(scalar, 64)
+	right, rightErr := strconv.ParseFloat(p.Operand, 64)
+	if leftErr != nil || rightErr != nil {
+		// Fall back to comparing strings, which orders ISO 8601 timestamps correctly
+		return compareOrdered(strings.Compare(scalar, p.Operand), p.Operator)
+	}
+	switch {
+	case left < right:
+		return compareOrdered(-1, p.Operator)
+	case left > right:
+		return compareOrdered(1, p.Operator)
+	default:
+		return compareOrdered(0, p.Operator)
+	}
+}
+
+// compareOrdered applies an ordering operator to a comparison result
+func compareOrdered(cmp int, operator string) bool {
+	switch operator {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	default:
+		return false
+	}
+}
+
+// numbersEqual reports whether two strings are the same decimal number, e.g. 1.0
+// and 1. The decimals are compared exactly rather than as floats, so that large
+// integer IDs such as 9007199254740993 and 9007199254740992 stay apart.
+func numbersEqual(a, b string) bool {
+	x, okA := canonicalDecimal(a)
+	y, okB := canonicalDecimal(b)
+	return okA && okB && x == y
+}
+
+// decimalPattern matches a JSON number, capturing sign, integer part, fraction and exponent
+var decimalPattern = regexp.MustCompile(`^(-?)(\d+)(?:\.(\d+))?(?:[eE]([+-]?\d+))?$`)
+
+// canonicalDecimal renders a decimal number as its significant digits and the
+// exponent of the last one, e.g. 1.50e2 as "15e1", so equal numbers render the same
+func canonicalDecimal(value string) (string, bool) {
+	parts := decimalPattern.FindStringSubmatch(value)
+	if parts == nil {
+		return "", false
+	}
+	exponent := int64(0)
+	if parts[4] != "" {
+		parsed, err := strconv.ParseInt(parts[4], 10, 32)
+		if err != nil {
+			return "", false
+		}
+		exponent = parsed
+	}
+	digits := strings.TrimLeft(parts[2]+parts[3], "0")
+	exponent -= int64(len(parts[3]))
+	trimmed := strings.TrimRight(digits, "0")
+	exponent += int64(len(digits) - len(trimmed))
+	if trimmed == "" {
+		return "0", true
+	}
+	return fmt.Sprintf("%s%se%d", parts[1], trimmed, exponent), true
+}
+
+// resolveJSONPath returns every value found at the path, expanding [*] wildcards
+func resolveJSONPath(root interface{}, path []string) []interface{} {
+	current := []interface{}{root}
+	for _, segment := range path {
+		var next []interface{}
+		for _, value := range current {
+			switch {
+			case segment == "[*]":
+				switch v := value.(type) {
+				case []interface{}:
+					next = append(next, v...)
+				case map[string]interface{}:
+					for _, item := range v {
+						next = append(next, item)
+					}
+				}
+			case strings.HasPrefix(segment, "["):
+				index, _ := strconv.Atoi(segment[1 : len(segment)-1])
+				if array, ok := value.([]interface{}); ok && index >= 0 && index < len(array) {
+					next = append(next, array[index])
+				}
+			default:
+				if object, ok := value.(map[string]interface{}); ok {
+					if item, ok := object[segment]; ok {
+						next = append(next, item)
+					}
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Follower hands messages to a handler as they arrive on a streaming source,
+// backing off while the handler fails, until its context is done or count
+// messages have been handled
+type Follower struct {
+	source     StreamingBroker
+	handler    MessageHandler
+	count      int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	logger     *log.Logger
+
+	mu       sync.Mutex
+	handled  int
+	failed   int
+	backoff  time.Duration
+	lastDone time.Time
+}
+
+// NewFollower creates a follower. A count of 0 follows until the context is done.
+func NewFollower(source StreamingBroker, handler MessageHandler, count int, minBackoff, maxBackoff time.Duration) *Follower {
+	return &Follower{
+		source:     source,
+		handler:    handler,
+		count:      count,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		logger:     log.New(os.Stdout, "", log.LstdFlags),
+	}
+}
+
+// Run receives messages until ctx is done, logging a health line every
+// healthInterval, and returns the number of messages handled
+func (f *Follower) Run(ctx context.Context, healthInterval time.Duration) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(healthInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				f.logHealth()
+			}
+		}
+	}()
+
+	err := f.source.Receive(ctx, func(ctx context.Context, message *Message) bool {
+		return f.handle(ctx, message, cancel)
+	})
+	close(done)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.handled, err
+}
+
+// handle passes one message to the handler and reports whether to acknowledge it
+func (f *Follower) handle(ctx context.Context, message *Message, stop context.CancelFunc) bool {
+	f.mu.Lock()
+	msgNum := f.handled + f.failed + 1
+	f.mu.Unlock()
+
+	acknowledge, err := f.handler.HandleMessage(ctx, message, msgNum)
+	if err != nil {
+		delay := f.recordFailure()
+		f.logger.Printf("Error handling message %d: %v. Backing off for %v", msgNum, err, delay)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.backoff > 0 {
+		f.logger.Printf("Recovered after backing off")
+		f.backoff = 0
+	}
+	f.handled++
+	f.lastDone = time.Now()
+	if f.count > 0 && f.handled >= f.count {
+		stop()
+	}
+	return acknowledge
+}
+
+// recordFailure counts a failure and returns how long to back off, doubling
+// the delay for every consecutive failure
+func (f *Follower) recordFailure() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failed++
+	switch {
+	case f.backoff == 0:
+		f.backoff = f.minBackoff
+	case f.backoff*2 > f.maxBackoff:
+		f.backoff = f.maxBackoff
+	default:
+		f.backoff *= 2
+	}
+	return f.backoff
+}
+
+// logHealth logs the follower's progress
+func (f *Follower) logHealth() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	last := "none yet"
+	if !f.lastDone.IsZero() {
+		last = time.Since(f.lastDone).Round(time.Second).String() + " ago"
+	}
+	status := "healthy"
+	if f.backoff > 0 {
+		status = "backing off for " + f.backoff.String()
+	}
+	f.logger.Printf("Health: %s, %d messages handled, %d failures, last message %s", status, f.handled, f.failed, last)
+}
@@ -0,0 +1,310 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"replay/constants"
+
+	"github.com/spf13/cobra"
+)
+
+// Commands that matched messages can be handed to with grep --then
+const (
+	grepThenDLR  = "dlr"
+	grepThenMove = "move"
+)
+
+// GrepHandler implements MessageHandler by printing the messages that match a
+// filter. Every scanned message is held so it is not read twice; at the end
+// they are released, except for matches that are kept to be handed on.
+type GrepHandler struct {
+	broker     MessageBroker
+	filter     *MessageFilter
+	prettyJSON bool
+	keep       bool
+	leases     *LeaseKeeper
+	seen       map[string]bool
+	held       []*Message
+	matches    []*Message
+	output     io.Writer
+}
+
+// NewGrepHandler creates a new grep handler. With keep set, matched messages
+// stay leased after the scan for Handoff.
+func NewGrepHandler(broker MessageBroker, filter *MessageFilter, prettyJSON, keep bool, output io.Writer) *GrepHandler {
+	return &GrepHandler{
+		broker:     broker,
+		filter:     filter,
+		prettyJSON: prettyJSON,
+		keep:       keep,
+		leases:     NewLeaseKeeper(broker, constants.DefaultLeaseExtension),
+		seen:       map[string]bool{},
+		output:     output,
+	}
+}
+
+// HandleMessage prints the message if it matches and holds it until the scan is done
+func (h *GrepHandler) HandleMessage(ctx context.Context, message *Message, msgNum int) (bool, error) {
+	h.leases.Hold(message.AckID)
+	duplicate := h.seen[message.ID]
+	h.seen[message.ID] = true
+	if duplicate || !h.filter.Matches(message) {
+		// A redelivered copy is held too, or it would be pulled again and again
+		h.held = append(h.held, message)
+		return false, ErrDeferred
+	}
+
+	h.matches = append(h.matches, message)
+	fmt.Fprintf(h.output, "\n--- Match %d (message %d) ---\n", len(h.matches), msgNum)
+	fmt.Fprintf(h.output, "ID: %s\n", message.ID)
+	fmt.Fprintf(h.output, "Publish time: %s\n", message.PublishTime.Format(time.RFC3339))
+	if message.OrderingKey != "" {
+		fmt.Fprintf(h.output, "Ordering key: %s\n", message.OrderingKey)
+	}
+	if message.DeliveryAttempt > 0 {
+		fmt.Fprintf(h.output, "Delivery attempt: %d\n", message.DeliveryAttempt)
+	}
+	if len(message.Attributes) > 0 {
+		keys := make([]string, 0, len(message.Attributes))
+		for key := range message.Attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintln(h.output, "Attributes:")
+		for _, key := range keys {
+			fmt.Fprintf(h.output, "  %s: %s\n", key, message.Attributes[key])
+		}
+	}
+	fmt.Fprintf(h.output, "Data: %s\n", FormatMessageData(message.Data, h.prettyJSON))
+	return false, ErrDeferred
+}
+
+// Flush releases every scanned message that is not kept for Handoff
+func (h *GrepHandler) Flush(ctx context.Context) int {
+	release := h.held
+	if !h.keep {
+		release = append(release, h.matches...)
+	}
+	for _, message := range release {
+		h.leases.Drop(message.AckID)
+		if err := h.broker.Release(ctx, message.AckID); err != nil {
+			fmt.Fprintf(h.output, "Warning: failed to release message %s: %v\n", message.ID, err)
+		}
+	}
+	h.held = nil
+	if !h.keep {
+		h.leases.Stop()
+	}
+	return 0
+}
+
+// Matches returns the messages that matched the filter
+func (h *GrepHandler) Matches() []*Message {
+	return h.matches
+}
+
+// Handoff returns a broker that serves the kept matches instead of pulling from
+// the source, so they can be processed by another handler
+func (h *GrepHandler) Handoff() *QueuedBroker {
+	return &QueuedBroker{MessageBroker: h.broker, queue: h.matches, leases: h.leases}
+}
+
+// QueuedBroker serves already pulled messages from a queue, keeping their leases
+// alive until they are acknowledged or released. Everything else is delegated
+// to the underlying broker.
+type QueuedBroker struct {
+	MessageBroker
+	queue  []*Message
+	leases *LeaseKeeper
+}
+
+// Pull returns the next queued message, or nil once the queue is empty
+func (b *QueuedBroker) Pull(ctx context.Context, config PullConfig) (*Message, error) {
+	if len(b.queue) == 0 {
+		return nil, nil
+	}
+	message := b.queue[0]
+	b.queue = b.queue[1:]
+	return message, nil
+}
+
+// Acknowledge acknowledges a message and stops extending its lease
+func (b *QueuedBroker) Acknowledge(ctx context.Context, ackID string) error {
+	b.leases.Drop(ackID)
+	return b.MessageBroker.Acknowledge(ctx, ackID)
+}
+
+// Release releases a message and stops extending its lease
+func (b *QueuedBroker) Release(ctx context.Context, ackID string) error {
+	b.leases.Drop(ackID)
+	return b.MessageBroker.Release(ctx, ackID)
+}
+
+// ExtendAckDeadlines extends the ack deadlines of messages in batches if the
+// underlying broker supports it
+func (b *QueuedBroker) ExtendAckDeadlines(ctx context.Context, ackIDs []string, deadline time.Duration) error {
+	return extendAckDeadlines(ctx, b.MessageBroker, ackIDs, deadline)
+}
+
+// Drain releases the messages that were never handed out and stops extending leases.
+// Messages handed out but not acknowledged expire at their current deadline.
+func (b *QueuedBroker) Drain(ctx context.Context) {
+	for _, message := range b.queue {
+		_ = b.Release(ctx, message.AckID)
+	}
+	b.queue = nil
+	b.leases.Stop()
+}
+
+// grepCmd represents the grep command
+var grepCmd = &cobra.Command{
+	Use:   "grep [pattern]",
+	Short: "Searches a source for matching messages",
+	Long: `Scans messages in a source and prints those that match, with their metadata.
+
+A message matches when its data matches the regular expression [pattern] and it
+satisfies every --attribute and --jsonpath condition:
+- --attribute key=value requires an attribute value, --attribute key only its presence
+- --jsonpath evaluates a predicate on JSON data, e.g. '$.order.id == 12345',
+  '$.items[*].sku =~ ^AB', '$.amount >= 100' or '$.customer.email' (exists).
+  Paths support fields, [n] indexes and [*] wildcards.
+
+Every scanned message is released back to the source, so nothing is consumed.
+With --then dlr or --then move, the matched messages are instead handed to an
+interactive review or moved to --destination. As with move, credentials, resources
+and permissions are checked first unless --skip-preflight is given, and a
+destination that feeds the source subscription is refused unless --allow-loop is given.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Parse and validate configuration
+		config, err := ParseCommandConfig(cmd)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		pattern := ""
+		if len(args) > 0 {
+			pattern = args[0]
+		}
+		then, _ := cmd.Flags().GetString("then")
+
+		filter, err := parseMessageFilter(cmd, pattern)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if filter.Empty() {
+			fmt.Println("Error: provide a pattern, --attribute or --jsonpath")
+			return
+		}
+		switch then {
+		case "":
+		case grepThenDLR, grepThenMove:
+			if config.Destination == "" {
+				fmt.Printf("Error: --then %s requires --destination\n", then)
+				return
+			}
+		default:
+			fmt.Printf("Error: unsupported --then value: %s. Supported: %s, %s\n", then, grepThenDLR, grepThenMove)
+			return
+		}
+
+		fmt.Printf("Searching %s for %s\n", config.Source, filter)
+		ctx := context.Background()
+
+		// Create message broker
+		destination := ""
+		if then != "" {
+			destination = config.Destination
+		}
+		if then != "" {
+			// Check credentials, resources and permissions as move and dlr do
+			if err := runPreflight(ctx, *config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
+		broker, err := NewPubSubBroker(ctx, config.Source, destination)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		defer broker.Close()
+		if then != "" {
+			// Refuse to hand matched messages back to their own subscription
+			if err := checkMoveLoop(ctx, broker, *config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
+
+		// Scan messages
+		handler := NewGrepHandler(broker, filter, config.PrettyJSON, then != "", os.Stdout)
+		processor := NewMessageProcessor(broker, *config, handler, os.Stdout)
+		scanned, _ := processor.Process(ctx)
+
+		matched := len(handler.Matches())
+		fmt.Printf("\nSearch completed. Messages scanned: %d, matched: %d\n", scanned, matched)
+		if then == "" {
+			return
+		}
+
+		// Hand matched messages to the chosen command
+		queued := handler.Handoff()
+		defer queued.Drain(ctx)
+		if matched == 0 {
+			return
+		}
+
+		auditor, err := NewConfiguredAuditor(ctx, *config)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if auditor != nil {
+			defer auditor.Close()
+		}
+
+		handoffConfig := *config
+		handoffConfig.Count = 0
+		var next MessageHandler
+		if then == grepThenDLR {
+			fmt.Printf("\nReviewing %d matched messages\n", matched)
+			next = NewDLRHandler(queued, handoffConfig, nil, nil, auditor)
+		} else {
+			fmt.Printf("\nMoving %d matched messages to %s\n", matched, config.Destination)
+			next = NewMoveHandler(queued, handoffConfig, auditor, nil)
+		}
+		processed, _ := NewMessageProcessor(queued, handoffConfig, next, os.Stdout).Process(ctx)
+		fmt.Printf("\nMatched messages processed with %s: %d\n", then, processed)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(grepCmd)
+
+	// Add source flags
+	AddSourceFlags(grepCmd)
+	grepCmd.Flags().Lookup("count").Usage = "Number of messages to scan (0 for all messages)"
+
+	// Add search flags
+	AddFilterFlags(grepCmd)
+	grepCmd.Flags().Bool("pretty-json", false, "Display matched message data as formatted JSON")
+
+	// Add flags for handing matched messages on
+	grepCmd.Flags().String("then", "", fmt.Sprintf("Hand matched messages to %s or %s instead of releasing them", grepThenDLR, grepThenMove))
+	grepCmd.Flags().String("destination-type", constants.BrokerTypeGCPPubSubTopic, "Message destination type for --then")
+	addSupportedTypes(grepCmd, destinationTypesAnnotation, "destination-type", "Message destination type for --then", []string{constants.BrokerTypeGCPPubSubTopic})
+	grepCmd.Flags().String("destination", "", "Full destination resource name for --then (e.g. projects/<proj>/topics/<topic>)")
+	grepCmd.Flags().Bool("allow-loop", false, "With --then, hand matched messages on even if the destination feeds the source subscription")
+	AddAuditFlags(grepCmd)
+	AddPreflightFlags(grepCmd)
+}
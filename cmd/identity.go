@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	reviewerOnce sync.Once
+	reviewerName string
+)
+
+// currentReviewer identifies the person running the command, preferring the
+// active gcloud account over the local OS user
+func currentReviewer() string {
+	reviewerOnce.Do(func() {
+		if account := gcloudConfigValue("account"); account != "" {
+			reviewerName = account
+			return
+		}
+		if u, err := user.Current(); err == nil && u.Username != "" {
+			reviewerName = u.Username
+			return
+		}
+		if name := os.Getenv("USER"); name != "" {
+			reviewerName = name
+			return
+		}
+		reviewerName = "unknown"
+	})
+	return reviewerName
+}
+
+// gcloudConfigValue reads a property from the active gcloud configuration,
+// returning an empty string if gcloud is unavailable or the property is unset
+func gcloudConfigValue(property string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "gcloud", "config", "get-value", property).Output()
+	if err != nil {
+		return ""
+	}
+	value := strings.TrimSpace(string(out))
+	if value == "(unset)" {
+		return ""
+	}
+	return value
+}
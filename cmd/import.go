@@ -0,0 +1,245 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"replay/constants"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
+)
+
+// Attribute keys optionally added to imported messages
+const (
+	importAttrImportedAt        = "replay_imported_at"
+	importAttrOriginalMessageID = "replay_original_message_id"
+)
+
+// ImportConfig holds the import-specific options
+type ImportConfig struct {
+	Format        string
+	Input         string
+	Rate          float64
+	StartLine     int
+	AddAttributes bool
+}
+
+// parseImportConfig extracts and validates the import-specific flags
+func parseImportConfig(cmd *cobra.Command) (*ImportConfig, error) {
+	format, _ := cmd.Flags().GetString("format")
+	input, _ := cmd.Flags().GetString("input")
+	ratePerSecond, _ := cmd.Flags().GetFloat64("rate")
+	startLine, _ := cmd.Flags().GetInt("start-line")
+	addAttributes, _ := cmd.Flags().GetBool("add-import-attributes")
+
+	if ratePerSecond < 0 {
+		return nil, fmt.Errorf("--rate must not be negative")
+	}
+	if startLine < 1 {
+		return nil, fmt.Errorf("--start-line must be at least 1")
+	}
+
+	return &ImportConfig{
+		Format:        format,
+		Input:         input,
+		Rate:          ratePerSecond,
+		StartLine:     startLine,
+		AddAttributes: addAttributes,
+	}, nil
+}
+
+// ImportResult summarizes an import run
+type ImportResult struct {
+	Published   int
+	Skipped     int
+	FailedLines []int
+	// LastLine is the line number of the last record read
+	LastLine int
+}
+
+// Importer publishes records read from local files to a destination
+type Importer struct {
+	publisher     MessagePublisher
+	limiter       *rate.Limiter
+	addAttributes bool
+	logger        *log.Logger
+}
+
+// NewImporter creates an importer. A rate of 0 publishes as fast as possible.
+func NewImporter(publisher MessagePublisher, ratePerSecond float64, addAttributes bool) *Importer {
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if ratePerSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(ratePerSecond), 1)
+	}
+	return &Importer{
+		publisher:     publisher,
+		limiter:       limiter,
+		addAttributes: addAttributes,
+		logger:        log.New(os.Stdout, "", log.LstdFlags),
+	}
+}
+
+// Import publishes every record from startLine onwards. Records that cannot be
+// decoded or published are reported with their line number and skipped; the
+// returned error is set only when the input cannot be read any further.
+func (i *Importer) Import(ctx context.Context, reader MessageReader, startLine int) (ImportResult, error) {
+	var result ImportResult
+	for {
+		record, line, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		var lineErr *LineError
+		if errors.As(err, &lineErr) {
+			result.LastLine = line
+			if line < startLine {
+				result.Skipped++
+				continue
+			}
+			i.logger.Printf("Line %d: failed to read record: %v", line, lineErr.Err)
+			result.FailedLines = append(result.FailedLines, line)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		result.LastLine = line
+		if line < startLine {
+			result.Skipped++
+			continue
+		}
+
+		if err := i.limiter.Wait(ctx); err != nil {
+			return result, err
+		}
+		if err := i.publisher.Publish(ctx, i.message(record)); err != nil {
+			i.logger.Printf("Line %d: failed to publish message %s: %v", line, record.ID, err)
+			result.FailedLines = append(result.FailedLines, line)
+			continue
+		}
+		result.Published++
+		i.logger.Printf("Line %d: published message %s", line, record.ID)
+	}
+}
+
+// message builds the message to publish from a record
+func (i *Importer) message(record MessageRecord) *Message {
+	attributes := record.Attributes
+	if i.addAttributes {
+		attributes = make(map[string]string, len(record.Attributes)+2)
+		for k, v := range record.Attributes {
+			attributes[k] = v
+		}
+		attributes[importAttrImportedAt] = time.Now().UTC().Format(time.RFC3339)
+		if record.ID != "" {
+			attributes[importAttrOriginalMessageID] = record.ID
+		}
+	}
+	return &Message{
+		Data:        record.Data,
+		Attributes:  attributes,
+		OrderingKey: record.OrderingKey,
+	}
+}
+
+// formatLines renders line numbers as a comma-separated list
+func formatLines(lines []int) string {
+	parts := make([]string, len(lines))
+	for i, line := range lines {
+		parts[i] = fmt.Sprintf("%d", line)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Imports messages from local files to a destination",
+	Long: `Imports messages from local files written by the export command and publishes
+them to a destination with their original data, attributes and ordering key.
+
+Records that cannot be decoded or published are reported with their line number
+and skipped. For the json and raw-dir formats the line number is the record's
+position in the array or directory. Use --start-line to resume a partial import.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(os.Stdout)
+
+		// Parse and validate configuration
+		config, err := ParseCommandConfig(cmd)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return
+		}
+		importConfig, err := parseImportConfig(cmd)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return
+		}
+
+		reader, err := NewMessageReader(importConfig.Format, importConfig.Input)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return
+		}
+		defer reader.Close()
+
+		// Informational output
+		log.Printf("Importing messages from %s to %s", importConfig.Input, config.Destination)
+		if importConfig.StartLine > 1 {
+			log.Printf("Skipping records before line %d", importConfig.StartLine)
+		}
+
+		ctx := context.Background()
+
+		// Create publisher
+		publisher, err := NewDestinationPublisher(ctx, config.DestinationType, config.Destination)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer publisher.Close()
+		if pubSub, ok := publisher.(*PubSubPublisher); ok {
+			pubSub.EnableOrdering()
+		}
+
+		importer := NewImporter(publisher, importConfig.Rate, importConfig.AddAttributes)
+		result, err := importer.Import(ctx, reader, importConfig.StartLine)
+		if err != nil {
+			log.Printf("Error reading input after line %d: %v", result.LastLine, err)
+			log.Printf("Resume with --start-line %d once the input is fixed", result.LastLine+1)
+		}
+
+		if len(result.FailedLines) > 0 {
+			log.Printf("Failed lines: %s", formatLines(result.FailedLines))
+		}
+		log.Printf("Import completed. Total messages published: %d, failed: %d, skipped: %d",
+			result.Published, len(result.FailedLines), result.Skipped)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	// Add destination flags
+	AddDestinationFlags(importCmd)
+	AddDestinationTypes(importCmd, constants.BrokerTypeKafkaTopic, constants.BrokerTypeAMQPExchange, constants.BrokerTypeAWSSQSQueue, constants.BrokerTypeAWSSNSTopic, constants.BrokerTypeNATSJetStream, constants.BrokerTypeRedisStream)
+
+	// Add import-specific flags
+	importCmd.Flags().String("format", constants.ExportFormatJSONL, fmt.Sprintf("Input format (%s)", strings.Join(exportFormats(), ", ")))
+	importCmd.Flags().String("input", "", "Input file path, or directory for the raw-dir format (gzip-compressed files are decompressed)")
+	importCmd.Flags().Float64("rate", 0, "Maximum number of messages to publish per second (0 for no limit)")
+	importCmd.Flags().Int("start-line", 1, "Skip records before this line number, e.g. to resume a partial import")
+	importCmd.Flags().Bool("add-import-attributes", false, "Add replay_imported_at and replay_original_message_id attributes to imported messages")
+
+	_ = importCmd.MarkFlagRequired("input")
+}
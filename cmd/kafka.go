@@ -0,0 +1,526 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// kafkaURIScheme prefixes Kafka topics, e.g. kafka://<broker>[,<broker>...]/<topic>
+const kafkaURIScheme = "kafka://"
+
+// defaultKafkaGroup is the consumer group offsets are committed to unless group is given
+const defaultKafkaGroup = "replay"
+
+// Kafka partitioners for destinations
+const (
+	kafkaPartitionerHash        = "hash"
+	kafkaPartitionerRoundRobin  = "round-robin"
+	kafkaPartitionerLeastBackup = "least-backup"
+)
+
+// kafkaTopicPattern follows the Kafka naming rules for topics
+var kafkaTopicPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,249}$`)
+
+// KafkaAddress is a Kafka topic given as kafka://<broker>[,<broker>...]/<topic>?<options>.
+// Sources take the options group, partitions, start and end; destinations take
+// partitioner and partition; both take tls.
+type KafkaAddress struct {
+	Brokers []string
+	Topic   string
+	TLS     bool
+	// Group is the consumer group a source commits acknowledged offsets to
+	Group string
+	// Partitions are read directly instead of joining the consumer group
+	Partitions []int32
+	// Start and End bound the offsets read from Partitions, End exclusive; -1 if not set
+	Start int64
+	End   int64
+	// Partitioner picks a destination partition for each message
+	Partitioner string
+	// Partition is the fixed destination partition, or -1 to use Partitioner
+	Partition int32
+}
+
+// ParseKafkaAddress parses a Kafka source or destination
+func ParseKafkaAddress(value string, source bool) (KafkaAddress, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(value), kafkaURIScheme)
+	if !ok {
+		return KafkaAddress{}, fmt.Errorf("invalid Kafka topic %q, expected %s<broker>[,<broker>...]/<topic>", value, kafkaURIScheme)
+	}
+	uri, err := url.Parse("kafka://" + rest)
+	if err != nil {
+		return KafkaAddress{}, fmt.Errorf("invalid Kafka topic %q: %w", value, err)
+	}
+
+	address := KafkaAddress{
+		Topic:       strings.TrimPrefix(uri.Path, "/"),
+		Group:       defaultKafkaGroup,
+		Start:       -1,
+		End:         -1,
+		Partitioner: kafkaPartitionerHash,
+		Partition:   -1,
+	}
+	for _, broker := range strings.Split(uri.Host, ",") {
+		if broker == "" {
+			return KafkaAddress{}, fmt.Errorf("invalid Kafka topic %q: a broker address is empty", value)
+		}
+		address.Brokers = append(address.Brokers, broker)
+	}
+	if !kafkaTopicPattern.MatchString(address.Topic) {
+		return KafkaAddress{}, fmt.Errorf("invalid Kafka topic name %q in %q: names are 1 to 249 letters, digits, '.', '_' or '-'", address.Topic, value)
+	}
+
+	sourceOptions := []string{"group", "partitions", "start", "end"}
+	destinationOptions := []string{"partitioner", "partition"}
+	for key, values := range uri.Query() {
+		option := values[len(values)-1]
+		if source && slices.Contains(destinationOptions, key) || !source && slices.Contains(sourceOptions, key) {
+			return KafkaAddress{}, fmt.Errorf("option %s of Kafka topic %q is not supported here", key, value)
+		}
+		switch key {
+		case "tls":
+			if address.TLS, err = strconv.ParseBool(option); err != nil {
+				return KafkaAddress{}, fmt.Errorf("invalid tls %q in %q, expected true or false", option, value)
+			}
+		case "group":
+			if option == "" {
+				return KafkaAddress{}, fmt.Errorf("empty group in %q", value)
+			}
+			address.Group = option
+		case "partitions":
+			for _, field := range strings.Split(option, ",") {
+				partition, err := strconv.ParseInt(field, 10, 32)
+				if err != nil || partition < 0 {
+					return KafkaAddress{}, fmt.Errorf("invalid partition %q in %q", field, value)
+				}
+				address.Partitions = append(address.Partitions, int32(partition))
+			}
+		case "start", "end":
+			offset, err := strconv.ParseInt(option, 10, 64)
+			if err != nil || offset < 0 {
+				return KafkaAddress{}, fmt.Errorf("invalid %s offset %q in %q", key, option, value)
+			}
+			if key == "start" {
+				address.Start = offset
+			} else {
+				address.End = offset
+			}
+		case "partitioner":
+			if option != kafkaPartitionerHash && option != kafkaPartitionerRoundRobin && option != kafkaPartitionerLeastBackup {
+				return KafkaAddress{}, fmt.Errorf("invalid partitioner %q in %q, expected %s, %s or %s", option, value,
+					kafkaPartitionerHash, kafkaPartitionerRoundRobin, kafkaPartitionerLeastBackup)
+			}
+			address.Partitioner = option
+		case "partition":
+			partition, err := strconv.ParseInt(option, 10, 32)
+			if err != nil || partition < 0 {
+				return KafkaAddress{}, fmt.Errorf("invalid partition %q in %q", option, value)
+			}
+			address.Partition = int32(partition)
+		default:
+			return KafkaAddress{}, fmt.Errorf("unknown option %s in Kafka topic %q", key, value)
+		}
+	}
+
+	if (address.Start >= 0 || address.End >= 0) && len(address.Partitions) == 0 {
+		return KafkaAddress{}, fmt.Errorf("start and end offsets in %q require partitions", value)
+	}
+	if address.Start >= 0 && address.End >= 0 && address.End <= address.Start {
+		return KafkaAddress{}, fmt.Errorf("end offset must be greater than start offset in %q", value)
+	}
+	return address, nil
+}
+
+// sameTopic reports whether two addresses name the same topic on the same cluster
+func (a KafkaAddress) sameTopic(other KafkaAddress) bool {
+	return a.Topic == other.Topic && slices.ContainsFunc(a.Brokers, func(broker string) bool {
+		return slices.Contains(other.Brokers, broker)
+	})
+}
+
+// clientOptions returns the options shared by sources and destinations
+func (a KafkaAddress) clientOptions() []kgo.Opt {
+	opts := []kgo.Opt{kgo.SeedBrokers(a.Brokers...)}
+	if a.TLS {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{}))
+	}
+	return opts
+}
+
+// kafkaPartition tracks the offsets of a partition delivered by a KafkaSource
+type kafkaPartition struct {
+	// unacked holds delivered offsets that were not acknowledged yet
+	unacked map[int64]bool
+	// next is the offset after the last delivered one
+	next int64
+	// committed is the last committed offset, i.e. the next one to consume
+	committed int64
+	// ended is set once a partition read by offset range has reached its end
+	ended bool
+}
+
+// commitPoint is the offset up to which all delivered messages were acknowledged
+func (p *kafkaPartition) commitPoint() int64 {
+	point := p.next
+	for offset := range p.unacked {
+		point = min(point, offset)
+	}
+	return point
+}
+
+// KafkaSource implements MessageBroker for consuming a Kafka topic. Acknowledging
+// a message commits its offset once all earlier offsets of its partition are
+// acknowledged too, so a message that is left in the source holds back the
+// partition: later messages are delivered again by the next run, which is why
+// ParseCommandConfig refuses the modes that leave messages in place. Released
+// messages are delivered again by the same run. Kafka has no per-message
+// lease, so extending the acknowledgement deadline does nothing.
+type KafkaSource struct {
+	client     *kgo.Client
+	address    KafkaAddress
+	mu         sync.Mutex
+	partitions map[int32]*kafkaPartition
+	delivered  map[string]*Message
+	released   []*Message
+}
+
+// NewKafkaSource connects to a Kafka source, joining its consumer group unless
+// it reads explicit partitions
+func NewKafkaSource(ctx context.Context, source string) (*KafkaSource, error) {
+	address, err := ParseKafkaAddress(source, true)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &KafkaSource{address: address, partitions: map[int32]*kafkaPartition{}, delivered: map[string]*Message{}}
+	opts := address.clientOptions()
+	if len(address.Partitions) == 0 {
+		opts = append(opts,
+			kgo.ConsumerGroup(address.Group),
+			kgo.ConsumeTopics(address.Topic),
+			kgo.DisableAutoCommit(),
+			kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+			kgo.OnPartitionsLost(s.forgetPartitions),
+			kgo.OnPartitionsRevoked(s.forgetPartitions))
+	} else {
+		offset := kgo.NewOffset().AtStart()
+		if address.Start >= 0 {
+			offset = kgo.NewOffset().At(address.Start)
+		}
+		assigned := map[int32]kgo.Offset{}
+		for _, partition := range address.Partitions {
+			assigned[partition] = offset
+		}
+		opts = append(opts, kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{address.Topic: assigned}))
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+	if err := client.Ping(ctx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Kafka at %s: %w", strings.Join(address.Brokers, ","), err)
+	}
+	s.client = client
+	return s, nil
+}
+
+// forgetPartitions drops the state of partitions assigned to another group member
+func (s *KafkaSource) forgetPartitions(_ context.Context, _ *kgo.Client, lost map[string][]int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, partition := range lost[s.address.Topic] {
+		delete(s.partitions, partition)
+	}
+}
+
+// Pull retrieves a single message, preferring released messages
+func (s *KafkaSource) Pull(ctx context.Context, config PullConfig) (*Message, error) {
+	s.mu.Lock()
+	if len(s.released) > 0 {
+		message := s.released[0]
+		s.released = s.released[1:]
+		s.mu.Unlock()
+		return message, nil
+	}
+	s.mu.Unlock()
+
+	pullCtx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+	for {
+		if s.rangeEnded() {
+			return nil, nil
+		}
+		fetches := s.client.PollRecords(pullCtx, 1)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if pullCtx.Err() != nil {
+			return nil, nil
+		}
+		var fetchErr error
+		fetches.EachError(func(_ string, _ int32, err error) {
+			if fetchErr == nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+				fetchErr = err
+			}
+		})
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		for _, record := range fetches.Records() {
+			if message := s.deliver(record); message != nil {
+				return message, nil
+			}
+		}
+	}
+}
+
+// rangeEnded reports whether all partitions read by offset range reached their end
+func (s *KafkaSource) rangeEnded() bool {
+	if s.address.End < 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, partition := range s.address.Partitions {
+		if p, ok := s.partitions[partition]; !ok || !p.ended {
+			return false
+		}
+	}
+	return true
+}
+
+// deliver tracks a fetched record and converts it to a message, or returns nil if
+// the record is past the end of its partition's offset range
+func (s *KafkaSource) deliver(record *kgo.Record) *Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.partitions[record.Partition]
+	if !ok {
+		p = &kafkaPartition{unacked: map[int64]bool{}, next: record.Offset, committed: record.Offset}
+		s.partitions[record.Partition] = p
+	}
+	if s.address.End >= 0 && record.Offset >= s.address.End {
+		if !p.ended {
+			p.ended = true
+			s.client.PauseFetchPartitions(map[string][]int32{record.Topic: {record.Partition}})
+		}
+		return nil
+	}
+	p.unacked[record.Offset] = true
+	p.next = record.Offset + 1
+	if s.address.End >= 0 && p.next >= s.address.End {
+		p.ended = true
+		s.client.PauseFetchPartitions(map[string][]int32{record.Topic: {record.Partition}})
+	}
+
+	attributes := make(map[string]string, len(record.Headers))
+	for _, header := range record.Headers {
+		attributes[header.Key] = string(header.Value)
+	}
+	message := &Message{
+		ID:          fmt.Sprintf("%s/%d/%d", record.Topic, record.Partition, record.Offset),
+		Data:        record.Value,
+		Attributes:  attributes,
+		PublishTime: record.Timestamp,
+		OrderingKey: string(record.Key),
+		AckID:       fmt.Sprintf("%d:%d", record.Partition, record.Offset),
+	}
+	s.delivered[message.AckID] = message
+	return message
+}
+
+// parseKafkaAckID splits an acknowledgement ID into partition and offset
+func parseKafkaAckID(ackID string) (int32, int64, error) {
+	partitionField, offsetField, ok := strings.Cut(ackID, ":")
+	partition, partitionErr := strconv.ParseInt(partitionField, 10, 32)
+	offset, offsetErr := strconv.ParseInt(offsetField, 10, 64)
+	if !ok || partitionErr != nil || offsetErr != nil {
+		return 0, 0, fmt.Errorf("invalid Kafka acknowledgement ID %q", ackID)
+	}
+	return int32(partition), offset, nil
+}
+
+// Acknowledge marks a message as done and commits its partition's offset as far
+// as all earlier messages are done too
+func (s *KafkaSource) Acknowledge(ctx context.Context, ackID string) error {
+	partition, offset, err := parseKafkaAckID(ackID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	p, ok := s.partitions[partition]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("partition %d of %s is no longer assigned", partition, s.address.Topic)
+	}
+	delete(p.unacked, offset)
+	delete(s.delivered, ackID)
+	point := p.commitPoint()
+	if point <= p.committed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	if err := s.commit(ctx, partition, point); err != nil {
+		return fmt.Errorf("failed to commit offset %d of partition %d: %w", point, partition, err)
+	}
+	s.mu.Lock()
+	p.committed = max(p.committed, point)
+	s.mu.Unlock()
+	return nil
+}
+
+// commit commits the offset of a partition to the consumer group
+func (s *KafkaSource) commit(ctx context.Context, partition int32, offset int64) error {
+	var commitErr error
+	check := func(_ *kgo.Client, _ *kmsg.OffsetCommitRequest, response *kmsg.OffsetCommitResponse, err error) {
+		if err != nil {
+			commitErr = err
+			return
+		}
+		for _, topic := range response.Topics {
+			for _, p := range topic.Partitions {
+				if err := kerr.ErrorForCode(p.ErrorCode); err != nil && commitErr == nil {
+					commitErr = err
+				}
+			}
+		}
+	}
+
+	if len(s.address.Partitions) == 0 {
+		s.client.CommitOffsetsSync(ctx, map[string]map[int32]kgo.EpochOffset{
+			s.address.Topic: {partition: {Epoch: -1, Offset: offset}},
+		}, check)
+		return commitErr
+	}
+
+	// Partitions read directly commit to the group without being a member of it
+	request := kmsg.NewPtrOffsetCommitRequest()
+	request.Group = s.address.Group
+	request.Generation = -1
+	topic := kmsg.NewOffsetCommitRequestTopic()
+	topic.Topic = s.address.Topic
+	requestPartition := kmsg.NewOffsetCommitRequestTopicPartition()
+	requestPartition.Partition = partition
+	requestPartition.Offset = offset
+	requestPartition.LeaderEpoch = -1
+	topic.Partitions = append(topic.Partitions, requestPartition)
+	request.Topics = append(request.Topics, topic)
+	response, err := request.RequestWith(ctx, s.client)
+	check(s.client, request, response, err)
+	return commitErr
+}
+
+// ExtendAckDeadline does nothing, as Kafka does not redeliver unacknowledged
+// messages while the consumer is running
+func (s *KafkaSource) ExtendAckDeadline(ctx context.Context, ackID string, deadline time.Duration) error {
+	return nil
+}
+
+// Release queues a message to be pulled again. Its offset stays uncommitted until
+// it is acknowledged.
+func (s *KafkaSource) Release(ctx context.Context, ackID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message, ok := s.delivered[ackID]
+	if !ok {
+		return fmt.Errorf("unknown Kafka acknowledgement ID %q", ackID)
+	}
+	s.released = append(s.released, message)
+	return nil
+}
+
+// Publish is not supported by a source
+func (s *KafkaSource) Publish(ctx context.Context, message *Message) error {
+	return fmt.Errorf("no destination configured")
+}
+
+// Close leaves the consumer group and closes the connection
+func (s *KafkaSource) Close() error {
+	s.client.Close()
+	return nil
+}
+
+// KafkaPublisher implements MessagePublisher for a Kafka topic. The ordering key
+// becomes the record key and attributes become headers.
+type KafkaPublisher struct {
+	client  *kgo.Client
+	address KafkaAddress
+}
+
+// NewKafkaPublisher connects to a Kafka destination
+func NewKafkaPublisher(ctx context.Context, destination string) (*KafkaPublisher, error) {
+	address, err := ParseKafkaAddress(destination, false)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := address.clientOptions()
+	switch {
+	case address.Partition >= 0:
+		opts = append(opts, kgo.RecordPartitioner(kgo.ManualPartitioner()))
+	case address.Partitioner == kafkaPartitionerRoundRobin:
+		opts = append(opts, kgo.RecordPartitioner(kgo.RoundRobinPartitioner()))
+	case address.Partitioner == kafkaPartitionerLeastBackup:
+		opts = append(opts, kgo.RecordPartitioner(kgo.LeastBackupPartitioner()))
+	default:
+		// Keyed records go to the partition the Java client would pick
+		opts = append(opts, kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)))
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+	if err := client.Ping(ctx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Kafka at %s: %w", strings.Join(address.Brokers, ","), err)
+	}
+	return &KafkaPublisher{client: client, address: address}, nil
+}
+
+// Publish produces a message and waits until it is acknowledged by the brokers
+func (p *KafkaPublisher) Publish(ctx context.Context, message *Message) error {
+	record := &kgo.Record{
+		Topic:     p.address.Topic,
+		Value:     message.Data,
+		Partition: p.address.Partition,
+	}
+	if message.OrderingKey != "" {
+		record.Key = []byte(message.OrderingKey)
+	}
+	keys := make([]string, 0, len(message.Attributes))
+	for key := range message.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		record.Headers = append(record.Headers, kgo.RecordHeader{Key: key, Value: []byte(message.Attributes[key])})
+	}
+	return p.client.ProduceSync(ctx, record).FirstErr()
+}
+
+// Close flushes and closes the connection
+func (p *KafkaPublisher) Close() error {
+	p.client.Close()
+	return nil
+}
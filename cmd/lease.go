@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"replay/constants"
+)
+
+// LeaseKeeper periodically extends the ack deadline of messages that are held
+// without being acknowledged, so they are not redelivered in the meantime
+type LeaseKeeper struct {
+	broker   MessageBroker
+	deadline time.Duration
+	mu       sync.Mutex
+	ackIDs   map[string]struct{}
+	// fresh holds ack IDs whose lease was not extended yet, which may still be
+	// running on a subscription's ack deadline of as little as 10 seconds
+	fresh []string
+	wake  chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewLeaseKeeper starts extending held leases by deadline. New leases are
+// extended right away, and all leases are renewed every LeaseRenewalInterval.
+func NewLeaseKeeper(broker MessageBroker, deadline time.Duration) *LeaseKeeper {
+	k := &LeaseKeeper{
+		broker:   broker,
+		deadline: deadline,
+		ackIDs:   make(map[string]struct{}),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go k.run()
+	return k
+}
+
+// Hold starts extending the lease of a message, beginning right away
+func (k *LeaseKeeper) Hold(ackID string) {
+	k.mu.Lock()
+	k.ackIDs[ackID] = struct{}{}
+	k.fresh = append(k.fresh, ackID)
+	k.mu.Unlock()
+
+	select {
+	case k.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Drop stops extending the lease of a message
+func (k *LeaseKeeper) Drop(ackID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.ackIDs, ackID)
+}
+
+// Stop stops extending leases; messages still held expire at their current deadline
+func (k *LeaseKeeper) Stop() {
+	close(k.stop)
+	<-k.done
+}
+
+func (k *LeaseKeeper) run() {
+	defer close(k.done)
+
+	ticker := time.NewTicker(min(k.deadline/2, constants.LeaseRenewalInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-k.wake:
+			k.mu.Lock()
+			// Leases dropped in the meantime must not be extended, as their
+			// messages may have been released for redelivery
+			fresh := make([]string, 0, len(k.fresh))
+			for _, ackID := range k.fresh {
+				if _, held := k.ackIDs[ackID]; held {
+					fresh = append(fresh, ackID)
+				}
+			}
+			k.fresh = nil
+			k.mu.Unlock()
+			k.extend(fresh)
+		case <-ticker.C:
+			k.mu.Lock()
+			ackIDs := make([]string, 0, len(k.ackIDs))
+			for ackID := range k.ackIDs {
+				ackIDs = append(ackIDs, ackID)
+			}
+			k.fresh = nil
+			k.mu.Unlock()
+			k.extend(ackIDs)
+		}
+	}
+}
+
+// extend renews the given leases, in batches where the broker supports them so
+// that thousands of held messages are renewed well within the deadline; failures
+// are ignored since the next tick retries
+func (k *LeaseKeeper) extend(ackIDs []string) {
+	if len(ackIDs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), k.deadline/2)
+	defer cancel()
+	_ = extendAckDeadlines(ctx, k.broker, ackIDs, k.deadline)
+}
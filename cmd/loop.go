@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	pubsubpb "cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+)
+
+// detectLoop reports why publishing to destination would feed messages back to
+// the subscription they came from, or returns "" if it would not. kind names the
+// destination in the reason, e.g. "destination" or "quarantine".
+func detectLoop(subscription *pubsubpb.Subscription, kind, destination string) string {
+	if destination == "" {
+		return ""
+	}
+	if destination == subscription.GetName() {
+		return fmt.Sprintf("%s %s is the source subscription, so every moved message would be delivered to it again",
+			kind, destination)
+	}
+	if destination == subscription.GetTopic() {
+		return fmt.Sprintf("%s %s is the topic of %s, so every moved message would be delivered to it again",
+			kind, destination, subscription.GetName())
+	}
+	if deadLetterTopic := subscription.GetDeadLetterPolicy().GetDeadLetterTopic(); destination == deadLetterTopic {
+		return fmt.Sprintf("%s %s is the dead-letter topic of %s, so moved messages would be dead-lettered again",
+			kind, destination, subscription.GetName())
+	}
+	return ""
+}
+
+// detectKafkaLoop reports why publishing to destination would feed messages back
+// to the Kafka topic they came from, or returns "" if it would not
+func detectKafkaLoop(source KafkaAddress, kind, destination string) string {
+	address, err := ParseKafkaAddress(destination, false)
+	if err != nil || !source.sameTopic(address) {
+		return ""
+	}
+	return fmt.Sprintf("%s %s is the source topic, so every moved message would be consumed again", kind, destination)
+}
+
+// detectAMQPLoop reports why publishing to destination would feed messages back
+// to the AMQP queue they came from, or returns "" if it would not. Only the
+// default exchange with an explicit routing key can be checked, as the bindings of
+// other exchanges and the original routing keys of messages are not known in advance.
+func detectAMQPLoop(source AMQPAddress, kind, destination string) string {
+	address, err := ParseAMQPAddress(destination, false)
+	if err != nil || address.Exchange != "" || !address.HasRoutingKey || address.RoutingKey != source.Queue ||
+		!source.sameServer(address) {
+		return ""
+	}
+	return fmt.Sprintf("%s %s routes to the source queue %s through the default exchange, so every moved message would be consumed again",
+		kind, destination, source.Queue)
+}
+
+// detectSQSLoop reports why publishing to destination would feed messages back
+// to the SQS queue they came from, or returns "" if it would not
+func detectSQSLoop(source SQSQueue, kind, destination string) string {
+	queue, err := ParseSQSQueueURL(destination)
+	if err != nil || !strings.EqualFold(queue.URL, source.URL) {
+		return ""
+	}
+	return fmt.Sprintf("%s %s is the source queue, so every moved message would be received again", kind, destination)
+}
+
+// detectNATSLoop reports why publishing to destination would feed messages back
+// to the JetStream stream they came from, or returns "" if it would not. A
+// destination without a subject publishes each message to its own subject, which
+// cannot be checked in advance.
+func detectNATSLoop(source *NATSSource, kind, destination string) string {
+	address, err := ParseNATSAddress(destination, false)
+	if err != nil || address.Subject == "" || !source.Captures(address.Subject) {
+		return ""
+	}
+	return fmt.Sprintf("%s %s is stored by the source stream %s, so every moved message would be consumed again",
+		kind, destination, source.address.Stream)
+}
+
+// detectRedisLoop reports why publishing to destination would feed messages back
+// to the Redis stream they came from, or returns "" if it would not
+func detectRedisLoop(source RedisAddress, kind, destination string) string {
+	address, err := ParseRedisAddress(destination, false)
+	if err != nil || !source.sameStream(address) {
+		return ""
+	}
+	return fmt.Sprintf("%s %s is the source stream, so every moved message would be read again", kind, destination)
+}
@@ -0,0 +1,645 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"replay/constants"
+)
+
+// csvHeader lists the columns of exported CSV files
+var csvHeader = []string{"id", "publish_time", "ordering_key", "attributes", "data"}
+
+// MessageWriter writes message records to local files
+type MessageWriter interface {
+	Write(record MessageRecord) error
+	// Sync makes every record written so far durable on disk
+	Sync() error
+	Close() error
+	// Files lists the files (or, for raw-dir, the directory) written so far
+	Files() []string
+}
+
+// NewMessageWriter creates a writer for the given export format. For file formats,
+// maxBytes > 0 starts a new numbered file once the current one reaches roughly that size.
+// Existing files are refused unless overwrite is set, since a drained source
+// cannot export the messages they hold again.
+func NewMessageWriter(format, output string, compress, overwrite bool, maxBytes int64) (MessageWriter, error) {
+	switch format {
+	case constants.ExportFormatJSONL:
+		return newRotatingWriter(output, compress, overwrite, maxBytes, &jsonlEncoder{})
+	case constants.ExportFormatJSON:
+		return newRotatingWriter(output, compress, overwrite, maxBytes, &jsonArrayEncoder{})
+	case constants.ExportFormatCSV:
+		return newRotatingWriter(output, compress, overwrite, maxBytes, &csvEncoder{})
+	case constants.ExportFormatRawDir:
+		return newRawDirWriter(output, compress, overwrite)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s. Supported: %s", format, strings.Join(exportFormats(), ", "))
+	}
+}
+
+// exportFormats lists the supported local file formats
+func exportFormats() []string {
+	return []string{constants.ExportFormatJSONL, constants.ExportFormatJSON, constants.ExportFormatCSV, constants.ExportFormatRawDir}
+}
+
+// recordEncoder serializes records into a single file of a given format
+type recordEncoder interface {
+	begin(w io.Writer) error
+	encode(w io.Writer, record MessageRecord) error
+	end(w io.Writer) error
+}
+
+// jsonlEncoder writes one JSON record per line
+type jsonlEncoder struct{}
+
+func (e *jsonlEncoder) begin(w io.Writer) error { return nil }
+
+func (e *jsonlEncoder) encode(w io.Writer, record MessageRecord) error {
+	return json.NewEncoder(w).Encode(record)
+}
+
+func (e *jsonlEncoder) end(w io.Writer) error { return nil }
+
+// jsonArrayEncoder writes all records of a file as one JSON array
+type jsonArrayEncoder struct {
+	first bool
+}
+
+func (e *jsonArrayEncoder) begin(w io.Writer) error {
+	e.first = true
+	_, err := io.WriteString(w, "[\n")
+	return err
+}
+
+func (e *jsonArrayEncoder) encode(w io.Writer, record MessageRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if !e.first {
+		if _, err := io.WriteString(w, ",\n"); err != nil {
+			return err
+		}
+	}
+	e.first = false
+	_, err = w.Write(line)
+	return err
+}
+
+func (e *jsonArrayEncoder) end(w io.Writer) error {
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
+
+// csvEncoder writes one row per record with attributes as JSON and data as base64
+type csvEncoder struct{}
+
+func (e *csvEncoder) begin(w io.Writer) error {
+	return e.write(w, csvHeader)
+}
+
+func (e *csvEncoder) encode(w io.Writer, record MessageRecord) error {
+	attributes, err := json.Marshal(record.Attributes)
+	if err != nil {
+		return err
+	}
+	publishTime := ""
+	if !record.PublishTime.IsZero() {
+		publishTime = record.PublishTime.Format(time.RFC3339Nano)
+	}
+	return e.write(w, []string{
+		record.ID,
+		publishTime,
+		record.OrderingKey,
+		string(attributes),
+		base64.StdEncoding.EncodeToString(record.Data),
+	})
+}
+
+func (e *csvEncoder) end(w io.Writer) error { return nil }
+
+func (e *csvEncoder) write(w io.Writer, row []string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(row); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// countingWriter counts the bytes written to the underlying file
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// rotatingWriter writes records to one file, or to numbered files when rotating by size
+type rotatingWriter struct {
+	output    string
+	compress  bool
+	overwrite bool
+	maxBytes  int64
+	encoder   recordEncoder
+
+	file    *os.File
+	counter *countingWriter
+	zw      *gzip.Writer
+	buf     *bufio.Writer
+	files   []string
+}
+
+func newRotatingWriter(output string, compress, overwrite bool, maxBytes int64, encoder recordEncoder) (*rotatingWriter, error) {
+	w := &rotatingWriter{
+		output:    output,
+		compress:  compress,
+		overwrite: overwrite,
+		maxBytes:  maxBytes,
+		encoder:   encoder,
+	}
+	// Refuse an existing file before anything is read from the source
+	if !overwrite {
+		if _, err := os.Stat(w.path(1)); err == nil {
+			return nil, fmt.Errorf("output file %s already exists, use --overwrite to replace it", w.path(1))
+		}
+	}
+	return w, nil
+}
+
+// Write appends a record, rotating to a new file first if the current one is full
+func (w *rotatingWriter) Write(record MessageRecord) error {
+	if w.file != nil && w.maxBytes > 0 && w.counter.n >= w.maxBytes {
+		if err := w.closeFile(); err != nil {
+			return err
+		}
+	}
+	if w.file == nil {
+		if err := w.openFile(); err != nil {
+			return err
+		}
+	}
+	if err := w.encoder.encode(w.buf, record); err != nil {
+		return fmt.Errorf("failed to write %s: %w", w.file.Name(), err)
+	}
+	return nil
+}
+
+// Sync flushes buffered output and syncs the current file to disk
+func (w *rotatingWriter) Sync() error {
+	if w.file == nil {
+		return nil
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if w.zw != nil {
+		if err := w.zw.Flush(); err != nil {
+			return err
+		}
+	}
+	return w.file.Sync()
+}
+
+// Close finishes the current file
+func (w *rotatingWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	return w.closeFile()
+}
+
+// Files lists the files written so far
+func (w *rotatingWriter) Files() []string {
+	return w.files
+}
+
+// path returns the name of the numbered output file, or the output itself
+// without rotation
+func (w *rotatingWriter) path(number int) string {
+	if w.maxBytes > 0 {
+		return numberedPath(w.output, number)
+	}
+	return w.output
+}
+
+func (w *rotatingWriter) openFile() error {
+	path := w.path(len(w.files) + 1)
+	file, err := os.OpenFile(path, createFlags(w.overwrite), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	w.file = file
+	w.counter = &countingWriter{w: file}
+	var sink io.Writer = w.counter
+	if w.compress {
+		w.zw = gzip.NewWriter(w.counter)
+		sink = w.zw
+	}
+	w.buf = bufio.NewWriter(sink)
+	w.files = append(w.files, path)
+
+	return w.encoder.begin(w.buf)
+}
+
+func (w *rotatingWriter) closeFile() error {
+	defer func() {
+		w.file, w.counter, w.zw, w.buf = nil, nil, nil, nil
+	}()
+
+	if err := w.encoder.end(w.buf); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if w.zw != nil {
+		if err := w.zw.Close(); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// numberedPath inserts a file number before the extension, e.g. out.jsonl.gz -> out-0002.jsonl.gz
+func numberedPath(path string, number int) string {
+	dir, base := filepath.Split(path)
+	name, ext := base, ""
+	if i := strings.Index(base, "."); i > 0 {
+		name, ext = base[:i], base[i:]
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s-%04d%s", name, number, ext))
+}
+
+// createFlags returns the flags for creating an output file, which must not
+// exist yet unless overwrite is set
+func createFlags(overwrite bool) int {
+	if overwrite {
+		return os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	}
+	return os.O_CREATE | os.O_EXCL | os.O_WRONLY
+}
+
+// rawDirWriter writes each message's data bytes to its own file in a directory,
+// with the remaining metadata in a JSON file next to it
+type rawDirWriter struct {
+	dir       string
+	compress  bool
+	overwrite bool
+	count     int
+}
+
+func newRawDirWriter(dir string, compress, overwrite bool) (*rawDirWriter, error) {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 && !overwrite {
+		return nil, fmt.Errorf("output directory %s is not empty, use --overwrite to replace its files", dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return &rawDirWriter{dir: dir, compress: compress, overwrite: overwrite}, nil
+}
+
+// Write stores the data and metadata files of a record and syncs them to disk
+func (w *rawDirWriter) Write(record MessageRecord) error {
+	w.count++
+	name := fmt.Sprintf("%06d", w.count)
+	if record.ID != "" {
+		name += "_" + unsafeFileChars.ReplaceAllString(record.ID, "_")
+	}
+
+	dataPath := filepath.Join(w.dir, name+".data")
+	data := record.Data
+	if w.compress {
+		dataPath += ".gz"
+	}
+	if err := writeFileSynced(dataPath, data, w.compress, w.overwrite); err != nil {
+		return err
+	}
+
+	record.Data = nil
+	metadata, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	metadataPath := filepath.Join(w.dir, name+".json")
+	if err := writeFileSynced(metadataPath, metadata, false, w.overwrite); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Sync is a no-op since every file is synced as it is written
+func (w *rawDirWriter) Sync() error { return nil }
+
+// Close is a no-op since every file is closed as it is written
+func (w *rawDirWriter) Close() error { return nil }
+
+// Files returns the output directory once something has been written to it
+func (w *rawDirWriter) Files() []string {
+	if w.count == 0 {
+		return nil
+	}
+	return []string{w.dir}
+}
+
+// writeFileSynced writes content to a new file, optionally gzip-compressed, and syncs it
+func writeFileSynced(path string, content []byte, compress, overwrite bool) error {
+	file, err := os.OpenFile(path, createFlags(overwrite), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var sink io.Writer = file
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(file)
+		sink = zw
+	}
+	if _, err := sink.Write(content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return file.Sync()
+}
+
+// LineError reports a record that could not be read; reading can continue after it
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// MessageReader reads message records back from exported files
+type MessageReader interface {
+	// Next returns the next record and its line number, io.EOF once every record
+	// has been read, or a *LineError for a single record that could not be decoded.
+	// For the json and raw-dir formats the line number is the record's position.
+	Next() (MessageRecord, int, error)
+	Close() error
+}
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// NewMessageReader opens a reader for the given export format. Gzip-compressed
+// files are recognised by their header and decompressed, whatever their name.
+func NewMessageReader(format, input string) (MessageReader, error) {
+	if format == constants.ExportFormatRawDir {
+		return newRawDirReader(input)
+	}
+
+	file, err := os.Open(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	buffered := bufio.NewReader(file)
+	var source io.Reader = buffered
+	if header, _ := buffered.Peek(len(gzipMagic)); bytes.Equal(header, gzipMagic) {
+		zr, err := gzip.NewReader(buffered)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to decompress %s: %w", input, err)
+		}
+		source = zr
+	}
+
+	switch format {
+	case constants.ExportFormatJSONL:
+		return &jsonlReader{file: file, reader: bufio.NewReader(source)}, nil
+	case constants.ExportFormatJSON:
+		return &jsonArrayReader{file: file, decoder: json.NewDecoder(source)}, nil
+	case constants.ExportFormatCSV:
+		return &csvReader{file: file, reader: csv.NewReader(source)}, nil
+	default:
+		file.Close()
+		return nil, fmt.Errorf("unsupported format: %s. Supported: %s", format, strings.Join(exportFormats(), ", "))
+	}
+}
+
+// jsonlReader reads one JSON record per line, skipping blank lines
+type jsonlReader struct {
+	file   *os.File
+	reader *bufio.Reader
+	line   int
+}
+
+func (r *jsonlReader) Next() (MessageRecord, int, error) {
+	for {
+		content, err := r.reader.ReadBytes('\n')
+		if len(content) == 0 && err != nil {
+			return MessageRecord{}, r.line, err
+		}
+		r.line++
+		content = bytes.TrimSpace(content)
+		if len(content) == 0 {
+			continue
+		}
+
+		var record MessageRecord
+		if err := json.Unmarshal(content, &record); err != nil {
+			return MessageRecord{}, r.line, &LineError{Line: r.line, Err: err}
+		}
+		return record, r.line, nil
+	}
+}
+
+func (r *jsonlReader) Close() error {
+	return r.file.Close()
+}
+
+// jsonArrayReader reads the records of a JSON array one at a time
+type jsonArrayReader struct {
+	file    *os.File
+	decoder *json.Decoder
+	started bool
+	index   int
+}
+
+func (r *jsonArrayReader) Next() (MessageRecord, int, error) {
+	if !r.started {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return MessageRecord{}, 0, fmt.Errorf("failed to read JSON array: %w", err)
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return MessageRecord{}, 0, fmt.Errorf("expected a JSON array of records")
+		}
+		r.started = true
+	}
+	if !r.decoder.More() {
+		return MessageRecord{}, r.index, io.EOF
+	}
+
+	r.index++
+	var record MessageRecord
+	if err := r.decoder.Decode(&record); err != nil {
+		// The decoder cannot resynchronize after malformed JSON, so this is fatal
+		return MessageRecord{}, r.index, fmt.Errorf("record %d: %w", r.index, err)
+	}
+	return record, r.index, nil
+}
+
+func (r *jsonArrayReader) Close() error {
+	return r.file.Close()
+}
+
+// csvReader reads rows written by csvEncoder
+type csvReader struct {
+	file    *os.File
+	reader  *csv.Reader
+	started bool
+}
+
+func (r *csvReader) Next() (MessageRecord, int, error) {
+	if !r.started {
+		header, err := r.reader.Read()
+		if err != nil {
+			return MessageRecord{}, 0, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		if strings.Join(header, ",") != strings.Join(csvHeader, ",") {
+			return MessageRecord{}, 1, fmt.Errorf("unexpected CSV header %q, expected %q", strings.Join(header, ","), strings.Join(csvHeader, ","))
+		}
+		r.reader.FieldsPerRecord = len(csvHeader)
+		r.started = true
+	}
+
+	row, err := r.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return MessageRecord{}, parseErr.StartLine, &LineError{Line: parseErr.StartLine, Err: parseErr.Err}
+		}
+		return MessageRecord{}, 0, err
+	}
+	line, _ := r.reader.FieldPos(0)
+
+	record := MessageRecord{ID: row[0], OrderingKey: row[2]}
+	if row[1] != "" {
+		if record.PublishTime, err = time.Parse(time.RFC3339Nano, row[1]); err != nil {
+			return MessageRecord{}, line, &LineError{Line: line, Err: fmt.Errorf("invalid publish_time: %w", err)}
+		}
+	}
+	if row[3] != "" && row[3] != "null" {
+		if err := json.Unmarshal([]byte(row[3]), &record.Attributes); err != nil {
+			return MessageRecord{}, line, &LineError{Line: line, Err: fmt.Errorf("invalid attributes: %w", err)}
+		}
+	}
+	if record.Data, err = base64.StdEncoding.DecodeString(row[4]); err != nil {
+		return MessageRecord{}, line, &LineError{Line: line, Err: fmt.Errorf("invalid data: %w", err)}
+	}
+	return record, line, nil
+}
+
+func (r *csvReader) Close() error {
+	return r.file.Close()
+}
+
+// rawDirReader reads the data and metadata files written by rawDirWriter, in name order
+type rawDirReader struct {
+	dir   string
+	names []string
+	index int
+}
+
+func newRawDirReader(dir string) (*rawDirReader, error) {
+	metadataFiles, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if metadataFiles == nil {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("failed to open input directory: %w", err)
+		}
+	}
+	sort.Strings(metadataFiles)
+
+	names := make([]string, 0, len(metadataFiles))
+	for _, path := range metadataFiles {
+		names = append(names, strings.TrimSuffix(filepath.Base(path), ".json"))
+	}
+	return &rawDirReader{dir: dir, names: names}, nil
+}
+
+func (r *rawDirReader) Next() (MessageRecord, int, error) {
+	if r.index >= len(r.names) {
+		return MessageRecord{}, r.index, io.EOF
+	}
+	name := r.names[r.index]
+	r.index++
+
+	var record MessageRecord
+	metadata, err := os.ReadFile(filepath.Join(r.dir, name+".json"))
+	if err != nil {
+		return MessageRecord{}, r.index, &LineError{Line: r.index, Err: err}
+	}
+	if err := json.Unmarshal(metadata, &record); err != nil {
+		return MessageRecord{}, r.index, &LineError{Line: r.index, Err: fmt.Errorf("invalid metadata in %s.json: %w", name, err)}
+	}
+
+	if record.Data, err = readDataFile(filepath.Join(r.dir, name+".data")); err != nil {
+		return MessageRecord{}, r.index, &LineError{Line: r.index, Err: err}
+	}
+	return record, r.index, nil
+}
+
+func (r *rawDirReader) Close() error { return nil }
+
+// readDataFile reads a raw data file, falling back to its gzip-compressed variant
+func readDataFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return data, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	file, err := os.Open(path + ".gz")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s.gz: %w", path, err)
+	}
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Cloud Monitoring metrics describing a subscription's backlog
+const (
+	metricUndeliveredMessages = "pubsub.googleapis.com/subscription/num_undelivered_messages"
+	metricOldestUnackedAge    = "pubsub.googleapis.com/subscription/oldest_unacked_message_age"
+)
+
+// metricsLookback is how far back to look for the latest metric sample, since
+// Pub/Sub metrics are written about once a minute and with some delay
+const metricsLookback = 10 * time.Minute
+
+// BacklogMetrics is the latest backlog size and age reported by Cloud Monitoring
+type BacklogMetrics struct {
+	UndeliveredMessages int64
+	OldestUnackedAge    time.Duration
+	SampledAt           time.Time
+}
+
+// FetchBacklogMetrics reads the latest backlog metrics of a subscription
+func FetchBacklogMetrics(ctx context.Context, subscription string) (*BacklogMetrics, error) {
+	project, err := resourceProject(subscription, collectionSubscriptions)
+	if err != nil {
+		return nil, err
+	}
+	subscriptionID := subscription[strings.LastIndex(subscription, "/")+1:]
+
+	opts, err := sourceCredentials.ClientOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client, err := monitoring.NewMetricClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create monitoring client: %w", err)
+	}
+	defer client.Close()
+
+	undelivered, sampledAt, err := latestMetricValue(ctx, client, project, subscriptionID, metricUndeliveredMessages)
+	if err != nil {
+		return nil, err
+	}
+	oldestAge, _, err := latestMetricValue(ctx, client, project, subscriptionID, metricOldestUnackedAge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BacklogMetrics{
+		UndeliveredMessages: undelivered,
+		OldestUnackedAge:    time.Duration(oldestAge) * time.Second,
+		SampledAt:           sampledAt,
+	}, nil
+}
+
+// latestMetricValue returns the most recent point of an INT64 subscription metric
+func latestMetricValue(ctx context.Context, client *monitoring.MetricClient, project, subscriptionID, metricType string) (int64, time.Time, error) {
+	now := time.Now()
+	it := client.ListTimeSeries(ctx, &monitoringpb.ListTimeSeriesRequest{
+		Name: "projects/" + project,
+		Filter: fmt.Sprintf(`metric.type = %q AND resource.type = "pubsub_subscription" AND resource.labels.subscription_id = %q`,
+			metricType, subscriptionID),
+		Interval: &monitoringpb.TimeInterval{
+			StartTime: timestamppb.New(now.Add(-metricsLookback)),
+			EndTime:   timestamppb.New(now),
+		},
+		View: monitoringpb.ListTimeSeriesRequest_FULL,
+	})
+
+	series, err := it.Next()
+	if errors.Is(err, iterator.Done) {
+		return 0, time.Time{}, fmt.Errorf("no %s data in the last %v", metricType, metricsLookback)
+	}
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to read %s: %w", metricType, err)
+	}
+	if len(series.Points) == 0 {
+		return 0, time.Time{}, fmt.Errorf("no %s data in the last %v", metricType, metricsLookback)
+	}
+
+	// Points are returned newest first
+	point := series.Points[0]
+	return point.GetValue().GetInt64Value(), point.GetInterval().GetEndTime().AsTime(), nil
+}
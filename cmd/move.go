@@ -8,32 +8,76 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"replay/constants"
 
 	"github.com/spf13/cobra"
 )
 
+// redriveCountAttribute counts how often a message has been moved by replay
+const redriveCountAttribute = "replay_redrive_count"
+
 // MoveHandler implements MessageHandler for automatic message moving
 type MoveHandler struct {
-	broker MessageBroker
-	logger *log.Logger
+	broker      MessageBroker
+	config      CommandConfig
+	auditor     Auditor
+	quarantine  MessagePublisher
+	leases      *LeaseKeeper
+	held        []*Message
+	quarantined int
+	logger      *log.Logger
 }
 
-// NewMoveHandler creates a new move handler
-func NewMoveHandler(broker MessageBroker) *MoveHandler {
+// NewMoveHandler creates a new move handler. auditor may be nil when moves are not audited.
+// Messages redriven more than config.MaxRedrives times are published to quarantine
+// instead, or left in the source if quarantine is nil.
+func NewMoveHandler(broker MessageBroker, config CommandConfig, auditor Auditor, quarantine MessagePublisher) *MoveHandler {
 	logger := log.New(os.Stdout, "", log.LstdFlags)
 	return &MoveHandler{
-		broker: broker,
-		logger: logger,
+		broker:     broker,
+		config:     config,
+		auditor:    auditor,
+		quarantine: quarantine,
+		logger:     logger,
 	}
 }
 
 // HandleMessage implements automatic message moving
 func (h *MoveHandler) HandleMessage(ctx context.Context, message *Message, msgNum int) (bool, error) {
 	h.logger.Printf("Pulled message %d", msgNum)
+
+	// Stop redriving messages that keep coming back
+	redrives := redriveCount(message)
+	if h.config.MaxRedrives > 0 && redrives >= h.config.MaxRedrives {
+		return h.stopRedriving(ctx, message, msgNum, redrives)
+	}
+
+	setAttributes := map[string]string{redriveCountAttribute: strconv.Itoa(redrives + 1)}
+	if h.config.DestinationType == constants.BrokerTypeGCPPubSubSubscription {
+		setAttributes[routeAttribute] = h.config.Destination
+	}
+
+	// Record the move before publishing, so a message whose move cannot be audited
+	// is neither published nor acknowledged
+	if h.auditor != nil {
+		entry := NewAuditEntry(message, ReviewActionMove, h.config.Source, h.config.Destination, "")
+		entry.SetAttributes = setAttributes
+		if err := h.auditor.Record(ctx, entry); err != nil {
+			h.logger.Printf("Failed to audit message %d: %v", msgNum, err)
+			return false, fmt.Errorf("failed to audit: %w", err)
+		}
+	}
+
 	h.logger.Printf("Publishing message %d", msgNum)
 
-	// Publish the message
-	if err := h.broker.Publish(ctx, message); err != nil {
+	// Publish the message with its redrive count incremented
+	if err := h.broker.Publish(ctx, withAttributes(message, setAttributes)); err != nil {
 		h.logger.Printf("Failed to publish message %d: %v", msgNum, err)
 		return false, fmt.Errorf("failed to publish: %w", err)
 	}
@@ -46,12 +90,128 @@ func (h *MoveHandler) HandleMessage(ctx context.Context, message *Message, msgNu
 	return true, nil
 }
 
+// stopRedriving quarantines a message that has been redriven too often, or leaves
+// it in the source until the end of the run if there is no quarantine
+func (h *MoveHandler) stopRedriving(ctx context.Context, message *Message, msgNum, redrives int) (bool, error) {
+	reason := fmt.Sprintf("already redriven %d times, --max-redrives is %d", redrives, h.config.MaxRedrives)
+	if h.quarantine == nil {
+		h.logger.Printf("Leaving message %d in the source: %s", msgNum, reason)
+		if h.leases == nil {
+			h.leases = NewLeaseKeeper(h.broker, constants.DefaultLeaseExtension)
+		}
+		h.leases.Hold(message.AckID)
+		h.held = append(h.held, message)
+		return false, nil
+	}
+
+	h.logger.Printf("Quarantining message %d: %s", msgNum, reason)
+	if h.auditor != nil {
+		entry := NewAuditEntry(message, ReviewActionMove, h.config.Source, h.config.Quarantine, reason)
+		if err := h.auditor.Record(ctx, entry); err != nil {
+			h.logger.Printf("Failed to audit message %d: %v", msgNum, err)
+			return false, fmt.Errorf("failed to audit: %w", err)
+		}
+	}
+	if err := h.quarantine.Publish(ctx, message); err != nil {
+		h.logger.Printf("Failed to quarantine message %d: %v", msgNum, err)
+		return false, fmt.Errorf("failed to quarantine: %w", err)
+	}
+	h.quarantined++
+	h.logger.Printf("Quarantined message %d to %s", msgNum, h.config.Quarantine)
+	return true, nil
+}
+
+// Flush releases the messages left in the source and reports what was not redriven
+func (h *MoveHandler) Flush(ctx context.Context) int {
+	if h.quarantined > 0 {
+		h.logger.Printf("Quarantined %d messages that reached --max-redrives %d", h.quarantined, h.config.MaxRedrives)
+	}
+	if h.leases == nil {
+		return 0
+	}
+
+	h.leases.Stop()
+	for _, message := range h.held {
+		if err := h.broker.Release(ctx, message.AckID); err != nil {
+			h.logger.Printf("Warning: failed to release message %s: %v", message.ID, err)
+		}
+	}
+	h.logger.Printf("Left %d messages that reached --max-redrives %d in the source", len(h.held), h.config.MaxRedrives)
+	h.held = nil
+	return 0
+}
+
+// redriveCount returns how often a message has been redriven, treating a missing
+// or malformed count as 0
+func redriveCount(message *Message) int {
+	count, err := strconv.Atoi(message.Attributes[redriveCountAttribute])
+	if err != nil || count < 0 {
+		return 0
+	}
+	return count
+}
+
+// withAttributes returns a copy of the message with attributes set, leaving the original untouched
+func withAttributes(message *Message, set map[string]string) *Message {
+	updated := *message
+	updated.Attributes = make(map[string]string, len(message.Attributes)+len(set))
+	for key, value := range message.Attributes {
+		updated.Attributes[key] = value
+	}
+	for key, value := range set {
+		updated.Attributes[key] = value
+	}
+	return &updated
+}
+
 // moveCmd represents the move command
 var moveCmd = &cobra.Command{
 	Use:   "move",
 	Short: "Moves messages from a source to a destination",
 	Long: `Moves messages from a source to a destination.
-Each message is polled, published, and acknowledged sequentially.`,
+Each message is polled, published, and acknowledged sequentially.
+
+With --audit-log and/or --audit-topic, every moved message is recorded as an NDJSON
+audit entry before it is published.
+
+With --snapshot-before, a snapshot of the source is taken before anything is moved,
+so the source can be rolled back with 'replay seek --to-snapshot'.
+
+With --follow, the source is not drained once but followed with streaming pull, moving
+messages as they arrive until the command is interrupted (Ctrl+C or SIGTERM) or --count
+messages have been moved. A health line is logged periodically, and while the
+destination is failing, failed messages are returned to the source and moving backs
+off exponentially up to --max-backoff-seconds.
+
+With --delay, only messages published at least that long ago are moved, so a redrive
+does not hit a downstream that is still recovering. Younger messages are left in the
+source, or with --follow waited for. With --not-before, the command waits until the
+given time before moving anything. See also 'replay schedule'.
+
+Every moved message gets a replay_redrive_count attribute, incremented from any
+existing value. With --max-redrives, messages that have already been redriven that
+many times are not moved again: they are published to --quarantine, or without it
+left in the source, so poison messages do not loop between the source and the
+destination forever.
+
+Before moving anything, the source subscription is looked up, and the move is refused
+if the destination or quarantine is the subscription's own topic or its dead-letter
+topic, or with a Kafka, AMQP, SQS, NATS or Redis source the source topic, queue or
+stream, since messages would then go round in circles. Use --allow-loop to move anyway.
+
+Besides Pub/Sub resources, sources and destinations of these types are supported:
+  KAFKA_TOPIC      kafka://<broker>[,<broker>...]/<topic>
+  AMQP_QUEUE       amqp://<user>@<host>/<vhost>?queue=<queue>
+  AMQP_EXCHANGE    amqp://<user>@<host>/<vhost>?exchange=<exchange>[&routing-key=<key>]
+  AWS_SQS_QUEUE    the queue URL
+  AWS_SNS_TOPIC    the topic ARN, as a destination only
+  NATS_JETSTREAM   nats://<server>[,<server>...]/<stream>, or /<subject> as a destination
+  REDIS_STREAM     redis://<host>:<port>/<stream>
+Kafka, NATS and Redis sources are read through a consumer group or durable consumer
+named replay, and attributes are carried as headers, message attributes or stream
+fields. The README lists the options and credentials of each type.
+Credentials, resources and permissions are checked first as by 'replay doctor',
+unless --skip-preflight is given.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.SetOutput(os.Stdout)
 
@@ -67,24 +227,55 @@ Each message is polled, published, and acknowledged sequentially.`,
 
 		ctx := context.Background()
 
-		// Create message broker
-		broker, err := NewPubSubBroker(ctx, config.Source, config.Destination)
-		if err != nil {
-			log.Fatalf("%v", err)
+		// Follow the source until interrupted
+		var follow *followSettings
+		if following, _ := cmd.Flags().GetBool("follow"); following {
+			healthSec, _ := cmd.Flags().GetInt("health-interval-seconds")
+			maxBackoffSec, _ := cmd.Flags().GetInt("max-backoff-seconds")
+			if healthSec <= 0 || maxBackoffSec <= 0 {
+				log.Printf("Error: --health-interval-seconds and --max-backoff-seconds must be positive")
+				return
+			}
+			if !isPubSubType(config.SourceType) {
+				log.Printf("Error: --follow is not supported with source type %s", config.SourceType)
+				return
+			}
+			if config.MaxRedrives > 0 && config.Quarantine == "" {
+				log.Printf("Error: --follow with --max-redrives requires --quarantine, as messages left in the source would be received again straight away")
+				return
+			}
+			follow = &followSettings{
+				healthInterval: time.Duration(healthSec) * time.Second,
+				maxBackoff:     time.Duration(maxBackoffSec) * time.Second,
+			}
+		}
+
+		// Stop on Ctrl+C when following, and let a topic source delete its temporary subscription
+		if follow != nil || config.SourceType == constants.BrokerTypeGCPPubSubTopic {
+			var stop context.CancelFunc
+			ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
 		}
-		defer broker.Close()
 
-		// Create handler and processor
-		handler := NewMoveHandler(broker)
-		processor := NewMessageProcessor(broker, *config, handler, os.Stdout)
+		// Hold off until the requested time
+		if !config.NotBefore.IsZero() && time.Now().Before(config.NotBefore) {
+			log.Printf("Waiting until %s before moving messages", config.NotBefore.Local().Format(time.RFC3339))
+			if err := sleepUntil(ctx, config.NotBefore); err != nil {
+				log.Printf("Stopped before moving any messages")
+				return
+			}
+		}
 
-		// Process messages
-		processed, err := processor.Process(ctx)
+		moved, err := runMove(ctx, *config, follow)
 		if err != nil {
-			log.Printf("Error during processing: %v", err)
+			log.Printf("Error: %v", err)
 		}
 
-		log.Printf("Move operation completed. Total messages moved: %d", processed)
+		if follow != nil {
+			log.Printf("Follow stopped. Total messages moved: %d", moved)
+		} else {
+			log.Printf("Move operation completed. Total messages moved: %d", moved)
+		}
 
 		// Ensure all log output is flushed before exiting
 		if f, ok := log.Writer().(*os.File); ok {
@@ -93,11 +284,203 @@ Each message is polled, published, and acknowledged sequentially.`,
 	},
 }
 
+// followSettings configure a move that follows its source instead of draining it
+type followSettings struct {
+	healthInterval time.Duration
+	maxBackoff     time.Duration
+}
+
+// runMove moves messages from config.Source to config.Destination and returns how
+// many were moved. Without follow it stops once the source is exhausted or
+// config.Count messages have been moved; with follow it runs until ctx is done.
+func runMove(ctx context.Context, config CommandConfig, follow *followSettings) (int, error) {
+	// Read a topic source through a temporary subscription
+	closeSource, err := openTopicSource(ctx, &config)
+	if err != nil {
+		return 0, err
+	}
+	defer closeSource()
+
+	// Check credentials, resources and permissions before anything is moved
+	if err := runPreflight(ctx, config); err != nil {
+		return 0, err
+	}
+
+	// Snapshot the source so the move can be rolled back
+	snapshot, err := takeSnapshotBefore(ctx, config)
+	if err != nil {
+		return 0, err
+	}
+	if snapshot != "" {
+		log.Printf("Created snapshot %s. To roll back, run: replay seek --source %s --to-snapshot %s", snapshot, config.Source, snapshot)
+	}
+
+	// Publish to the topic of a destination subscription, routing messages to it
+	topic := config.Destination
+	if config.DestinationType == constants.BrokerTypeGCPPubSubSubscription {
+		route, err := ResolveSubscriptionRoute(ctx, config.Destination)
+		if err != nil {
+			return 0, err
+		}
+		if slices.Contains(route.Fanout, config.Source) && !config.AllowLoop {
+			return 0, fmt.Errorf("destination %s shares its topic %s with the source subscription, so every moved message would be delivered to the source again. Use --allow-loop to move anyway",
+				route.Subscription, route.Topic)
+		}
+		if len(route.Fanout) > 0 {
+			if !config.AllowFanout {
+				return 0, fanoutError(route)
+			}
+			log.Printf("Warning: %v", fanoutError(route))
+		}
+		log.Printf("Routing messages to %s through its topic %s", route.Subscription, route.Topic)
+		topic = route.Topic
+	}
+
+	// Create message broker
+	broker, err := NewMessageBroker(ctx, config.SourceType, config.Source, config.DestinationType, topic)
+	if err != nil {
+		return 0, err
+	}
+	defer broker.Close()
+
+	// Refuse to move messages in a circle
+	if err := checkMoveLoop(ctx, broker, config); err != nil {
+		return 0, err
+	}
+
+	// Create auditor for moved messages
+	auditor, err := NewConfiguredAuditor(ctx, config)
+	if err != nil {
+		return 0, err
+	}
+	if auditor != nil {
+		defer auditor.Close()
+	}
+
+	// Create publisher for messages that exceeded --max-redrives
+	var quarantine MessagePublisher
+	if config.Quarantine != "" {
+		publisher, err := NewMessagePublisher(ctx, config.Quarantine)
+		if err != nil {
+			return 0, fmt.Errorf("quarantine: %w", err)
+		}
+		defer publisher.Close()
+		quarantine = publisher
+	}
+
+	// Create handler, leaving messages that are too young for later
+	var handler MessageHandler = NewMoveHandler(broker, config, auditor, quarantine)
+	if config.Delay > 0 {
+		handler = NewDelayHandler(handler, broker, config.Delay, follow != nil, os.Stdout)
+	}
+
+	if follow != nil {
+		log.Printf("Following %s, press Ctrl+C to stop", config.Source)
+		streaming, ok := broker.(StreamingBroker)
+		if !ok {
+			return 0, fmt.Errorf("--follow is not supported with source type %s", config.SourceType)
+		}
+		maxBackoff := follow.maxBackoff
+		follower := NewFollower(streaming, handler, config.Count, min(constants.DefaultMinBackoff, maxBackoff), maxBackoff)
+		return follower.Run(ctx, follow.healthInterval)
+	}
+	return NewMessageProcessor(broker, config, handler, os.Stdout).Process(ctx)
+}
+
+// checkMoveLoop returns an error if the destination or quarantine feeds the source,
+// or only logs a warning with config.AllowLoop. A subscription that cannot be
+// looked up is not checked.
+func checkMoveLoop(ctx context.Context, broker MessageBroker, config CommandConfig) error {
+	// A source with a destination of another kind is wrapped with its publisher
+	var messageSource MessageSource = broker
+	if split, ok := broker.(*splitBroker); ok {
+		messageSource = split.MessageSource
+	}
+
+	var loops []string
+	if config.SourceType == constants.BrokerTypeKafkaTopic {
+		source, _ := ParseKafkaAddress(config.Source, true)
+		loops = []string{
+			detectKafkaLoop(source, "destination", config.Destination),
+			detectKafkaLoop(source, "quarantine", config.Quarantine),
+		}
+	} else if config.SourceType == constants.BrokerTypeAMQPQueue {
+		source, _ := ParseAMQPAddress(config.Source, true)
+		loops = []string{
+			detectAMQPLoop(source, "destination", config.Destination),
+			detectAMQPLoop(source, "quarantine", config.Quarantine),
+		}
+	} else if config.SourceType == constants.BrokerTypeAWSSQSQueue {
+		source, _ := ParseSQSQueueURL(config.Source)
+		loops = []string{
+			detectSQSLoop(source, "destination", config.Destination),
+			detectSQSLoop(source, "quarantine", config.Quarantine),
+		}
+	} else if natsSource, ok := messageSource.(*NATSSource); ok {
+		loops = []string{
+			detectNATSLoop(natsSource, "destination", config.Destination),
+			detectNATSLoop(natsSource, "quarantine", config.Quarantine),
+		}
+	} else if config.SourceType == constants.BrokerTypeRedisStream {
+		source, _ := ParseRedisAddress(config.Source, true)
+		loops = []string{
+			detectRedisLoop(source, "destination", config.Destination),
+			detectRedisLoop(source, "quarantine", config.Quarantine),
+		}
+	} else if pubSub, ok := messageSource.(*PubSubBroker); ok {
+		subscription, err := pubSub.Subscription(ctx)
+		if err != nil {
+			log.Printf("Warning: could not look up %s to check for a loop: %v", config.Source, err)
+			return nil
+		}
+		loops = []string{
+			detectLoop(subscription, "destination", config.Destination),
+			detectLoop(subscription, "quarantine", config.Quarantine),
+		}
+	}
+	for _, loop := range loops {
+		switch {
+		case loop == "":
+		case config.AllowLoop:
+			log.Printf("Warning: %s", loop)
+		default:
+			return fmt.Errorf("%s. Use --allow-loop to move anyway", loop)
+		}
+	}
+	return nil
+}
+
+// sleepUntil blocks until t or until ctx is done, returning ctx's error in the latter case
+func sleepUntil(ctx context.Context, t time.Time) error {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(moveCmd)
 
 	// Add common flags
 	AddCommonFlags(moveCmd)
+	AddAuditFlags(moveCmd)
+	AddSnapshotFlags(moveCmd)
+	AddDelayFlags(moveCmd)
+	AddRedriveFlags(moveCmd)
+	moveCmd.Flags().Lookup("destination").Usage = subscriptionDestinationUsage
+	AddPreflightFlags(moveCmd)
+	AddTopicSourceFlags(moveCmd)
+	AddSourceTypes(moveCmd, constants.BrokerTypeKafkaTopic, constants.BrokerTypeAMQPQueue, constants.BrokerTypeAWSSQSQueue, constants.BrokerTypeNATSJetStream, constants.BrokerTypeRedisStream)
+	AddDestinationTypes(moveCmd, constants.BrokerTypeKafkaTopic, constants.BrokerTypeAMQPExchange, constants.BrokerTypeAWSSQSQueue, constants.BrokerTypeAWSSNSTopic, constants.BrokerTypeNATSJetStream, constants.BrokerTypeRedisStream)
+
+	// Add follow mode flags
+	moveCmd.Flags().Bool("follow", false, "Keep moving messages as they arrive until interrupted, using streaming pull")
+	moveCmd.Flags().Int("health-interval-seconds", int(constants.DefaultHealthInterval/time.Second), "Interval in seconds between health log lines with --follow")
+	moveCmd.Flags().Int("max-backoff-seconds", int(constants.DefaultMaxBackoff/time.Second), "Maximum delay in seconds between attempts while the destination is failing with --follow")
 
 	// Override the count flag description for move command
 	moveCmd.Flags().Lookup("count").Usage = "Number of messages to move (0 for unlimited, continues until source is exhausted)"
@@ -0,0 +1,433 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"replay/constants"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsURIScheme prefixes NATS streams and subjects, e.g. nats://<server>[,<server>...]/<stream>
+const natsURIScheme = "nats://"
+
+// defaultNATSConsumer is the durable consumer a source reads through unless consumer is given
+const defaultNATSConsumer = "replay"
+
+// natsCredentialsEnv holds the path of a NATS credentials file
+const natsCredentialsEnv = "NATS_CREDS"
+
+// natsSubjectAttribute carries the subject a message was published to
+const natsSubjectAttribute = "nats_subject"
+
+// natsNamePattern follows the NATS naming rules for streams and consumers
+var natsNamePattern = regexp.MustCompile(`^[^\s.*>/\\]{1,255}$`)
+
+// natsSubjectPattern matches subjects, with wildcards for source filters
+var natsSubjectPattern = regexp.MustCompile(`^[^\s.]+(\.[^\s.]+)*$`)
+
+// NATSAddress is a JetStream stream or subject given as
+// nats://[<user>[:<password>]@]<server>[,<server>...]/<stream or subject>?<options>.
+// Sources name a stream and take the options consumer and subject; destinations
+// name the subject to publish to, or none to publish to each message's own
+// subject; both take tls.
+type NATSAddress struct {
+	Servers []string
+	User    *url.Userinfo
+	TLS     bool
+	// Stream is the stream a source reads
+	Stream string
+	// Consumer is the durable pull consumer a source reads Stream through
+	Consumer string
+	// Subject filters a source's stream, or is the subject a destination publishes to
+	Subject string
+}
+
+// ParseNATSAddress parses a NATS source or destination
+func ParseNATSAddress(value string, source bool) (NATSAddress, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(value), natsURIScheme)
+	if !ok {
+		return NATSAddress{}, fmt.Errorf("invalid NATS address %q, expected %s<server>[,<server>...]/%s", value, natsURIScheme, natsPathUsage(source))
+	}
+	uri, err := url.Parse(natsURIScheme + rest)
+	if err != nil {
+		return NATSAddress{}, fmt.Errorf("invalid NATS address %q: %w", value, err)
+	}
+
+	address := NATSAddress{User: uri.User}
+	for _, server := range strings.Split(uri.Host, ",") {
+		if server == "" {
+			return NATSAddress{}, fmt.Errorf("invalid NATS address %q: a server address is empty", value)
+		}
+		address.Servers = append(address.Servers, server)
+	}
+	name := strings.TrimPrefix(uri.Path, "/")
+	if source {
+		if !natsNamePattern.MatchString(name) {
+			return NATSAddress{}, fmt.Errorf("invalid NATS stream name %q in %q", name, value)
+		}
+		address.Stream = name
+		address.Consumer = defaultNATSConsumer
+	} else if name != "" {
+		if !natsSubjectPattern.MatchString(name) || strings.ContainsAny(name, "*>") {
+			return NATSAddress{}, fmt.Errorf("invalid NATS subject %q in %q", name, value)
+		}
+		address.Subject = name
+	}
+
+	for key, values := range uri.Query() {
+		option := values[len(values)-1]
+		if !source && (key == "consumer" || key == "subject") {
+			return NATSAddress{}, fmt.Errorf("option %s of NATS address %q is not supported here", key, value)
+		}
+		switch key {
+		case "tls":
+			if address.TLS, err = strconv.ParseBool(option); err != nil {
+				return NATSAddress{}, fmt.Errorf("invalid tls %q in %q, expected true or false", option, value)
+			}
+		case "consumer":
+			if !natsNamePattern.MatchString(option) {
+				return NATSAddress{}, fmt.Errorf("invalid NATS consumer name %q in %q", option, value)
+			}
+			address.Consumer = option
+		case "subject":
+			if !natsSubjectPattern.MatchString(option) {
+				return NATSAddress{}, fmt.Errorf("invalid NATS subject filter %q in %q", option, value)
+			}
+			address.Subject = option
+		default:
+			return NATSAddress{}, fmt.Errorf("unknown option %s in NATS address %q", key, value)
+		}
+	}
+	return address, nil
+}
+
+// natsPathUsage describes the path of a source or destination
+func natsPathUsage(source bool) string {
+	if source {
+		return "<stream>[?consumer=<consumer>&subject=<filter>]"
+	}
+	return "[<subject>]"
+}
+
+// isNATSAddress reports whether a source or destination is a NATS stream or subject
+func isNATSAddress(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), natsURIScheme)
+}
+
+// connectNATS connects to the servers of an address, with the credentials file
+// in NATS_CREDS if set
+func connectNATS(address NATSAddress) (*nats.Conn, error) {
+	servers := make([]string, len(address.Servers))
+	for i, server := range address.Servers {
+		servers[i] = (&url.URL{Scheme: "nats", User: address.User, Host: server}).String()
+	}
+	options := []nats.Option{nats.Name("replay")}
+	if address.TLS {
+		options = append(options, nats.Secure(&tls.Config{}))
+	}
+	if credentials := os.Getenv(natsCredentialsEnv); credentials != "" {
+		options = append(options, nats.UserCredentials(credentials))
+	}
+	connection, err := nats.Connect(strings.Join(servers, ","), options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", strings.Join(address.Servers, ","), err)
+	}
+	return connection, nil
+}
+
+// NATSSource implements MessageBroker for consuming a JetStream stream through a
+// durable pull consumer, which is created if it does not exist. Acknowledging a
+// message acks it, extending its deadline marks it in progress, which restarts
+// the consumer's ack wait, and releasing it naks it for redelivery.
+type NATSSource struct {
+	connection *nats.Conn
+	consumer   jetstream.Consumer
+	address    NATSAddress
+	// subjects are the subjects the stream stores
+	subjects []string
+
+	mu       sync.Mutex
+	inFlight map[string]jetstream.Msg
+}
+
+// NewNATSSource connects to a stream and its consumer
+func NewNATSSource(ctx context.Context, source string) (*NATSSource, error) {
+	address, err := ParseNATSAddress(source, true)
+	if err != nil {
+		return nil, err
+	}
+	connection, err := connectNATS(address)
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(connection)
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	stream, err := js.Stream(ctx, address.Stream)
+	if err != nil {
+		connection.Close()
+		return nil, fmt.Errorf("failed to look up stream %s: %w", address.Stream, err)
+	}
+
+	consumer, err := stream.Consumer(ctx, address.Consumer)
+	if errors.Is(err, jetstream.ErrConsumerNotFound) {
+		consumer, err = stream.CreateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:       address.Consumer,
+			DeliverPolicy: jetstream.DeliverAllPolicy,
+			AckPolicy:     jetstream.AckExplicitPolicy,
+			AckWait:       constants.DefaultLeaseExtension,
+			FilterSubject: address.Subject,
+		})
+	}
+	if err != nil {
+		connection.Close()
+		return nil, fmt.Errorf("failed to set up consumer %s of stream %s: %w", address.Consumer, address.Stream, err)
+	}
+	if filter := consumer.CachedInfo().Config.FilterSubject; address.Subject != "" && filter != address.Subject {
+		connection.Close()
+		return nil, fmt.Errorf("consumer %s of stream %s filters %q, not %q", address.Consumer, address.Stream, filter, address.Subject)
+	}
+
+	return &NATSSource{
+		connection: connection,
+		consumer:   consumer,
+		address:    address,
+		subjects:   stream.CachedInfo().Config.Subjects,
+		inFlight:   make(map[string]jetstream.Msg),
+	}, nil
+}
+
+// Pull fetches a single message, waiting for up to the pull timeout, or returns
+// nil if none arrives
+func (s *NATSSource) Pull(ctx context.Context, config PullConfig) (*Message, error) {
+	wait := config.Timeout
+	if wait <= 0 {
+		wait = time.Second
+	}
+	msg, err := s.consumer.Next(jetstream.FetchMaxWait(wait))
+	if errors.Is(err, nats.ErrTimeout) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := msg.Metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := make(map[string]string, len(msg.Headers())+1)
+	for key, values := range msg.Headers() {
+		if len(values) > 0 {
+			attributes[key] = values[0]
+		}
+	}
+	attributes[natsSubjectAttribute] = msg.Subject()
+	id := msg.Headers().Get(jetstream.MsgIDHeader)
+	if id == "" {
+		id = fmt.Sprintf("%s/%d", metadata.Stream, metadata.Sequence.Stream)
+	}
+
+	ackID := msg.Reply()
+	s.mu.Lock()
+	s.inFlight[ackID] = msg
+	s.mu.Unlock()
+	return &Message{
+		ID:              id,
+		Data:            msg.Data(),
+		Attributes:      attributes,
+		PublishTime:     metadata.Timestamp,
+		AckID:           ackID,
+		DeliveryAttempt: int(metadata.NumDelivered),
+	}, nil
+}
+
+// message returns an in-flight message, forgetting it if done
+func (s *NATSSource) message(ackID string, done bool) (jetstream.Msg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg, ok := s.inFlight[ackID]
+	if !ok {
+		return nil, fmt.Errorf("unknown NATS acknowledgement ID %q", ackID)
+	}
+	if done {
+		delete(s.inFlight, ackID)
+	}
+	return msg, nil
+}
+
+// Acknowledge acks a message, waiting for the server to confirm it
+func (s *NATSSource) Acknowledge(ctx context.Context, ackID string) error {
+	msg, err := s.message(ackID, true)
+	if err != nil {
+		return err
+	}
+	return msg.DoubleAck(ctx)
+}
+
+// ExtendAckDeadline marks a message in progress, which restarts the consumer's
+// ack wait whatever the deadline
+func (s *NATSSource) ExtendAckDeadline(ctx context.Context, ackID string, deadline time.Duration) error {
+	msg, err := s.message(ackID, false)
+	if err != nil {
+		return err
+	}
+	return msg.InProgress()
+}
+
+// Release naks a message for immediate redelivery
+func (s *NATSSource) Release(ctx context.Context, ackID string) error {
+	msg, err := s.message(ackID, true)
+	if err != nil {
+		return err
+	}
+	return msg.Nak()
+}
+
+// Publish is not supported by a source
+func (s *NATSSource) Publish(ctx context.Context, message *Message) error {
+	return fmt.Errorf("no destination configured")
+}
+
+// Captures reports whether the source stream stores messages published to subject
+func (s *NATSSource) Captures(subject string) bool {
+	for _, pattern := range s.subjects {
+		if natsSubjectMatches(pattern, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// natsSubjectMatches reports whether subject matches pattern, which may contain
+// the wildcards * for one token and > for one or more trailing tokens
+func natsSubjectMatches(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+// Close naks the messages that were not acknowledged, so they are redelivered
+// straight away, and closes the connection once the naks are sent
+func (s *NATSSource) Close() error {
+	s.mu.Lock()
+	for _, msg := range s.inFlight {
+		_ = msg.Nak()
+	}
+	s.inFlight = map[string]jetstream.Msg{}
+	s.mu.Unlock()
+
+	err := s.connection.Flush()
+	s.connection.Close()
+	return err
+}
+
+// NATSPublisher implements MessagePublisher for JetStream. Attributes become
+// headers, and the Nats-Msg-Id is derived from the message ID and its redrive
+// count, so the stream drops a retried publish of the same redrive within its
+// duplicate window but stores a message that is redriven again.
+type NATSPublisher struct {
+	connection *nats.Conn
+	js         jetstream.JetStream
+	address    NATSAddress
+}
+
+// NewNATSPublisher connects to the servers of a destination
+func NewNATSPublisher(ctx context.Context, destination string) (*NATSPublisher, error) {
+	address, err := ParseNATSAddress(destination, false)
+	if err != nil {
+		return nil, err
+	}
+	connection, err := connectNATS(address)
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(connection)
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	if address.Subject != "" {
+		if _, err := js.StreamNameBySubject(ctx, address.Subject); err != nil {
+			connection.Close()
+			return nil, fmt.Errorf("no stream stores subject %s: %w", address.Subject, err)
+		}
+	}
+	return &NATSPublisher{connection: connection, js: js, address: address}, nil
+}
+
+// Publish publishes a message to the destination subject, or else to the
+// subject it was taken from, and waits for a stream to store it
+func (p *NATSPublisher) Publish(ctx context.Context, message *Message) error {
+	subject := p.address.Subject
+	if subject == "" {
+		subject = message.Attributes[natsSubjectAttribute]
+	}
+	if subject == "" {
+		return fmt.Errorf("message %s has no %s attribute, so the destination needs a subject", message.ID, natsSubjectAttribute)
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = message.Data
+	for key, value := range message.Attributes {
+		// Expectations of the original publisher would not hold for the copy
+		if key == natsSubjectAttribute || key == jetstream.MsgIDHeader || strings.HasPrefix(key, "Nats-Expected-") {
+			continue
+		}
+		msg.Header.Set(key, value)
+	}
+	msgID := natsRedriveMsgID(message)
+	ack, err := p.js.PublishMsg(ctx, msg, jetstream.WithMsgID(msgID))
+	if err != nil {
+		return err
+	}
+	if ack.Duplicate {
+		return fmt.Errorf("stream %s already stored message ID %s within its duplicate window", ack.Stream, msgID)
+	}
+	return nil
+}
+
+// natsRedriveSeparator separates the original message ID from the redrive count
+// in the Nats-Msg-Id of a redriven message
+const natsRedriveSeparator = ":redrive-"
+
+// natsRedriveMsgID returns the Nats-Msg-Id to publish a message under: its
+// original message ID, with any earlier redrive count replaced by the current one
+func natsRedriveMsgID(message *Message) string {
+	id := message.ID
+	if i := strings.LastIndex(id, natsRedriveSeparator); i >= 0 {
+		id = id[:i]
+	}
+	if count := message.Attributes[redriveCountAttribute]; count != "" {
+		id += natsRedriveSeparator + count
+	}
+	return id
+}
+
+// Close closes the connection
+func (p *NATSPublisher) Close() error {
+	p.connection.Close()
+	return nil
+}
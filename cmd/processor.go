@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"replay/constants"
 )
@@ -14,6 +15,34 @@ import (
 // ErrQuit is returned when the user chooses to quit
 var ErrQuit = errors.New("user quit")
 
+// ErrDeferred is returned when a handler has decided a message but holds on to it
+// and acknowledges it itself later. The message counts as processed.
+var ErrDeferred = errors.New("acknowledgement deferred")
+
+// UndoError is returned when the user undoes an earlier decision that has not been
+// committed yet. The processor presents that message again before the current one.
+type UndoError struct {
+	Message *Message
+	MsgNum  int
+}
+
+func (e *UndoError) Error() string {
+	return fmt.Sprintf("decision for message %d undone", e.MsgNum)
+}
+
+// Flusher is implemented by handlers that defer acknowledgements
+type Flusher interface {
+	// Flush commits all outstanding deferred decisions and returns how many deferred
+	// decisions failed to commit during the run
+	Flush(ctx context.Context) int
+}
+
+// queuedMessage is a message to present again after an undo
+type queuedMessage struct {
+	message *Message
+	msgNum  int
+}
+
 // MessageHandler defines how to handle each message
 type MessageHandler interface {
 	// HandleMessage processes a message and returns whether to acknowledge it
@@ -38,34 +67,56 @@ func NewMessageProcessor(broker MessageBroker, config CommandConfig, handler Mes
 	}
 }
 
-// Process runs the message processing loop
+// Process runs the message processing loop. A subscription source is processed
+// until it is exhausted; a topic source is live, so it is processed until ctx is
+// done or the count limit is reached.
 func (p *MessageProcessor) Process(ctx context.Context) (int, error) {
 	processed := 0
+	var requeued []queuedMessage
+	live := p.config.SourceType == constants.BrokerTypeGCPPubSubTopic
 
 	for {
-		// Pull a message
-		message, err := p.broker.Pull(ctx, PullConfig{
-			MaxMessages: constants.DefaultMaxMessages,
-			Timeout:     p.config.PollTimeout,
-		})
+		var message *Message
+		var msgNum int
+
+		if len(requeued) > 0 {
+			// Present undone messages again before pulling new ones
+			next := requeued[len(requeued)-1]
+			requeued = requeued[:len(requeued)-1]
+			message, msgNum = next.message, next.msgNum
+		} else {
+			// Pull a message
+			pulled, err := p.broker.Pull(ctx, PullConfig{
+				MaxMessages: constants.DefaultMaxMessages,
+				Timeout:     p.config.PollTimeout,
+			})
+
+			// Handle pull errors
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				if strings.Contains(err.Error(), "DeadlineExceeded") || errors.Is(err, context.DeadlineExceeded) {
+					if live {
+						continue
+					}
+					break
+				}
+				fmt.Fprintf(p.output, "Error during message pull: %v\n", err)
+				continue
+			}
 
-		// Handle pull errors
-		if err != nil {
-			if strings.Contains(err.Error(), "DeadlineExceeded") ||
-				errors.Is(err, context.DeadlineExceeded) {
+			// No more messages, unless more are published to a live source
+			if pulled == nil {
+				if live && waitForMessages(ctx) {
+					continue
+				}
 				break
 			}
-			fmt.Fprintf(p.output, "Error during message pull: %v\n", err)
-			continue
-		}
 
-		// No more messages
-		if message == nil {
-			break
+			message, msgNum = pulled, processed+1
 		}
 
-		msgNum := processed + 1
-
 		// Handle the message
 		acknowledge, err := p.handler.HandleMessage(ctx, message, msgNum)
 		if err != nil {
@@ -73,8 +124,21 @@ func (p *MessageProcessor) Process(ctx context.Context) (int, error) {
 			if errors.Is(err, ErrQuit) {
 				break
 			}
-			fmt.Fprintf(p.output, "Error handling message %d: %v\n", msgNum, err)
-			continue
+			// Present the undone message, then the current one again
+			var undo *UndoError
+			if errors.As(err, &undo) {
+				processed--
+				requeued = append(requeued,
+					queuedMessage{message: message, msgNum: msgNum},
+					queuedMessage{message: undo.Message, msgNum: undo.MsgNum})
+				continue
+			}
+			if !errors.Is(err, ErrDeferred) {
+				fmt.Fprintf(p.output, "Error handling message %d: %v\n", msgNum, err)
+				continue
+			}
+			// The handler acknowledges the message itself later
+			processed++
 		}
 
 		// Acknowledge if requested
@@ -91,9 +155,26 @@ func (p *MessageProcessor) Process(ctx context.Context) (int, error) {
 		}
 	}
 
+	// Commit decisions the handler is still holding on to, also when processing
+	// was stopped by cancelling ctx
+	if flusher, ok := p.handler.(Flusher); ok {
+		processed -= flusher.Flush(context.WithoutCancel(ctx))
+	}
+
 	return processed, nil
 }
 
+// waitForMessages pauses before pulling a live source again, and reports false
+// if ctx is done in the meantime
+func waitForMessages(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(constants.DefaultLivePollInterval):
+		return true
+	}
+}
+
 // FormatMessageData formats message data for display
 func FormatMessageData(data []byte, prettyJSON bool) string {
 	if !prettyJSON {
@@ -0,0 +1,317 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"replay/constants"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultPurgeReason is recorded in archives and audit entries when no --reason is given
+const defaultPurgeReason = "purged"
+
+// PurgeHandler implements MessageHandler by acknowledging every message that
+// matches the filter and is old enough, archiving and auditing it first when
+// configured. Other messages are held until the end and then released.
+type PurgeHandler struct {
+	broker    MessageBroker
+	config    CommandConfig
+	filter    *MessageFilter
+	olderThan time.Duration
+	reason    string
+	dryRun    bool
+	archiver  Archiver
+	auditor   Auditor
+	leases    *LeaseKeeper
+	seen      map[string]bool
+	held      []*Message
+	purged    *SampleStats
+	skipped   int
+	output    io.Writer
+}
+
+// NewPurgeHandler creates a new purge handler. A nil archiver or auditor disables
+// archiving or auditing; with dryRun set nothing is acknowledged.
+func NewPurgeHandler(broker MessageBroker, config CommandConfig, filter *MessageFilter, olderThan time.Duration, reason string, dryRun bool, archiver Archiver, auditor Auditor, output io.Writer) *PurgeHandler {
+	return &PurgeHandler{
+		broker:    broker,
+		config:    config,
+		filter:    filter,
+		olderThan: olderThan,
+		reason:    reason,
+		dryRun:    dryRun,
+		archiver:  archiver,
+		auditor:   auditor,
+		leases:    NewLeaseKeeper(broker, constants.DefaultLeaseExtension),
+		seen:      map[string]bool{},
+		purged:    NewSampleStats(),
+		output:    output,
+	}
+}
+
+// HandleMessage acknowledges the message if it is selected for purging
+func (h *PurgeHandler) HandleMessage(ctx context.Context, message *Message, msgNum int) (bool, error) {
+	duplicate := h.seen[message.ID]
+	h.seen[message.ID] = true
+	if duplicate || !h.selects(message) {
+		if !duplicate {
+			h.skipped++
+		}
+		h.hold(message)
+		return false, nil
+	}
+
+	if h.dryRun {
+		h.purged.Add(message)
+		h.hold(message)
+		return false, ErrDeferred
+	}
+
+	if h.archiver != nil {
+		record := NewArchiveRecord(message, ReviewActionDiscard, h.config.Source, h.reason)
+		if err := h.archiver.Archive(ctx, record); err != nil {
+			h.hold(message)
+			return false, fmt.Errorf("failed to archive message %s, leaving it unacknowledged: %w", message.ID, err)
+		}
+	}
+	if h.auditor != nil {
+		entry := NewAuditEntry(message, ReviewActionDiscard, h.config.Source, "", h.reason)
+		if err := h.auditor.Record(ctx, entry); err != nil {
+			h.hold(message)
+			return false, fmt.Errorf("failed to audit message %s, leaving it unacknowledged: %w", message.ID, err)
+		}
+	}
+
+	h.purged.Add(message)
+	if h.purged.Sampled%constants.DefaultProgressInterval == 0 {
+		fmt.Fprintf(h.output, "Purged %d messages so far\n", h.purged.Sampled)
+	}
+	return true, nil
+}
+
+// selects reports whether the message matches the filter and is old enough
+func (h *PurgeHandler) selects(message *Message) bool {
+	if h.olderThan > 0 && time.Since(message.PublishTime) < h.olderThan {
+		return false
+	}
+	return h.filter.Matches(message)
+}
+
+// hold keeps a message that is not purged leased until the end of the run,
+// so it is not pulled again
+func (h *PurgeHandler) hold(message *Message) {
+	h.leases.Hold(message.AckID)
+	h.held = append(h.held, message)
+}
+
+// Flush releases every message that was not purged
+func (h *PurgeHandler) Flush(ctx context.Context) int {
+	h.leases.Stop()
+	for _, message := range h.held {
+		if err := h.broker.Release(ctx, message.AckID); err != nil {
+			fmt.Fprintf(h.output, "Warning: failed to release message %s: %v\n", message.ID, err)
+		}
+	}
+	h.held = nil
+	return 0
+}
+
+// WriteSummary prints what was purged
+func (h *PurgeHandler) WriteSummary(w io.Writer) {
+	verb := "Purged"
+	if h.dryRun {
+		verb = "Would purge"
+	}
+	fmt.Fprintf(w, "\n%s %d messages, kept %d\n", verb, h.purged.Sampled, h.skipped)
+	if h.purged.Sampled > 0 {
+		fmt.Fprintln(w)
+		h.purged.Write(w, constants.DefaultStatsTopValues)
+	}
+}
+
+// parseAge parses a duration such as 90m, 36h or 7d
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q, expected e.g. 90m, 36h or 7d", value)
+	}
+	return age, nil
+}
+
+// confirmPurge asks the user to type the subscription name, accepting either its
+// short or its full resource name
+func confirmPurge(input io.Reader, output io.Writer, subscription string) bool {
+	shortName := subscription[strings.LastIndex(subscription, "/")+1:]
+	fmt.Fprintf(output, "Type the subscription name (%s) to confirm: ", shortName)
+	answer, _ := bufio.NewReader(input).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	return answer == shortName || answer == subscription
+}
+
+// purgeCmd represents the purge command
+var purgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Acknowledges messages in a source without processing them",
+	Long: `Purges messages from a source by acknowledging them.
+
+Use --attribute, --jsonpath and --pattern to purge only matching messages, and
+--older-than to purge only messages published at least that long ago. Messages that
+are not purged are released back to the source at the end of the run.
+
+With --archive-type and --archive, every message is archived before it is
+acknowledged, and with --audit-log and/or --audit-topic it is recorded in the audit
+trail. A message that cannot be archived or audited is left unacknowledged.
+
+With --snapshot-before, a snapshot of the source is taken before anything is purged,
+so the source can be rolled back with 'replay seek --to-snapshot'.
+
+Purging cannot otherwise be undone, so the subscription name has to be typed to confirm, or
+passed with --confirm for non-interactive use. Use --dry-run to see what would be
+purged without acknowledging anything.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Parse and validate configuration
+		config, err := ParseCommandConfig(cmd)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		pattern, _ := cmd.Flags().GetString("pattern")
+		filter, err := parseMessageFilter(cmd, pattern)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		var olderThan time.Duration
+		if value, _ := cmd.Flags().GetString("older-than"); value != "" {
+			if olderThan, err = parseAge(value); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
+		reason, _ := cmd.Flags().GetString("reason")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		confirm, _ := cmd.Flags().GetString("confirm")
+
+		// Describe what is about to happen
+		description := filter.String()
+		if olderThan > 0 {
+			description += fmt.Sprintf(" published more than %v ago", olderThan)
+		}
+		fmt.Printf("Purging %s from %s\n", description, config.Source)
+		if config.ArchiveType != "" {
+			fmt.Printf("Messages are archived to %s before they are acknowledged\n", config.Archive)
+		} else if !dryRun {
+			fmt.Println("WARNING: purged messages are acknowledged and cannot be recovered")
+		}
+
+		// Require the subscription name unless this is a dry run
+		if !dryRun {
+			confirmed := false
+			if confirm != "" {
+				confirmed = confirmPurge(strings.NewReader(confirm), io.Discard, config.Source)
+			} else {
+				confirmed = confirmPurge(os.Stdin, os.Stdout, config.Source)
+			}
+			if !confirmed {
+				fmt.Println("Subscription name does not match. Nothing was purged.")
+				return
+			}
+		}
+
+		ctx := context.Background()
+
+		// Snapshot the source so the purge can be rolled back
+		if !dryRun {
+			snapshot, err := takeSnapshotBefore(ctx, *config)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			if snapshot != "" {
+				fmt.Printf("Created snapshot %s. To roll back, run: replay seek --source %s --to-snapshot %s\n", snapshot, config.Source, snapshot)
+			}
+		}
+
+		// Create message broker
+		broker, err := NewPubSubBroker(ctx, config.Source, "")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		defer broker.Close()
+
+		// Create archiver for purged messages
+		var archiver Archiver
+		if config.ArchiveType != "" && !dryRun {
+			archiver, err = NewArchiver(ctx, config.ArchiveType, config.Archive)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			defer archiver.Close()
+		}
+
+		// Create auditor for purged messages
+		var auditor Auditor
+		if !dryRun {
+			auditor, err = NewConfiguredAuditor(ctx, *config)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			if auditor != nil {
+				defer auditor.Close()
+			}
+		}
+
+		// Create handler and processor
+		handler := NewPurgeHandler(broker, *config, filter, olderThan, reason, dryRun, archiver, auditor, os.Stdout)
+		processor := NewMessageProcessor(broker, *config, handler, os.Stdout)
+		if _, err := processor.Process(ctx); err != nil {
+			fmt.Printf("Error during processing: %v\n", err)
+		}
+
+		handler.WriteSummary(os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(purgeCmd)
+
+	// Add source flags
+	AddSourceFlags(purgeCmd)
+	purgeCmd.Flags().Lookup("count").Usage = "Maximum number of messages to purge (0 for all matching messages)"
+
+	// Add selection flags
+	AddFilterFlags(purgeCmd)
+	purgeCmd.Flags().String("pattern", "", "Purge only messages whose data matches this regular expression")
+	purgeCmd.Flags().String("older-than", "", "Purge only messages published longer ago than this, e.g. 90m, 36h or 7d")
+
+	// Add safety flags
+	purgeCmd.Flags().String("confirm", "", "Subscription name to confirm the purge without prompting")
+	purgeCmd.Flags().Bool("dry-run", false, "Report what would be purged without acknowledging anything")
+	purgeCmd.Flags().String("reason", defaultPurgeReason, "Reason recorded in the archive and audit trail")
+
+	// Add archive and audit flags
+	AddArchiveFlags(purgeCmd)
+	AddAuditFlags(purgeCmd)
+	AddSnapshotFlags(purgeCmd)
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import "time"
+
+// MessageRecord is the serialized form of a message written to local files
+type MessageRecord struct {
+	ID          string            `json:"id,omitempty"`
+	Data        []byte            `json:"data,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	PublishTime time.Time         `json:"publish_time"`
+	OrderingKey string            `json:"ordering_key,omitempty"`
+}
+
+// NewMessageRecord captures the data and metadata of a message
+func NewMessageRecord(message *Message) MessageRecord {
+	return MessageRecord{
+		ID:          message.ID,
+		Data:        message.Data,
+		Attributes:  message.Attributes,
+		PublishTime: message.PublishTime,
+		OrderingKey: message.OrderingKey,
+	}
+}
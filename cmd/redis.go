@@ -0,0 +1,494 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"replay/constants"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis URI schemes, e.g. redis://<host>:<port>/<stream>, with rediss:// for TLS
+const (
+	redisURIScheme  = "redis://"
+	redissURIScheme = "rediss://"
+)
+
+// Defaults for the consumer group and consumer a source reads through, and the
+// field holding message data
+const (
+	defaultRedisGroup     = "replay"
+	defaultRedisConsumer  = "replay"
+	defaultRedisDataField = "data"
+)
+
+// redisPasswordEnv holds the password for Redis URIs that do not give one
+const redisPasswordEnv = "REDIS_PASSWORD"
+
+// RedisAddress is a Redis stream given as redis://[<user>[:<password>]@]<host>[:<port>]/<stream>?<options>,
+// or rediss:// for TLS. Sources take the options group, consumer, min-idle and
+// pending-only; both take db and data-field.
+type RedisAddress struct {
+	Host   string
+	User   *url.Userinfo
+	TLS    bool
+	DB     int
+	Stream string
+	// DataField is the entry field holding message data; the other fields are attributes
+	DataField string
+	// Group and Consumer are the consumer group a source reads through and its member
+	Group    string
+	Consumer string
+	// MinIdle is how long a pending entry must be idle before a source claims it
+	MinIdle time.Duration
+	// PendingOnly limits a source to the group's pending entries
+	PendingOnly bool
+}
+
+// ParseRedisAddress parses a Redis source or destination
+func ParseRedisAddress(value string, source bool) (RedisAddress, error) {
+	value = strings.TrimSpace(value)
+	if !isRedisAddress(value) {
+		return RedisAddress{}, fmt.Errorf("invalid Redis stream %q, expected %s<host>[:<port>]/<stream>", value, redisURIScheme)
+	}
+	uri, err := url.Parse(value)
+	if err != nil {
+		return RedisAddress{}, fmt.Errorf("invalid Redis stream %q: %w", value, err)
+	}
+
+	address := RedisAddress{
+		Host:      uri.Host,
+		User:      uri.User,
+		TLS:       uri.Scheme == "rediss",
+		Stream:    strings.TrimPrefix(uri.Path, "/"),
+		DataField: defaultRedisDataField,
+		Group:     defaultRedisGroup,
+		Consumer:  defaultRedisConsumer,
+		MinIdle:   constants.DefaultLeaseExtension,
+	}
+	if uri.Hostname() == "" {
+		return RedisAddress{}, fmt.Errorf("invalid Redis stream %q: the host is empty", value)
+	}
+	if uri.Port() == "" {
+		address.Host = net.JoinHostPort(uri.Hostname(), "6379")
+	}
+	if address.Stream == "" {
+		return RedisAddress{}, fmt.Errorf("invalid Redis stream %q: the stream name is empty", value)
+	}
+
+	sourceOptions := []string{"group", "consumer", "min-idle", "pending-only"}
+	for key, values := range uri.Query() {
+		option := values[len(values)-1]
+		if !source && slices.Contains(sourceOptions, key) {
+			return RedisAddress{}, fmt.Errorf("option %s of Redis stream %q is not supported here", key, value)
+		}
+		switch key {
+		case "db":
+			if address.DB, err = strconv.Atoi(option); err != nil || address.DB < 0 {
+				return RedisAddress{}, fmt.Errorf("invalid db %q in %q", option, value)
+			}
+		case "data-field":
+			if option == "" {
+				return RedisAddress{}, fmt.Errorf("empty data-field in %q", value)
+			}
+			address.DataField = option
+		case "group", "consumer":
+			if option == "" {
+				return RedisAddress{}, fmt.Errorf("empty %s in %q", key, value)
+			}
+			if key == "group" {
+				address.Group = option
+			} else {
+				address.Consumer = option
+			}
+		case "min-idle":
+			if address.MinIdle, err = time.ParseDuration(option); err != nil || address.MinIdle < time.Millisecond {
+				return RedisAddress{}, fmt.Errorf("invalid min-idle %q in %q, expected a duration of at least 1ms", option, value)
+			}
+		case "pending-only":
+			if address.PendingOnly, err = strconv.ParseBool(option); err != nil {
+				return RedisAddress{}, fmt.Errorf("invalid pending-only %q in %q, expected true or false", option, value)
+			}
+		default:
+			return RedisAddress{}, fmt.Errorf("unknown option %s in Redis stream %q", key, value)
+		}
+	}
+	return address, nil
+}
+
+// sameStream reports whether two addresses name the same stream of the same database
+func (a RedisAddress) sameStream(other RedisAddress) bool {
+	return strings.EqualFold(a.Host, other.Host) && a.DB == other.DB && a.Stream == other.Stream
+}
+
+// isRedisAddress reports whether a source or destination is a Redis stream
+func isRedisAddress(value string) bool {
+	value = strings.TrimSpace(value)
+	return strings.HasPrefix(value, redisURIScheme) || strings.HasPrefix(value, redissURIScheme)
+}
+
+// connectRedis connects to the server of an address, taking the password from
+// REDIS_PASSWORD if the URI does not give one
+func connectRedis(ctx context.Context, address RedisAddress) (*redis.Client, error) {
+	options := &redis.Options{Addr: address.Host, DB: address.DB, ClientName: "replay"}
+	if address.User != nil {
+		options.Username = address.User.Username()
+		options.Password, _ = address.User.Password()
+	}
+	if options.Password == "" {
+		options.Password = os.Getenv(redisPasswordEnv)
+	}
+	if address.TLS {
+		host, _, _ := net.SplitHostPort(address.Host)
+		options.TLSConfig = &tls.Config{ServerName: host}
+	}
+
+	client := redis.NewClient(options)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis at %s: %w", address.Host, err)
+	}
+	return client, nil
+}
+
+// checkRedisStream fails unless the key of an address holds a stream
+func checkRedisStream(ctx context.Context, client *redis.Client, address RedisAddress) error {
+	keyType, err := client.Type(ctx, address.Stream).Result()
+	if err != nil {
+		return fmt.Errorf("failed to look up stream %s: %w", address.Stream, err)
+	}
+	if keyType != "stream" {
+		return fmt.Errorf("key %s of Redis at %s is not a stream (type %s)", address.Stream, address.Host, keyType)
+	}
+	return nil
+}
+
+// RedisSource implements MessageBroker for consuming a Redis stream through a
+// consumer group, which is created at the start of the stream if it does not
+// exist. Pending entries that have been idle for min-idle are claimed before new
+// entries are read. Acknowledging a message acks its entry, extending its
+// deadline claims it again, which resets its idle time, and releasing it marks
+// it idle so that it is claimed again straight away.
+type RedisSource struct {
+	client  *redis.Client
+	address RedisAddress
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+	// cursor is where the next claim of pending entries starts, and claiming is
+	// set until a sweep of the pending entries has found none left
+	cursor   string
+	claiming bool
+}
+
+// NewRedisSource connects to a stream and its consumer group
+func NewRedisSource(ctx context.Context, source string) (*RedisSource, error) {
+	address, err := ParseRedisAddress(source, true)
+	if err != nil {
+		return nil, err
+	}
+	client, err := connectRedis(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRedisStream(ctx, client, address); err != nil {
+		client.Close()
+		return nil, err
+	}
+	err = client.XGroupCreate(ctx, address.Stream, address.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		client.Close()
+		return nil, fmt.Errorf("failed to set up consumer group %s of stream %s: %w", address.Group, address.Stream, err)
+	}
+
+	return &RedisSource{
+		client:   client,
+		address:  address,
+		inFlight: make(map[string]bool),
+		cursor:   "0-0",
+		claiming: true,
+	}, nil
+}
+
+// Pull claims a pending entry, or else reads a new entry, waiting for up to the
+// pull timeout, or returns nil if none arrives
+func (s *RedisSource) Pull(ctx context.Context, config PullConfig) (*Message, error) {
+	entry, err := s.claim(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		return s.deliver(ctx, entry, true), nil
+	}
+	if s.address.PendingOnly {
+		return nil, nil
+	}
+
+	wait := config.Timeout
+	if wait <= 0 {
+		wait = time.Second
+	}
+	streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    s.address.Group,
+		Consumer: s.address.Consumer,
+		Streams:  []string{s.address.Stream, ">"},
+		Count:    1,
+		Block:    wait,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 || len(streams[0].Messages) == 0 {
+		return nil, nil
+	}
+	return s.deliver(ctx, &streams[0].Messages[0], false), nil
+}
+
+// claim claims the next pending entry that has been idle for min-idle and is
+// not already held, or returns nil once a sweep finds none
+func (s *RedisSource) claim(ctx context.Context) (*redis.XMessage, error) {
+	for {
+		s.mu.Lock()
+		claiming, cursor := s.claiming, s.cursor
+		s.mu.Unlock()
+		if !claiming {
+			return nil, nil
+		}
+
+		entries, next, err := s.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   s.address.Stream,
+			Group:    s.address.Group,
+			Consumer: s.address.Consumer,
+			MinIdle:  s.address.MinIdle,
+			Start:    cursor,
+			Count:    1,
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim pending entries of %s: %w", s.address.Stream, err)
+		}
+		s.mu.Lock()
+		s.cursor = next
+		if next == "0-0" {
+			s.claiming = false
+		}
+		s.mu.Unlock()
+
+		for i := range entries {
+			if s.held(entries[i].ID) {
+				continue
+			}
+			// Entries deleted from the stream have nothing left to move
+			if entries[i].Values == nil {
+				_ = s.client.XAck(ctx, s.address.Stream, s.address.Group, entries[i].ID).Err()
+				continue
+			}
+			return &entries[i], nil
+		}
+	}
+}
+
+// held reports whether an entry is already in flight
+func (s *RedisSource) held(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inFlight[id]
+}
+
+// deliver tracks an entry and converts it to a message, looking up the number of
+// deliveries of claimed entries
+func (s *RedisSource) deliver(ctx context.Context, entry *redis.XMessage, claimed bool) *Message {
+	message := &Message{
+		ID:              entry.ID,
+		Attributes:      make(map[string]string, len(entry.Values)),
+		AckID:           entry.ID,
+		DeliveryAttempt: 1,
+	}
+	for field, value := range entry.Values {
+		text := fmt.Sprint(value)
+		if field == s.address.DataField {
+			message.Data = []byte(text)
+		} else {
+			message.Attributes[field] = text
+		}
+	}
+	if milliseconds, _, ok := strings.Cut(entry.ID, "-"); ok {
+		if ms, err := strconv.ParseInt(milliseconds, 10, 64); err == nil {
+			message.PublishTime = time.UnixMilli(ms)
+		}
+	}
+	if claimed {
+		pending, err := s.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: s.address.Stream,
+			Group:  s.address.Group,
+			Start:  entry.ID,
+			End:    entry.ID,
+			Count:  1,
+		}).Result()
+		if err == nil && len(pending) == 1 {
+			message.DeliveryAttempt = int(pending[0].RetryCount)
+		}
+	}
+
+	s.mu.Lock()
+	s.inFlight[entry.ID] = true
+	s.mu.Unlock()
+	return message
+}
+
+// forget stops tracking an in-flight entry
+func (s *RedisSource) forget(ackID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.inFlight[ackID] {
+		return fmt.Errorf("unknown Redis stream entry %q", ackID)
+	}
+	delete(s.inFlight, ackID)
+	return nil
+}
+
+// Acknowledge acks an entry, removing it from the group's pending entries
+func (s *RedisSource) Acknowledge(ctx context.Context, ackID string) error {
+	if err := s.forget(ackID); err != nil {
+		return err
+	}
+	return s.client.XAck(ctx, s.address.Stream, s.address.Group, ackID).Err()
+}
+
+// ExtendAckDeadline claims an entry again, which resets its idle time so that
+// it is not claimed by others for another min-idle whatever the deadline
+func (s *RedisSource) ExtendAckDeadline(ctx context.Context, ackID string, deadline time.Duration) error {
+	if !s.held(ackID) {
+		return fmt.Errorf("unknown Redis stream entry %q", ackID)
+	}
+	return s.client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   s.address.Stream,
+		Group:    s.address.Group,
+		Consumer: s.address.Consumer,
+		Messages: []string{ackID},
+	}).Err()
+}
+
+// ExtendAckDeadlines claims the held entries among ackIDs again in one request
+func (s *RedisSource) ExtendAckDeadlines(ctx context.Context, ackIDs []string, deadline time.Duration) error {
+	held := slices.DeleteFunc(slices.Clone(ackIDs), func(ackID string) bool { return !s.held(ackID) })
+	if len(held) == 0 {
+		return nil
+	}
+	return s.client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   s.address.Stream,
+		Group:    s.address.Group,
+		Consumer: s.address.Consumer,
+		Messages: held,
+	}).Err()
+}
+
+// Release marks an entry as idle for min-idle, so that it is claimed again by
+// the next pull or by another consumer of the group
+func (s *RedisSource) Release(ctx context.Context, ackID string) error {
+	if err := s.forget(ackID); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.cursor, s.claiming = "0-0", true
+	s.mu.Unlock()
+	return s.markIdle(ctx, ackID)
+}
+
+// markIdle sets the idle time of an entry to min-idle
+func (s *RedisSource) markIdle(ctx context.Context, ackID string) error {
+	return s.client.Do(ctx, "XCLAIM", s.address.Stream, s.address.Group, s.address.Consumer, 0, ackID,
+		"IDLE", s.address.MinIdle.Milliseconds(), "JUSTID").Err()
+}
+
+// Publish is not supported by a source
+func (s *RedisSource) Publish(ctx context.Context, message *Message) error {
+	return fmt.Errorf("no destination configured")
+}
+
+// Close releases the entries that were not acknowledged, so they are claimed
+// again straight away, and closes the connection
+func (s *RedisSource) Close() error {
+	s.mu.Lock()
+	ackIDs := make([]string, 0, len(s.inFlight))
+	for ackID := range s.inFlight {
+		ackIDs = append(ackIDs, ackID)
+	}
+	s.inFlight = map[string]bool{}
+	s.mu.Unlock()
+
+	for _, ackID := range ackIDs {
+		_ = s.markIdle(context.Background(), ackID)
+	}
+	return s.client.Close()
+}
+
+// RedisPublisher implements MessagePublisher for Redis streams. Each message is
+// added as an entry with its data in the data field and its attributes as the
+// other fields.
+type RedisPublisher struct {
+	client  *redis.Client
+	address RedisAddress
+}
+
+// NewRedisPublisher connects to a destination stream, which must exist
+func NewRedisPublisher(ctx context.Context, destination string) (*RedisPublisher, error) {
+	address, err := ParseRedisAddress(destination, false)
+	if err != nil {
+		return nil, err
+	}
+	client, err := connectRedis(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRedisStream(ctx, client, address); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &RedisPublisher{client: client, address: address}, nil
+}
+
+// Publish adds a message to the stream
+func (p *RedisPublisher) Publish(ctx context.Context, message *Message) error {
+	keys := make([]string, 0, len(message.Attributes))
+	for key := range message.Attributes {
+		if key != p.address.DataField {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	values := make([]string, 0, 2*len(keys)+2)
+	values = append(values, p.address.DataField, string(message.Data))
+	for _, key := range keys {
+		values = append(values, key, message.Attributes[key])
+	}
+
+	err := p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream:     p.address.Stream,
+		NoMkStream: true,
+		Values:     values,
+	}).Err()
+	if errors.Is(err, redis.Nil) {
+		return fmt.Errorf("stream %s no longer exists", p.address.Stream)
+	}
+	return err
+}
+
+// Close closes the connection
+func (p *RedisPublisher) Close() error {
+	return p.client.Close()
+}
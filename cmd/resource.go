@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// Collections of Pub/Sub resources
+const (
+	collectionSubscriptions = "subscriptions"
+	collectionTopics        = "topics"
+	collectionSnapshots     = "snapshots"
+)
+
+// resourceURIScheme prefixes resource names given as URIs, e.g. pubsub://<project>/topics/<topic>
+const resourceURIScheme = "pubsub://"
+
+var (
+	// resourceIDPattern follows the Pub/Sub naming rules for subscriptions, topics and snapshots
+	resourceIDPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9\-_.~+%]{2,254}$`)
+	// projectIDPattern accepts project IDs, including domain-scoped ones such as example.com:project
+	projectIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9\-.:]*$`)
+
+	defaultProjectOnce sync.Once
+	defaultProjectName string
+)
+
+// ResourceName is a parsed Pub/Sub resource name such as projects/<project>/subscriptions/<id>
+type ResourceName struct {
+	Project    string
+	Collection string
+	ID         string
+}
+
+// String returns the full resource name
+func (r ResourceName) String() string {
+	return fmt.Sprintf("projects/%s/%s/%s", r.Project, r.Collection, r.ID)
+}
+
+// ParseResourceName parses a resource of the given collection. value is a full
+// resource name, a pubsub:// URI (pubsub://<project>/<collection>/<id>) or, if
+// project is not empty, a short ID within that project.
+func ParseResourceName(value, collection, project string) (ResourceName, error) {
+	kind := strings.TrimSuffix(collection, "s")
+	name := strings.TrimSpace(value)
+	if name == "" {
+		return ResourceName{}, fmt.Errorf("%s name is empty", kind)
+	}
+
+	if uri, ok := strings.CutPrefix(name, resourceURIScheme); ok {
+		name = uri
+		if !strings.HasPrefix(name, "projects/") {
+			name = "projects/" + name
+		}
+	}
+
+	var parsed ResourceName
+	parts := strings.Split(name, "/")
+	switch {
+	case len(parts) == 1:
+		if project == "" {
+			return ResourceName{}, fmt.Errorf("%s %q is a short name, so a project is required: use --project, set a default with 'gcloud config set project', or give the full name projects/<project>/%s/%s",
+				kind, value, collection, value)
+		}
+		parsed = ResourceName{Project: project, Collection: collection, ID: name}
+	case len(parts) == 4 && parts[0] == "projects":
+		parsed = ResourceName{Project: parts[1], Collection: parts[2], ID: parts[3]}
+	default:
+		return ResourceName{}, fmt.Errorf("invalid %s name %q, expected projects/<project>/%s/<id>, %s<project>/%s/<id> or a short name",
+			kind, value, collection, resourceURIScheme, collection)
+	}
+
+	if parsed.Collection != collection {
+		other := strings.TrimSuffix(parsed.Collection, "s")
+		return ResourceName{}, fmt.Errorf("%q is a %s, but a %s is expected here", value, other, kind)
+	}
+	if !projectIDPattern.MatchString(parsed.Project) {
+		return ResourceName{}, fmt.Errorf("invalid project %q in %s name %q", parsed.Project, kind, value)
+	}
+	if !resourceIDPattern.MatchString(parsed.ID) || strings.HasPrefix(parsed.ID, "goog") {
+		return ResourceName{}, fmt.Errorf("invalid %s ID %q: IDs are 3 to 255 characters, start with a letter, contain only letters, digits and - _ . ~ + %% and must not start with goog",
+			kind, parsed.ID)
+	}
+	return parsed, nil
+}
+
+// resourceProject returns the project of a full resource name of the given collection
+func resourceProject(resource, collection string) (string, error) {
+	parsed, err := ParseResourceName(resource, collection, "")
+	if err != nil {
+		return "", err
+	}
+	return parsed.Project, nil
+}
+
+// expandResourceName turns a resource name given on the command line into a full
+// resource name, resolving short names in the --project or default gcloud project
+func expandResourceName(cmd *cobra.Command, value, collection string) (string, error) {
+	project := ""
+	if !strings.Contains(value, "/") {
+		project = commandProject(cmd)
+	}
+	parsed, err := ParseResourceName(value, collection, project)
+	if err != nil {
+		return "", err
+	}
+	return parsed.String(), nil
+}
+
+// commandProject returns the --project flag, or the default project of the
+// active gcloud configuration if it is not set
+func commandProject(cmd *cobra.Command) string {
+	if flag := cmd.Flags().Lookup("project"); flag != nil && flag.Value.String() != "" {
+		return flag.Value.String()
+	}
+	defaultProjectOnce.Do(func() {
+		defaultProjectName = gcloudConfigValue("project")
+	})
+	return defaultProjectName
+}
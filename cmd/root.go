@@ -20,7 +20,12 @@ Users can iterate through each dead-lettered message and choose to discard or
 reprocess it by moving it to a different queue/topic.
 
 Currently supported message brokers:
-- GCP Pub/Sub`,
+- GCP Pub/Sub
+- Apache Kafka (move, schedule, dlr, export and import)
+- RabbitMQ and other AMQP 0-9-1 brokers (move, schedule, dlr, export and import)
+- AWS SQS, and SNS as a destination (move, schedule, dlr, export and import)
+- NATS JetStream (move, schedule, dlr, export and import)
+- Redis Streams (move, schedule, dlr, export and import)`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -51,6 +56,7 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.replay.yaml)")
+	rootCmd.PersistentFlags().String("project", "", "Project for short subscription, topic and snapshot names (default: the active gcloud project)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	pubsubpb "cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"google.golang.org/api/iterator"
+)
+
+// routeAttribute names the subscription a message moved to a subscription
+// destination is meant for. Other subscriptions of its topic exclude routed
+// messages if they were created with a filter such as
+// 'NOT attributes:replay_target_subscription'; filters cannot be changed later.
+const routeAttribute = "replay_target_subscription"
+
+// detachedTopic is the topic of a subscription whose topic was deleted
+const detachedTopic = "_deleted-topic_"
+
+// SubscriptionRoute delivers messages to a single subscription by publishing
+// them to its topic with routeAttribute set to the subscription
+type SubscriptionRoute struct {
+	Subscription string
+	Topic        string
+	// Fanout lists the other subscriptions of the topic that would also receive
+	// routed messages, because their filter does not reject them or could not be read
+	Fanout []string
+}
+
+// ResolveSubscriptionRoute looks up the topic of a subscription and which of the
+// topic's other subscriptions routed messages would fan out to
+func ResolveSubscriptionRoute(ctx context.Context, subscription string) (*SubscriptionRoute, error) {
+	project, err := resourceProject(subscription, collectionSubscriptions)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newPubSubClient(ctx, project, effectiveDestinationCredentials())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	defer client.Close()
+
+	target, err := client.SubscriptionAdminClient.GetSubscription(ctx, &pubsubpb.GetSubscriptionRequest{Subscription: subscription})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up destination subscription %s: %w", subscription, err)
+	}
+	if target.GetTopic() == detachedTopic {
+		return nil, fmt.Errorf("destination subscription %s is detached from its deleted topic", subscription)
+	}
+	routed := map[string]string{routeAttribute: subscription}
+	if subscriptionFilterRejects(target.GetFilter(), routed) {
+		return nil, fmt.Errorf("the filter %q of destination subscription %s rejects messages routed to it with %s, so it would receive nothing",
+			target.GetFilter(), subscription, routeAttribute)
+	}
+
+	route := &SubscriptionRoute{Subscription: subscription, Topic: target.GetTopic()}
+	it := client.TopicAdminClient.ListTopicSubscriptions(ctx, &pubsubpb.ListTopicSubscriptionsRequest{Topic: route.Topic})
+	for {
+		name, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the subscriptions of %s: %w", route.Topic, err)
+		}
+		if name == subscription {
+			continue
+		}
+		other, err := client.SubscriptionAdminClient.GetSubscription(ctx, &pubsubpb.GetSubscriptionRequest{Subscription: name})
+		if err != nil || !subscriptionFilterRejects(other.GetFilter(), routed) {
+			route.Fanout = append(route.Fanout, name)
+		}
+	}
+	return route, nil
+}
+
+// fanoutError explains which subscriptions besides the destination would receive routed messages
+func fanoutError(route *SubscriptionRoute) error {
+	return fmt.Errorf("moved messages are published to %s, so besides %s they would also be delivered to %s. "+
+		"As a subscription's filter cannot be changed, replace subscriptions that must not see redriven messages with new ones "+
+		"created with the filter 'NOT attributes:%s' and detach the old ones, or use --allow-fanout to move anyway",
+		route.Topic, route.Subscription, strings.Join(route.Fanout, ", "), routeAttribute)
+}
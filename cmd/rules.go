@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ReviewAction is a decision a reviewer can make about a message
+type ReviewAction string
+
+const (
+	ReviewActionMove    ReviewAction = "move"
+	ReviewActionDiscard ReviewAction = "discard"
+)
+
+// MatchKind identifies which part of a message a MatchRule compares
+type MatchKind string
+
+const (
+	MatchKindAttribute MatchKind = "attribute"
+	MatchKindDataField MatchKind = "data field"
+)
+
+// MatchRule applies an action automatically to every message whose attribute
+// or JSON data field equals the value captured from the message it was created on
+type MatchRule struct {
+	Action      ReviewAction
+	Destination string // named destination for move rules, empty for the default
+	Kind        MatchKind
+	Key         string   // attribute name for attribute rules
+	Path        []string // object keys leading to the field for data field rules
+	// Value is the attribute value as a string, or the JSON scalar of a data
+	// field as decoded: a string, json.Number, bool or nil
+	Value interface{}
+}
+
+// Matches reports whether the message carries the same value as the rule
+func (r MatchRule) Matches(message *Message) bool {
+	switch r.Kind {
+	case MatchKindAttribute:
+		value, ok := message.Attributes[r.Key]
+		return ok && value == r.Value
+	case MatchKindDataField:
+		value, ok := lookupDataField(message.Data, r.Path)
+		return ok && jsonScalarsEqual(value, r.Value)
+	default:
+		return false
+	}
+}
+
+// Equal reports whether two rules are the same
+func (r MatchRule) Equal(other MatchRule) bool {
+	return r.Action == other.Action && r.Destination == other.Destination && r.Kind == other.Kind &&
+		r.Key == other.Key && slices.Equal(r.Path, other.Path) && r.Value == other.Value
+}
+
+// Condition describes what the rule matches on, without the action
+func (r MatchRule) Condition() string {
+	if r.Kind == MatchKindDataField {
+		return fmt.Sprintf("%s %s = %s", r.Kind, formatFieldPath(r.Path), jsonScalarLiteral(r.Value))
+	}
+	return fmt.Sprintf("%s %s = %q", r.Kind, r.Key, r.Value)
+}
+
+// String describes the rule for confirmation prompts and logs
+func (r MatchRule) String() string {
+	if r.Destination != "" {
+		return fmt.Sprintf("%s all remaining messages where %s to %s", r.Action, r.Condition(), r.Destination)
+	}
+	return fmt.Sprintf("%s all remaining messages where %s", r.Action, r.Condition())
+}
+
+// matchCandidates lists the rules that can be built from a message: one per
+// attribute followed by one per scalar field of a JSON object payload
+func matchCandidates(message *Message, action ReviewAction, destination string) []MatchRule {
+	var candidates []MatchRule
+
+	keys := make([]string, 0, len(message.Attributes))
+	for key := range message.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		candidates = append(candidates, MatchRule{
+			Action:      action,
+			Destination: destination,
+			Kind:        MatchKindAttribute,
+			Key:         key,
+			Value:       message.Attributes[key],
+		})
+	}
+
+	var fields []dataField
+	if root, ok := decodeJSONData(message.Data); ok {
+		if object, ok := root.(map[string]interface{}); ok {
+			fields = flattenJSONFields(nil, object, fields)
+		}
+	}
+	slices.SortFunc(fields, func(a, b dataField) int { return slices.Compare(a.path, b.path) })
+	for _, field := range fields {
+		candidates = append(candidates, MatchRule{
+			Action:      action,
+			Destination: destination,
+			Kind:        MatchKindDataField,
+			Path:        field.path,
+			Value:       field.value,
+		})
+	}
+
+	return candidates
+}
+
+// lookupDataField resolves a path of object keys in a JSON object payload and
+// returns the scalar found there
+func lookupDataField(data []byte, path []string) (interface{}, bool) {
+	current, ok := decodeJSONData(data)
+	if !ok {
+		return nil, false
+	}
+	for _, key := range path {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	if _, ok := jsonScalarString(current); !ok {
+		return nil, false
+	}
+	return current, true
+}
+
+// decodeJSONData parses message data as JSON, keeping numbers in their original form
+func decodeJSONData(data []byte) (interface{}, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// dataField is a scalar of a JSON object payload and the keys leading to it
+type dataField struct {
+	path  []string
+	value interface{}
+}
+
+// flattenJSONFields appends the scalar values of a JSON object below prefix to fields
+func flattenJSONFields(prefix []string, object map[string]interface{}, fields []dataField) []dataField {
+	for key, value := range object {
+		path := append(slices.Clone(prefix), key)
+		if nested, ok := value.(map[string]interface{}); ok {
+			fields = flattenJSONFields(path, nested, fields)
+			continue
+		}
+		if _, ok := jsonScalarString(value); ok {
+			fields = append(fields, dataField{path: path, value: value})
+		}
+	}
+	return fields
+}
+
+// jsonScalarsEqual reports whether two decoded JSON scalars are equal, comparing
+// numbers by value so that 1 and 1.0 match but "1" and 1 do not
+func jsonScalarsEqual(a, b interface{}) bool {
+	if x, ok := a.(json.Number); ok {
+		y, ok := b.(json.Number)
+		return ok && (x == y || numbersEqual(x.String(), y.String()))
+	}
+	return a == b
+}
+
+// jsonScalarLiteral renders a decoded JSON scalar as JSON, so that strings are
+// quoted and told apart from numbers, booleans and null
+func jsonScalarLiteral(value interface{}) string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// formatFieldPath joins the keys of a data field path with dots, quoting keys
+// that contain dots or are empty so the path stays unambiguous
+func formatFieldPath(path []string) string {
+	parts := make([]string, len(path))
+	for i, key := range path {
+		if key == "" || strings.ContainsAny(key, ". \"\t\n") {
+			parts[i] = fmt.Sprintf("%q", key)
+		} else {
+			parts[i] = key
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// jsonScalarString renders a decoded JSON scalar; objects and arrays are rejected
+func jsonScalarString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return fmt.Sprintf("%t", v), true
+	case nil:
+		return "null", true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"replay/constants"
+
+	"github.com/spf13/cobra"
+)
+
+// ScheduleState is what a schedule persists between runs, so that it can be
+// stopped and started again without repeating or losing runs
+type ScheduleState struct {
+	Source       string    `json:"source"`
+	Destination  string    `json:"destination"`
+	Schedule     string    `json:"schedule"`
+	NextRun      time.Time `json:"next_run"`
+	Runs         int       `json:"runs"`
+	TotalMoved   int       `json:"total_moved"`
+	LastStarted  time.Time `json:"last_started"`
+	LastFinished time.Time `json:"last_finished"`
+	LastMoved    int       `json:"last_moved"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// LoadScheduleState reads a schedule's state, returning an empty state if the
+// file does not exist yet
+func LoadScheduleState(path string) (*ScheduleState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &ScheduleState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule state: %w", err)
+	}
+	var state ScheduleState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// Save writes the state, replacing the file atomically
+func (s *ScheduleState) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write schedule state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write schedule state: %w", err)
+	}
+	return nil
+}
+
+// matches reports whether the state belongs to the same schedule of the same move
+func (s *ScheduleState) matches(config CommandConfig, schedule string) bool {
+	return s.Source == config.Source && s.Destination == config.Destination && s.Schedule == schedule
+}
+
+// defaultScheduleStatePath keeps the state of each schedule in the user's config
+// directory, in a file named after the source and a hash of the source,
+// destination and schedule, so that schedules of sources with the same name in
+// different projects, or of one source to different destinations, do not share it
+func defaultScheduleStatePath(config CommandConfig, schedule string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find a directory for the schedule state, use --state-file: %w", err)
+	}
+	// Kafka topics are named without their options, and AMQP sources after their queue
+	source := config.Source
+	if address, err := ParseAMQPAddress(source, true); err == nil {
+		source = address.Queue
+	}
+	source, _, _ = strings.Cut(source, "?")
+	subscriptionID := source[strings.LastIndex(source, "/")+1:]
+	sum := sha256.Sum256([]byte(config.Source + "\n" + config.Destination + "\n" + schedule))
+	return filepath.Join(dir, "replay", fmt.Sprintf("schedule-%s-%x.json", subscriptionID, sum[:6])), nil
+}
+
+// scheduleCmd represents the schedule command
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Moves messages at a given time or on a cron schedule",
+	Long: `Runs a move at a given time with --at, or repeatedly on a cron schedule with --cron.
+
+Each run moves messages like 'replay move' until the source is exhausted or --count
+messages have been moved. Use --delay to move only messages published at least that
+long ago, so messages that just failed get time before they are redriven.
+
+--cron takes five fields (minute, hour, day of month, month, day of week) with *,
+lists, ranges and steps, e.g. '*/15 * * * *' or '0 9-17 * * 1-5', or one of
+@hourly, @daily, @weekly, @monthly and @yearly. Times are in local time.
+
+The schedule's state (next run, last run and totals) is kept in --state-file, by
+default in the user's config directory. When the command is started again with the
+same source, destination and schedule, it picks up where it left off: a run that
+was missed while it was stopped is run straight away, and a finished --at run is
+not repeated. The command runs until interrupted (Ctrl+C or SIGTERM), or with --at
+until the run is done.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(os.Stdout)
+
+		// Parse and validate configuration
+		config, err := ParseCommandConfig(cmd)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return
+		}
+		at, _ := cmd.Flags().GetString("at")
+		cronSpec, _ := cmd.Flags().GetString("cron")
+		if (at == "") == (cronSpec == "") {
+			log.Printf("Error: exactly one of --at and --cron is required")
+			return
+		}
+
+		var runAt time.Time
+		var cron *CronSchedule
+		schedule := ""
+		if at != "" {
+			if runAt, err = time.Parse(time.RFC3339, at); err != nil {
+				log.Printf("Error: invalid --at %q, expected RFC 3339 such as 2025-01-02T15:04:05Z", at)
+				return
+			}
+			schedule = "at " + runAt.UTC().Format(time.RFC3339)
+		} else {
+			if cron, err = ParseCronSchedule(cronSpec); err != nil {
+				log.Printf("Error: %v", err)
+				return
+			}
+			if cron.Next(time.Now()).IsZero() {
+				log.Printf("Error: cron spec %q never matches", cronSpec)
+				return
+			}
+			schedule = "cron " + cron.String()
+		}
+
+		statePath, _ := cmd.Flags().GetString("state-file")
+		if statePath == "" {
+			if statePath, err = defaultScheduleStatePath(*config, schedule); err != nil {
+				log.Printf("Error: %v", err)
+				return
+			}
+		}
+		state, err := LoadScheduleState(statePath)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return
+		}
+		if !state.matches(*config, schedule) {
+			state = &ScheduleState{Source: config.Source, Destination: config.Destination, Schedule: schedule}
+		}
+
+		// Work out the first run, catching up on a run missed while stopped
+		switch {
+		case cron == nil && state.Runs > 0:
+			log.Printf("Scheduled move already ran at %s, moving %d messages. Nothing to do.",
+				state.LastStarted.Local().Format(time.RFC3339), state.LastMoved)
+			return
+		case cron == nil:
+			state.NextRun = runAt
+		case state.NextRun.IsZero():
+			state.NextRun = cron.Next(time.Now())
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		log.Printf("Scheduled moving messages from %s to %s (%s), state in %s", config.Source, config.Destination, schedule, statePath)
+		for !state.NextRun.IsZero() {
+			if err := state.Save(statePath); err != nil {
+				log.Printf("Error: %v", err)
+				return
+			}
+
+			log.Printf("Next run at %s", state.NextRun.Local().Format(time.RFC3339))
+			if err := sleepUntil(ctx, state.NextRun); err != nil {
+				log.Printf("Schedule stopped after %d runs. Total messages moved: %d", state.Runs, state.TotalMoved)
+				return
+			}
+
+			state.LastStarted = time.Now()
+			log.Printf("Run %d started", state.Runs+1)
+			moved, err := runMove(ctx, *config, nil)
+			state.Runs++
+			state.LastFinished = time.Now()
+			state.LastMoved = moved
+			state.TotalMoved += moved
+			state.LastError = ""
+			if err != nil {
+				state.LastError = err.Error()
+				log.Printf("Error: %v", err)
+			}
+			log.Printf("Run %d completed. Messages moved: %d", state.Runs, moved)
+
+			if cron == nil {
+				state.NextRun = time.Time{}
+			} else {
+				state.NextRun = cron.Next(time.Now())
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		if err := state.Save(statePath); err != nil {
+			log.Printf("Error: %v", err)
+		}
+		if ctx.Err() != nil {
+			log.Printf("Schedule stopped after %d runs. Total messages moved: %d", state.Runs, state.TotalMoved)
+			return
+		}
+		log.Printf("Schedule finished after %d runs. Total messages moved: %d", state.Runs, state.TotalMoved)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+
+	// Add move flags
+	AddCommonFlags(scheduleCmd)
+	AddAuditFlags(scheduleCmd)
+	AddSnapshotFlags(scheduleCmd)
+	AddRedriveFlags(scheduleCmd)
+	scheduleCmd.Flags().Lookup("destination").Usage = subscriptionDestinationUsage
+	AddPreflightFlags(scheduleCmd)
+	AddSourceTypes(scheduleCmd, constants.BrokerTypeKafkaTopic, constants.BrokerTypeAMQPQueue, constants.BrokerTypeAWSSQSQueue, constants.BrokerTypeNATSJetStream, constants.BrokerTypeRedisStream)
+	AddDestinationTypes(scheduleCmd, constants.BrokerTypeKafkaTopic, constants.BrokerTypeAMQPExchange, constants.BrokerTypeAWSSQSQueue, constants.BrokerTypeAWSSNSTopic, constants.BrokerTypeNATSJetStream, constants.BrokerTypeRedisStream)
+	scheduleCmd.Flags().String("delay", "", "Move only messages published at least this long ago, e.g. 30m, 2h or 1d")
+	scheduleCmd.Flags().Lookup("count").Usage = "Maximum number of messages to move per run (0 for all messages)"
+
+	// Add schedule flags
+	scheduleCmd.Flags().String("at", "", "Run once at this time (RFC 3339)")
+	scheduleCmd.Flags().String("cron", "", "Run repeatedly on this cron schedule, e.g. '*/15 * * * *' or @hourly")
+	scheduleCmd.Flags().String("state-file", "", "File to keep the schedule's state in (default: schedule-<subscription>-<hash>.json in the user's config directory)")
+}
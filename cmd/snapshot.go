@@ -0,0 +1,330 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	pubsubpb "cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// snapshotLabel marks snapshots created by replay
+const snapshotLabel = "created-by"
+
+// SnapshotClient manages snapshots of subscriptions and seeks subscriptions
+// to a snapshot or a point in time
+type SnapshotClient struct {
+	client  *pubsub.Client
+	project string
+}
+
+// NewSnapshotClient creates a snapshot client for a project
+func NewSnapshotClient(ctx context.Context, project string) (*SnapshotClient, error) {
+	client, err := newPubSubClient(ctx, project, sourceCredentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	return &SnapshotClient{client: client, project: project}, nil
+}
+
+// Create snapshots the unacknowledged messages of a subscription
+func (c *SnapshotClient) Create(ctx context.Context, name, subscription string) (*pubsubpb.Snapshot, error) {
+	return c.client.SubscriptionAdminClient.CreateSnapshot(ctx, &pubsubpb.CreateSnapshotRequest{
+		Name:         snapshotResource(c.project, name),
+		Subscription: subscription,
+		Labels:       map[string]string{snapshotLabel: "replay"},
+	})
+}
+
+// List returns the snapshots of the project
+func (c *SnapshotClient) List(ctx context.Context) ([]*pubsubpb.Snapshot, error) {
+	it := c.client.SubscriptionAdminClient.ListSnapshots(ctx, &pubsubpb.ListSnapshotsRequest{
+		Project: "projects/" + c.project,
+	})
+	var snapshots []*pubsubpb.Snapshot
+	for {
+		snapshot, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return snapshots, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+}
+
+// Delete deletes a snapshot
+func (c *SnapshotClient) Delete(ctx context.Context, name string) error {
+	return c.client.SubscriptionAdminClient.DeleteSnapshot(ctx, &pubsubpb.DeleteSnapshotRequest{
+		Snapshot: snapshotResource(c.project, name),
+	})
+}
+
+// SeekToTime marks messages published before t as acknowledged and messages
+// published after it as unacknowledged
+func (c *SnapshotClient) SeekToTime(ctx context.Context, subscription string, t time.Time) error {
+	_, err := c.client.SubscriptionAdminClient.Seek(ctx, &pubsubpb.SeekRequest{
+		Subscription: subscription,
+		Target:       &pubsubpb.SeekRequest_Time{Time: timestamppb.New(t)},
+	})
+	return err
+}
+
+// SeekToSnapshot restores the acknowledgement state captured by a snapshot
+func (c *SnapshotClient) SeekToSnapshot(ctx context.Context, subscription, snapshot string) error {
+	_, err := c.client.SubscriptionAdminClient.Seek(ctx, &pubsubpb.SeekRequest{
+		Subscription: subscription,
+		Target:       &pubsubpb.SeekRequest_Snapshot{Snapshot: snapshotResource(c.project, snapshot)},
+	})
+	return err
+}
+
+// Close closes the client
+func (c *SnapshotClient) Close() error {
+	return c.client.Close()
+}
+
+// snapshotResource expands a short snapshot name to its full resource name
+func snapshotResource(project, name string) string {
+	if strings.HasPrefix(name, "projects/") {
+		return name
+	}
+	return fmt.Sprintf("projects/%s/snapshots/%s", project, name)
+}
+
+// defaultSnapshotName names a snapshot after its subscription and the current time
+func defaultSnapshotName(subscription string) string {
+	subscriptionID := subscription[strings.LastIndex(subscription, "/")+1:]
+	return fmt.Sprintf("replay-%s-%s", subscriptionID, time.Now().UTC().Format("20060102-150405"))
+}
+
+// takeSnapshotBefore snapshots the source subscription before it is consumed if
+// --snapshot-before was given, and returns the snapshot's name (empty otherwise)
+func takeSnapshotBefore(ctx context.Context, config CommandConfig) (string, error) {
+	if !config.SnapshotBefore {
+		return "", nil
+	}
+	project, err := resourceProject(config.Source, collectionSubscriptions)
+	if err != nil {
+		return "", err
+	}
+	client, err := NewSnapshotClient(ctx, project)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	snapshot, err := client.Create(ctx, defaultSnapshotName(config.Source), config.Source)
+	if err != nil {
+		return "", fmt.Errorf("failed to snapshot %s: %w", config.Source, err)
+	}
+	return snapshot.Name, nil
+}
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manages snapshots of subscriptions",
+	Long: `Creates, lists and deletes snapshots of subscriptions.
+
+A snapshot captures which messages of a subscription are unacknowledged, so that the
+subscription can later be rolled back to it with 'replay seek --to-snapshot'.
+Snapshots expire at the latest 7 days after they are created.`,
+}
+
+// snapshotCreateCmd represents the snapshot create command
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a snapshot of a subscription",
+	Run: func(cmd *cobra.Command, args []string) {
+		source, _ := cmd.Flags().GetString("source")
+		name, _ := cmd.Flags().GetString("name")
+
+		source, err := expandResourceName(cmd, source, collectionSubscriptions)
+		if err != nil {
+			fmt.Printf("Error: --source: %v\n", err)
+			return
+		}
+		if name == "" {
+			name = defaultSnapshotName(source)
+		}
+		project, _ := resourceProject(source, collectionSubscriptions)
+
+		ctx := context.Background()
+		client, err := NewSnapshotClient(ctx, project)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		defer client.Close()
+
+		snapshot, err := client.Create(ctx, name, source)
+		if err != nil {
+			fmt.Printf("Error: failed to create snapshot: %v\n", err)
+			return
+		}
+		fmt.Printf("Created snapshot %s of %s, expiring %s\n",
+			snapshot.Name, source, snapshot.ExpireTime.AsTime().Local().Format(time.RFC3339))
+	},
+}
+
+// snapshotListCmd represents the snapshot list command
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the snapshots of a project",
+	Run: func(cmd *cobra.Command, args []string) {
+		project := commandProject(cmd)
+		if project == "" {
+			fmt.Println("Error: --project is required, as there is no default gcloud project")
+			return
+		}
+
+		ctx := context.Background()
+		client, err := NewSnapshotClient(ctx, project)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		defer client.Close()
+
+		snapshots, err := client.List(ctx)
+		if err != nil {
+			fmt.Printf("Error: failed to list snapshots: %v\n", err)
+			return
+		}
+		if len(snapshots) == 0 {
+			fmt.Printf("No snapshots in project %s\n", project)
+			return
+		}
+		for _, snapshot := range snapshots {
+			fmt.Printf("%s\n  topic:   %s\n  expires: %s\n", snapshot.Name, snapshot.Topic,
+				snapshot.ExpireTime.AsTime().Local().Format(time.RFC3339))
+		}
+	},
+}
+
+// snapshotDeleteCmd represents the snapshot delete command
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Deletes a snapshot",
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		name, err := expandResourceName(cmd, name, collectionSnapshots)
+		if err != nil {
+			fmt.Printf("Error: --name: %v\n", err)
+			return
+		}
+		project, _ := resourceProject(name, collectionSnapshots)
+
+		ctx := context.Background()
+		client, err := NewSnapshotClient(ctx, project)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		defer client.Close()
+
+		if err := client.Delete(ctx, name); err != nil {
+			fmt.Printf("Error: failed to delete snapshot: %v\n", err)
+			return
+		}
+		fmt.Printf("Deleted snapshot %s\n", name)
+	},
+}
+
+// seekCmd represents the seek command
+var seekCmd = &cobra.Command{
+	Use:   "seek",
+	Short: "Seeks a subscription to a snapshot or a point in time",
+	Long: `Seeks a subscription to a snapshot or a point in time.
+
+With --to-snapshot, the subscription is rolled back to the acknowledgement state
+captured by the snapshot, e.g. to undo a bad move or purge run with --snapshot-before.
+
+With --to-time, messages published before that time are marked as acknowledged and
+messages published after it as unacknowledged. Messages are only redelivered if the
+subscription retains acknowledged messages. The time is either RFC 3339 or an age
+such as 90m, 36h or 7d.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		source, _ := cmd.Flags().GetString("source")
+		toSnapshot, _ := cmd.Flags().GetString("to-snapshot")
+		toTime, _ := cmd.Flags().GetString("to-time")
+		if (toSnapshot == "") == (toTime == "") {
+			fmt.Println("Error: exactly one of --to-snapshot and --to-time is required")
+			return
+		}
+
+		source, err := expandResourceName(cmd, source, collectionSubscriptions)
+		if err != nil {
+			fmt.Printf("Error: --source: %v\n", err)
+			return
+		}
+		project, _ := resourceProject(source, collectionSubscriptions)
+
+		ctx := context.Background()
+		client, err := NewSnapshotClient(ctx, project)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		defer client.Close()
+
+		if toSnapshot != "" {
+			// Short snapshot names are in the subscription's project
+			snapshot, err := ParseResourceName(toSnapshot, collectionSnapshots, project)
+			if err != nil {
+				fmt.Printf("Error: --to-snapshot: %v\n", err)
+				return
+			}
+			if err := client.SeekToSnapshot(ctx, source, snapshot.String()); err != nil {
+				fmt.Printf("Error: failed to seek: %v\n", err)
+				return
+			}
+			fmt.Printf("Seeked %s to snapshot %s\n", source, snapshot)
+			return
+		}
+
+		target, err := time.Parse(time.RFC3339, toTime)
+		if err != nil {
+			age, ageErr := parseAge(toTime)
+			if ageErr != nil {
+				fmt.Printf("Error: invalid --to-time %q, expected RFC 3339 or an age such as 90m, 36h or 7d\n", toTime)
+				return
+			}
+			target = time.Now().Add(-age)
+		}
+		if err := client.SeekToTime(ctx, source, target); err != nil {
+			fmt.Printf("Error: failed to seek: %v\n", err)
+			return
+		}
+		fmt.Printf("Seeked %s to %s\n", source, target.Local().Format(time.RFC3339))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotCreateCmd, snapshotListCmd, snapshotDeleteCmd)
+	rootCmd.AddCommand(seekCmd)
+
+	snapshotCreateCmd.Flags().String("source", "", "Subscription to snapshot (e.g. projects/<proj>/subscriptions/<sub>)")
+	snapshotCreateCmd.Flags().String("name", "", "Snapshot name (defaults to replay-<subscription>-<timestamp>)")
+	_ = snapshotCreateCmd.MarkFlagRequired("source")
+
+	snapshotDeleteCmd.Flags().String("name", "", "Snapshot name in --project, or full resource name (e.g. projects/<proj>/snapshots/<name>)")
+	_ = snapshotDeleteCmd.MarkFlagRequired("name")
+
+	seekCmd.Flags().String("source", "", "Subscription to seek (e.g. projects/<proj>/subscriptions/<sub>)")
+	seekCmd.Flags().String("to-snapshot", "", "Snapshot to seek to, as a name in the subscription's project or a full resource name")
+	seekCmd.Flags().String("to-time", "", "Time to seek to, as RFC 3339 or an age such as 90m, 36h or 7d")
+	_ = seekCmd.MarkFlagRequired("source")
+}
@@ -0,0 +1,296 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"replay/constants"
+
+	"github.com/spf13/cobra"
+)
+
+// Payload types reported by the stats command
+const (
+	payloadTypeEmpty  = "empty"
+	payloadTypeJSON   = "JSON"
+	payloadTypeText   = "text"
+	payloadTypeBinary = "binary"
+)
+
+// sizeBucket is an upper bound (exclusive) for the payload size histogram
+type sizeBucket struct {
+	label string
+	limit int
+}
+
+var sizeBuckets = []sizeBucket{
+	{"< 1 KiB", 1 << 10},
+	{"1-10 KiB", 10 << 10},
+	{"10-100 KiB", 100 << 10},
+	{"100 KiB-1 MiB", 1 << 20},
+	{">= 1 MiB", -1},
+}
+
+// SampleStats accumulates a breakdown of sampled messages
+type SampleStats struct {
+	Sampled          int
+	OldestPublish    time.Time
+	PayloadTypes     map[string]int
+	Sizes            []int // counts per sizeBuckets entry
+	DeliveryAttempts map[int]int
+	Attributes       map[string]map[string]int
+}
+
+// NewSampleStats creates an empty breakdown
+func NewSampleStats() *SampleStats {
+	return &SampleStats{
+		PayloadTypes:     map[string]int{},
+		Sizes:            make([]int, len(sizeBuckets)),
+		DeliveryAttempts: map[int]int{},
+		Attributes:       map[string]map[string]int{},
+	}
+}
+
+// Add records a sampled message
+func (s *SampleStats) Add(message *Message) {
+	s.Sampled++
+	if !message.PublishTime.IsZero() && (s.OldestPublish.IsZero() || message.PublishTime.Before(s.OldestPublish)) {
+		s.OldestPublish = message.PublishTime
+	}
+	s.PayloadTypes[payloadType(message.Data)]++
+	for i, bucket := range sizeBuckets {
+		if bucket.limit < 0 || len(message.Data) < bucket.limit {
+			s.Sizes[i]++
+			break
+		}
+	}
+	s.DeliveryAttempts[message.DeliveryAttempt]++
+	for key, value := range message.Attributes {
+		if s.Attributes[key] == nil {
+			s.Attributes[key] = map[string]int{}
+		}
+		s.Attributes[key][value]++
+	}
+}
+
+// Write prints the breakdown of a non-empty sample, listing at most topValues values per attribute
+func (s *SampleStats) Write(w io.Writer, topValues int) {
+	if s.Sampled == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Oldest message age: %v\n", time.Since(s.OldestPublish).Round(time.Second))
+
+	fmt.Fprintln(w, "\nPayload types:")
+	for _, name := range []string{payloadTypeJSON, payloadTypeText, payloadTypeBinary, payloadTypeEmpty} {
+		if count := s.PayloadTypes[name]; count > 0 {
+			fmt.Fprintf(w, "  %-15s %s\n", name, s.share(count))
+		}
+	}
+
+	fmt.Fprintln(w, "\nPayload sizes:")
+	for i, bucket := range sizeBuckets {
+		fmt.Fprintf(w, "  %-15s %s\n", bucket.label, s.share(s.Sizes[i]))
+	}
+
+	fmt.Fprintln(w, "\nDelivery attempts:")
+	if len(s.DeliveryAttempts) == 1 && s.DeliveryAttempts[0] > 0 {
+		fmt.Fprintln(w, "  not available (the subscription has no dead-letter policy)")
+	} else {
+		attempts := make([]int, 0, len(s.DeliveryAttempts))
+		for attempt := range s.DeliveryAttempts {
+			attempts = append(attempts, attempt)
+		}
+		sort.Ints(attempts)
+		for _, attempt := range attempts {
+			fmt.Fprintf(w, "  %-15d %s\n", attempt, s.share(s.DeliveryAttempts[attempt]))
+		}
+	}
+
+	fmt.Fprintln(w, "\nAttributes:")
+	if len(s.Attributes) == 0 {
+		fmt.Fprintln(w, "  none")
+		return
+	}
+	keys := make([]string, 0, len(s.Attributes))
+	for key := range s.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values := s.Attributes[key]
+		present := 0
+		for _, count := range values {
+			present += count
+		}
+		fmt.Fprintf(w, "  %s: on %s of messages, %d distinct values\n", key, s.share(present), len(values))
+		for i, value := range topAttributeValues(values) {
+			if i == topValues {
+				fmt.Fprintf(w, "    ... %d more\n", len(values)-topValues)
+				break
+			}
+			fmt.Fprintf(w, "    %-30q %s\n", value, s.share(values[value]))
+		}
+	}
+}
+
+// share formats a count with its percentage of the sample
+func (s *SampleStats) share(count int) string {
+	return fmt.Sprintf("%d (%.0f%%)", count, float64(count)*100/float64(s.Sampled))
+}
+
+// topAttributeValues orders values by count, most common first
+func topAttributeValues(values map[string]int) []string {
+	ordered := make([]string, 0, len(values))
+	for value := range values {
+		ordered = append(ordered, value)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if values[ordered[i]] != values[ordered[j]] {
+			return values[ordered[i]] > values[ordered[j]]
+		}
+		return ordered[i] < ordered[j]
+	})
+	return ordered
+}
+
+// payloadType classifies message data as empty, JSON, text or binary
+func payloadType(data []byte) string {
+	switch {
+	case len(data) == 0:
+		return payloadTypeEmpty
+	case json.Valid(data):
+		return payloadTypeJSON
+	case utf8.Valid(data) && !strings.ContainsFunc(string(data), isBinaryControl):
+		return payloadTypeText
+	default:
+		return payloadTypeBinary
+	}
+}
+
+// isBinaryControl reports control characters that do not occur in text
+func isBinaryControl(r rune) bool {
+	return r < 0x20 && r != '\n' && r != '\r' && r != '\t'
+}
+
+// StatsHandler implements MessageHandler by sampling messages without consuming
+// them. Sampled messages are held until the sample is complete and then released.
+type StatsHandler struct {
+	broker MessageBroker
+	stats  *SampleStats
+	leases *LeaseKeeper
+	held   []*Message
+}
+
+// NewStatsHandler creates a new stats handler
+func NewStatsHandler(broker MessageBroker, stats *SampleStats) *StatsHandler {
+	return &StatsHandler{
+		broker: broker,
+		stats:  stats,
+		leases: NewLeaseKeeper(broker, constants.DefaultLeaseExtension),
+	}
+}
+
+// HandleMessage records the message and holds it so it is not sampled twice
+func (h *StatsHandler) HandleMessage(ctx context.Context, message *Message, msgNum int) (bool, error) {
+	h.stats.Add(message)
+	h.leases.Hold(message.AckID)
+	h.held = append(h.held, message)
+	return false, ErrDeferred
+}
+
+// Flush releases every sampled message back to the subscription
+func (h *StatsHandler) Flush(ctx context.Context) int {
+	h.leases.Stop()
+	for _, message := range h.held {
+		if err := h.broker.Release(ctx, message.AckID); err != nil {
+			log.Printf("Warning: failed to release message %s: %v", message.ID, err)
+		}
+	}
+	h.held = nil
+	return 0
+}
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Reports statistics about the messages in a source",
+	Long: `Reports the backlog size and oldest unacked message age of a subscription,
+along with a breakdown of a sample of its messages by attribute values, payload
+type, payload size and delivery attempts.
+
+Backlog metrics are read from Cloud Monitoring and may lag by a few minutes.
+Sampled messages are released back to the subscription, so nothing is consumed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(os.Stdout)
+
+		// Parse and validate configuration
+		config, err := ParseCommandConfig(cmd)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return
+		}
+		topValues, _ := cmd.Flags().GetInt("top-values")
+		if config.Count <= 0 {
+			log.Printf("Error: --count must be at least 1")
+			return
+		}
+
+		// Informational output
+		log.Printf("Collecting statistics for %s", config.Source)
+
+		ctx := context.Background()
+
+		metrics, err := FetchBacklogMetrics(ctx, config.Source)
+		if err != nil {
+			log.Printf("Warning: backlog metrics unavailable: %v", err)
+		}
+
+		// Create message broker
+		broker, err := NewPubSubBroker(ctx, config.Source, "")
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer broker.Close()
+
+		// Sample messages
+		stats := NewSampleStats()
+		handler := NewStatsHandler(broker, stats)
+		processor := NewMessageProcessor(broker, *config, handler, os.Stdout)
+		if _, err := processor.Process(ctx); err != nil {
+			log.Printf("Error during sampling: %v", err)
+		}
+
+		fmt.Println()
+		if metrics != nil {
+			fmt.Printf("Backlog size: %d messages (as of %s)\n", metrics.UndeliveredMessages, metrics.SampledAt.Local().Format(time.RFC3339))
+			fmt.Printf("Oldest unacked message age: %v\n", metrics.OldestUnackedAge)
+		}
+		fmt.Printf("Sampled messages: %d\n", stats.Sampled)
+		stats.Write(os.Stdout, topValues)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	// Add source flags, sampling a limited number of messages
+	AddSourceFlags(statsCmd)
+	count := statsCmd.Flags().Lookup("count")
+	count.Usage = "Maximum number of messages to sample"
+	count.DefValue = fmt.Sprintf("%d", constants.DefaultStatsSampleSize)
+	_ = count.Value.Set(count.DefValue)
+
+	// Add stats-specific flags
+	statsCmd.Flags().Int("top-values", constants.DefaultStatsTopValues, "Number of most common values to list per attribute")
+}
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// filterResult is the outcome of evaluating a subscription filter when only some
+// attributes of a message are known
+type filterResult int
+
+const (
+	filterUnknown filterResult = iota
+	filterFalse
+	filterTrue
+)
+
+func (r filterResult) not() filterResult {
+	switch r {
+	case filterTrue:
+		return filterFalse
+	case filterFalse:
+		return filterTrue
+	}
+	return filterUnknown
+}
+
+func (r filterResult) and(other filterResult) filterResult {
+	if r == filterFalse || other == filterFalse {
+		return filterFalse
+	}
+	if r == filterTrue && other == filterTrue {
+		return filterTrue
+	}
+	return filterUnknown
+}
+
+func (r filterResult) or(other filterResult) filterResult {
+	if r == filterTrue || other == filterTrue {
+		return filterTrue
+	}
+	if r == filterFalse && other == filterFalse {
+		return filterFalse
+	}
+	return filterUnknown
+}
+
+// subscriptionFilterRejects reports whether a Pub/Sub subscription filter
+// definitely rejects every message carrying the given attributes. Attributes
+// not in the map may have any value, so a filter that depends on them only
+// rejects when the known attributes decide it. An empty filter accepts
+// everything, and a filter that cannot be parsed is not treated as rejecting.
+func subscriptionFilterRejects(filter string, attributes map[string]string) bool {
+	if strings.TrimSpace(filter) == "" {
+		return false
+	}
+	result, err := evaluateSubscriptionFilter(filter, attributes)
+	return err == nil && result == filterFalse
+}
+
+// evaluateSubscriptionFilter evaluates a filter in the Pub/Sub filter language:
+// attributes:KEY, attributes.KEY = "v", attributes.KEY != "v" and
+// hasPrefix(attributes.KEY, "p"), combined with NOT (or -), AND, OR and parentheses
+func evaluateSubscriptionFilter(filter string, attributes map[string]string) (filterResult, error) {
+	tokens, err := tokenizeSubscriptionFilter(filter)
+	if err != nil {
+		return filterUnknown, err
+	}
+	p := &filterParser{tokens: tokens, attributes: attributes}
+	result, err := p.parseOr()
+	if err != nil {
+		return filterUnknown, err
+	}
+	if !p.done() {
+		return filterUnknown, fmt.Errorf("unexpected %q in filter", p.peek().text)
+	}
+	return result, nil
+}
+
+type filterTokenKind int
+
+const (
+	tokenWord filterTokenKind = iota
+	tokenString
+	tokenSymbol
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+}
+
+// tokenizeSubscriptionFilter splits a filter into words, quoted strings and symbols
+func tokenizeSubscriptionFilter(filter string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string in filter")
+			}
+			value, err := strconv.Unquote(string(runes[i : end+1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s in filter: %w", string(runes[i:end+1]), err)
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: value})
+			i = end + 1
+		case r == '!' && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, filterToken{kind: tokenSymbol, text: "!="})
+			i += 2
+		case strings.ContainsRune("():.=,-", r):
+			tokens = append(tokens, filterToken{kind: tokenSymbol, text: string(r)})
+			i++
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			end := i
+			for end < len(runes) && (runes[end] == '_' || unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+				end++
+			}
+			tokens = append(tokens, filterToken{kind: tokenWord, text: string(runes[i:end])})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected %q in filter", r)
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser evaluates a tokenized filter by recursive descent
+type filterParser struct {
+	tokens     []filterToken
+	pos        int
+	attributes map[string]string
+}
+
+func (p *filterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.done() {
+		return filterToken{kind: tokenSymbol}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+// accept consumes the next token if it is the given word or symbol
+func (p *filterParser) accept(kind filterTokenKind, text string) bool {
+	if token := p.peek(); !p.done() && token.kind == kind && token.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(kind filterTokenKind, text string) error {
+	if !p.accept(kind, text) {
+		return fmt.Errorf("expected %q in filter", text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filterResult, error) {
+	result, err := p.parseAnd()
+	if err != nil {
+		return filterUnknown, err
+	}
+	for p.accept(tokenWord, "OR") {
+		other, err := p.parseAnd()
+		if err != nil {
+			return filterUnknown, err
+		}
+		result = result.or(other)
+	}
+	return result, nil
+}
+
+func (p *filterParser) parseAnd() (filterResult, error) {
+	result, err := p.parseUnary()
+	if err != nil {
+		return filterUnknown, err
+	}
+	for p.accept(tokenWord, "AND") {
+		other, err := p.parseUnary()
+		if err != nil {
+			return filterUnknown, err
+		}
+		result = result.and(other)
+	}
+	return result, nil
+}
+
+func (p *filterParser) parseUnary() (filterResult, error) {
+	if p.accept(tokenWord, "NOT") || p.accept(tokenSymbol, "-") {
+		result, err := p.parseUnary()
+		return result.not(), err
+	}
+	if p.accept(tokenSymbol, "(") {
+		result, err := p.parseOr()
+		if err != nil {
+			return filterUnknown, err
+		}
+		return result, p.expect(tokenSymbol, ")")
+	}
+	if p.accept(tokenWord, "hasPrefix") {
+		return p.parseHasPrefix()
+	}
+	return p.parseAttribute()
+}
+
+// parseHasPrefix evaluates hasPrefix(attributes.KEY, "prefix")
+func (p *filterParser) parseHasPrefix() (filterResult, error) {
+	if err := p.expect(tokenSymbol, "("); err != nil {
+		return filterUnknown, err
+	}
+	if err := p.expect(tokenWord, "attributes"); err != nil {
+		return filterUnknown, err
+	}
+	if err := p.expect(tokenSymbol, "."); err != nil {
+		return filterUnknown, err
+	}
+	key, err := p.parseKey()
+	if err != nil {
+		return filterUnknown, err
+	}
+	if err := p.expect(tokenSymbol, ","); err != nil {
+		return filterUnknown, err
+	}
+	prefix := p.next()
+	if prefix.kind != tokenString {
+		return filterUnknown, fmt.Errorf("expected a quoted prefix in filter")
+	}
+	if err := p.expect(tokenSymbol, ")"); err != nil {
+		return filterUnknown, err
+	}
+	value, ok := p.attributes[key]
+	if !ok {
+		return filterUnknown, nil
+	}
+	return boolResult(strings.HasPrefix(value, prefix.text)), nil
+}
+
+// parseAttribute evaluates attributes:KEY, attributes.KEY = "v" and attributes.KEY != "v"
+func (p *filterParser) parseAttribute() (filterResult, error) {
+	if err := p.expect(tokenWord, "attributes"); err != nil {
+		return filterUnknown, err
+	}
+	if p.accept(tokenSymbol, ":") {
+		key, err := p.parseKey()
+		if err != nil {
+			return filterUnknown, err
+		}
+		if _, ok := p.attributes[key]; !ok {
+			return filterUnknown, nil
+		}
+		return filterTrue, nil
+	}
+	if err := p.expect(tokenSymbol, "."); err != nil {
+		return filterUnknown, err
+	}
+	key, err := p.parseKey()
+	if err != nil {
+		return filterUnknown, err
+	}
+	negate := false
+	if p.accept(tokenSymbol, "!=") {
+		negate = true
+	} else if err := p.expect(tokenSymbol, "="); err != nil {
+		return filterUnknown, err
+	}
+	expected := p.next()
+	if expected.kind != tokenString {
+		return filterUnknown, fmt.Errorf("expected a quoted value in filter")
+	}
+	value, ok := p.attributes[key]
+	if !ok {
+		return filterUnknown, nil
+	}
+	result := boolResult(value == expected.text)
+	if negate {
+		result = result.not()
+	}
+	return result, nil
+}
+
+// parseKey reads an attribute key, either a bare word or a quoted string
+func (p *filterParser) parseKey() (string, error) {
+	token := p.next()
+	if token.kind == tokenSymbol {
+		return "", fmt.Errorf("expected an attribute key in filter")
+	}
+	return token.text, nil
+}
+
+func boolResult(value bool) filterResult {
+	if value {
+		return filterTrue
+	}
+	return filterFalse
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import "testing"
+
+func TestEvaluateSubscriptionFilter(t *testing.T) {
+	// Only the routing attribute is known; other attributes may have any value
+	routed := map[string]string{routeAttribute: "projects/p/subscriptions/orders"}
+	tests := []struct {
+		filter   string
+		expected filterResult
+	}{
+		{`attributes:replay_target_subscription`, filterTrue},
+		{`attributes:"replay_target_subscription"`, filterTrue},
+		{`attributes:origin`, filterUnknown},
+		{`attributes.replay_target_subscription = "projects/p/subscriptions/orders"`, filterTrue},
+		{`attributes.replay_target_subscription = "projects/p/subscriptions/audit"`, filterFalse},
+		{`attributes.replay_target_subscription != "projects/p/subscriptions/orders"`, filterFalse},
+
+		// NOT and its - shorthand
+		{`NOT attributes:replay_target_subscription`, filterFalse},
+		{`-attributes:replay_target_subscription`, filterFalse},
+		{`NOT NOT attributes:replay_target_subscription`, filterTrue},
+		{`NOT attributes:origin`, filterUnknown},
+
+		// hasPrefix
+		{`hasPrefix(attributes.replay_target_subscription, "projects/p/")`, filterTrue},
+		{`hasPrefix(attributes.replay_target_subscription, "projects/q/")`, filterFalse},
+		{`NOT hasPrefix(attributes.replay_target_subscription, "projects/p/")`, filterFalse},
+		{`hasPrefix(attributes.origin, "projects/p/")`, filterUnknown},
+
+		// AND binds tighter than OR
+		{`attributes:origin OR attributes:replay_target_subscription AND NOT attributes:replay_target_subscription`, filterUnknown},
+		{`NOT attributes:replay_target_subscription AND attributes:origin OR attributes:replay_target_subscription`, filterTrue},
+		{`(attributes:origin OR attributes:replay_target_subscription) AND NOT attributes:replay_target_subscription`, filterFalse},
+		{`attributes:origin AND NOT attributes:replay_target_subscription`, filterFalse},
+		{`attributes:origin OR NOT attributes:replay_target_subscription`, filterUnknown},
+		{`attributes.replay_target_subscription = "projects/p/subscriptions/orders" OR NOT attributes:replay_target_subscription`, filterTrue},
+	}
+	for _, tt := range tests {
+		result, err := evaluateSubscriptionFilter(tt.filter, routed)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.filter, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.filter, tt.expected, result)
+		}
+	}
+}
+
+func TestEvaluateSubscriptionFilterRejectsMalformed(t *testing.T) {
+	for _, filter := range []string{
+		`attributes:`,
+		`attributes.key = value`,
+		`(attributes:key`,
+		`hasPrefix(attributes.key)`,
+		`attributes:key AND`,
+		`attributes.key = "unterminated`,
+	} {
+		if _, err := evaluateSubscriptionFilter(filter, nil); err == nil {
+			t.Errorf("%s: expected an error", filter)
+		}
+		if subscriptionFilterRejects(filter, nil) {
+			t.Errorf("%s: a malformed filter must not count as rejecting", filter)
+		}
+	}
+}
+
+func TestSubscriptionFilterRejects(t *testing.T) {
+	routed := map[string]string{routeAttribute: "projects/p/subscriptions/orders"}
+	tests := []struct {
+		filter   string
+		expected bool
+	}{
+		{``, false},
+		{`NOT attributes:replay_target_subscription`, true},
+		{`attributes:replay_target_subscription`, false},
+		{`attributes:origin`, false},
+		{`attributes.replay_target_subscription = "projects/p/subscriptions/audit" OR NOT attributes:replay_target_subscription`, true},
+	}
+	for _, tt := range tests {
+		if got := subscriptionFilterRejects(tt.filter, routed); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.filter, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"replay/constants"
+)
+
+// pendingDecision is a review decision held back so that it can still be undone
+type pendingDecision struct {
+	message   *Message
+	msgNum    int
+	summary   string
+	rule      *MatchRule // rule the decision created or matched, if any
+	decidedAt time.Time
+	commit    func(ctx context.Context) (bool, error)
+}
+
+// UndoBuffer holds decided messages for a grace period before their actions are
+// carried out and they are acknowledged. Leases on held messages are extended
+// until they are committed.
+type UndoBuffer struct {
+	broker  MessageBroker
+	window  time.Duration
+	depth   int
+	leases  *LeaseKeeper
+	pending []*pendingDecision
+	failed  int
+	output  io.Writer
+}
+
+// NewUndoBuffer creates an undo buffer. Decisions are committed once they are
+// older than window or once more than depth decisions are held; a zero value
+// disables that limit.
+func NewUndoBuffer(broker MessageBroker, window time.Duration, depth int, output io.Writer) *UndoBuffer {
+	return &UndoBuffer{
+		broker: broker,
+		window: window,
+		depth:  depth,
+		leases: NewLeaseKeeper(broker, constants.DefaultLeaseExtension),
+		output: output,
+	}
+}
+
+// Hold keeps the lease of a message under review alive
+func (b *UndoBuffer) Hold(message *Message) {
+	b.leases.Hold(message.AckID)
+}
+
+// Release stops keeping the lease of a message alive
+func (b *UndoBuffer) Release(message *Message) {
+	b.leases.Drop(message.AckID)
+}
+
+// Add holds a decision until it is committed or undone
+func (b *UndoBuffer) Add(decision *pendingDecision) {
+	b.leases.Hold(decision.message.AckID)
+	b.pending = append(b.pending, decision)
+}
+
+// Undo removes the most recent decision that has not been committed yet.
+// Decisions that have left the undo window while the reviewer was at the prompt
+// are committed first, so they can no longer be undone; expired reports whether
+// any were.
+func (b *UndoBuffer) Undo(ctx context.Context) (decision *pendingDecision, expired bool) {
+	expired = b.CommitDue(ctx) > 0
+	if len(b.pending) == 0 {
+		return nil, expired
+	}
+	last := b.pending[len(b.pending)-1]
+	b.pending = b.pending[:len(b.pending)-1]
+	return last, expired
+}
+
+// Len returns the number of decisions that can still be undone
+func (b *UndoBuffer) Len() int {
+	return len(b.pending)
+}
+
+// CommitDue commits decisions that have left the undo window or exceed the undo
+// depth and returns how many it committed
+func (b *UndoBuffer) CommitDue(ctx context.Context) int {
+	committed := 0
+	for len(b.pending) > 0 {
+		oldest := b.pending[0]
+		expired := b.window > 0 && time.Since(oldest.decidedAt) >= b.window
+		overflow := b.depth > 0 && len(b.pending) > b.depth
+		if !expired && !overflow {
+			break
+		}
+		b.pending = b.pending[1:]
+		b.commit(ctx, oldest)
+		committed++
+	}
+	return committed
+}
+
+// Flush commits every held decision, stops extending leases and returns how
+// many decisions failed to commit during the session
+func (b *UndoBuffer) Flush(ctx context.Context) int {
+	for _, decision := range b.pending {
+		b.commit(ctx, decision)
+	}
+	b.pending = nil
+	b.leases.Stop()
+	return b.failed
+}
+
+// commit carries out a decision and acknowledges the message if requested
+func (b *UndoBuffer) commit(ctx context.Context, decision *pendingDecision) {
+	defer b.leases.Drop(decision.message.AckID)
+
+	acknowledge, err := decision.commit(ctx)
+	if err != nil {
+		fmt.Fprintf(b.output, "Error handling message %d: %v\n", decision.msgNum, err)
+		b.failed++
+		return
+	}
+	if acknowledge {
+		if err := b.broker.Acknowledge(ctx, decision.message.AckID); err != nil {
+			fmt.Fprintf(b.output, "Warning: failed to acknowledge message %d: %v\n", decision.msgNum, err)
+		}
+	}
+}
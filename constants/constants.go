@@ -6,6 +6,27 @@ import "time"
 const (
 	BrokerTypeGCPPubSubSubscription = "GCP_PUBSUB_SUBSCRIPTION"
 	BrokerTypeGCPPubSubTopic        = "GCP_PUBSUB_TOPIC"
+	BrokerTypeKafkaTopic            = "KAFKA_TOPIC"
+	BrokerTypeAMQPQueue             = "AMQP_QUEUE"
+	BrokerTypeAMQPExchange          = "AMQP_EXCHANGE"
+	BrokerTypeAWSSQSQueue           = "AWS_SQS_QUEUE"
+	BrokerTypeAWSSNSTopic           = "AWS_SNS_TOPIC"
+	BrokerTypeNATSJetStream         = "NATS_JETSTREAM"
+	BrokerTypeRedisStream           = "REDIS_STREAM"
+)
+
+// Archive types for storing discarded messages
+const (
+	ArchiveTypeJSONLFile = "JSONL_FILE"
+	ArchiveTypeDirectory = "DIRECTORY"
+)
+
+// Local file formats for exported messages
+const (
+	ExportFormatJSONL  = "jsonl"
+	ExportFormatJSON   = "json"
+	ExportFormatCSV    = "csv"
+	ExportFormatRawDir = "raw-dir"
 )
 
 // Default configuration values
@@ -13,6 +34,18 @@ const (
 	DefaultPollTimeoutSeconds = 10
 	DefaultPollTimeout        = 10 * time.Second
 	DefaultMaxMessages        = 1
+	DefaultLeaseExtension     = 60 * time.Second
+	LeaseRenewalInterval      = 5 * time.Second
+	DefaultExportBatchSize    = 100
+	MaxAckIDsPerRequest       = 1000
+	DefaultStatsSampleSize    = 100
+	DefaultStatsTopValues     = 5
+	DefaultProgressInterval   = 100
+	DefaultHealthInterval     = 60 * time.Second
+	DefaultMinBackoff         = 1 * time.Second
+	DefaultMaxBackoff         = 5 * time.Minute
+	MinSubscriptionTTL        = 24 * time.Hour
+	DefaultLivePollInterval   = 1 * time.Second
 )
 
 // Test-specific timeouts
@@ -0,0 +1,261 @@
+package cmd_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// amqpTestURL returns the RabbitMQ broker to test against, skipping the test
+// unless AMQP_URL is set
+func amqpTestURL(t *testing.T) string {
+	t.Helper()
+	value := os.Getenv("AMQP_URL")
+	if value == "" {
+		t.Skip("AMQP_URL is not set")
+	}
+	return value
+}
+
+// amqpAddress appends replay's options to a broker URI
+func amqpAddress(broker string, options url.Values) string {
+	separator := "?"
+	if strings.Contains(broker, "?") {
+		separator = "&"
+	}
+	return broker + separator + options.Encode()
+}
+
+// deadLetterAMQPMessages publishes messages to a work queue and rejects them,
+// so that RabbitMQ dead-letters them to dlq with an x-death header
+func deadLetterAMQPMessages(t *testing.T, channel *amqp.Channel, work, dlq string, count int) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < count; i++ {
+		err := channel.PublishWithContext(ctx, "", work, false, false, amqp.Publishing{
+			ContentType: "application/json",
+			MessageId:   fmt.Sprintf("amqp-%d", i),
+			Headers:     amqp.Table{"origin": "amqp-test"},
+			Body:        []byte(fmt.Sprintf(`{"message":"AMQP Test message %d"}`, i)),
+		})
+		if err != nil {
+			t.Fatalf("Failed to publish to %s: %v", work, err)
+		}
+	}
+	for i := 0; i < count; i++ {
+		delivery, ok, err := channel.Get(work, false)
+		for attempt := 0; err == nil && !ok && attempt < 50; attempt++ {
+			time.Sleep(100 * time.Millisecond)
+			delivery, ok, err = channel.Get(work, false)
+		}
+		if err != nil || !ok {
+			t.Fatalf("Failed to get message %d from %s: %v", i, work, err)
+		}
+		if err := delivery.Nack(false, false); err != nil {
+			t.Fatalf("Failed to reject message %d: %v", i, err)
+		}
+	}
+}
+
+func TestMoveFromAMQPDeadLetterQueue(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move republishes dead-lettered messages with their headers,
+	// content type and original routing key, and acks them in the dead-letter queue
+	broker := amqpTestURL(t)
+	connection, err := amqp.Dial(broker)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", broker, err)
+	}
+	defer connection.Close()
+	channel, err := connection.Channel()
+	if err != nil {
+		t.Fatalf("Failed to open a channel: %v", err)
+	}
+
+	suffix := time.Now().Format("20060102150405.000000")
+	work := "replay-e2e-work-" + suffix
+	dlq := "replay-e2e-dlq-" + suffix
+	retry := "replay-e2e-retry-" + suffix
+	exchange := "replay-e2e-exchange-" + suffix
+	if _, err := channel.QueueDeclare(dlq, false, true, false, false, nil); err != nil {
+		t.Fatalf("Failed to declare %s: %v", dlq, err)
+	}
+	if _, err := channel.QueueDeclare(work, false, true, false, false, amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": dlq,
+	}); err != nil {
+		t.Fatalf("Failed to declare %s: %v", work, err)
+	}
+	if err := channel.ExchangeDeclare(exchange, "direct", false, true, false, false, nil); err != nil {
+		t.Fatalf("Failed to declare %s: %v", exchange, err)
+	}
+	if _, err := channel.QueueDeclare(retry, false, true, false, false, nil); err != nil {
+		t.Fatalf("Failed to declare %s: %v", retry, err)
+	}
+	// Messages are routed by the key they were first published with, the work queue
+	if err := channel.QueueBind(retry, work, exchange, false, nil); err != nil {
+		t.Fatalf("Failed to bind %s: %v", retry, err)
+	}
+	t.Cleanup(func() {
+		for _, queue := range []string{work, dlq, retry} {
+			channel.QueueDelete(queue, false, false, false)
+		}
+		channel.ExchangeDelete(exchange, false, false)
+	})
+	deadLetterAMQPMessages(t, channel, work, dlq, 3)
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeAMQPQueue,
+		"--destination-type", constants.BrokerTypeAMQPExchange,
+		"--source", amqpAddress(broker, url.Values{"queue": {dlq}}),
+		"--destination", amqpAddress(broker, url.Values{"exchange": {exchange}}),
+		"--polling-timeout-seconds", "3",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 3") {
+		t.Fatalf("Expected 3 messages to be moved. Full output:\n%s", actual)
+	}
+
+	for i := 0; i < 3; i++ {
+		delivery, ok, err := channel.Get(retry, true)
+		if err != nil || !ok {
+			t.Fatalf("Expected message %d in %s: %v", i, retry, err)
+		}
+		testhelpers.AssertMessageContent(t, string(delivery.Body), fmt.Sprintf(`{"message":"AMQP Test message %d"}`, i))
+		if delivery.ContentType != "application/json" || delivery.MessageId != fmt.Sprintf("amqp-%d", i) {
+			t.Errorf("Message %d: expected its content type and ID to be kept, got %q and %q", i, delivery.ContentType, delivery.MessageId)
+		}
+		if delivery.Headers["origin"] != "amqp-test" || delivery.Headers["replay_redrive_count"] != "1" {
+			t.Errorf("Message %d: expected origin and replay_redrive_count headers, got %v", i, delivery.Headers)
+		}
+		if _, ok := delivery.Headers["x-death"]; ok {
+			t.Errorf("Message %d: expected the x-death header to be dropped", i)
+		}
+	}
+	if queue, err := channel.QueueDeclarePassive(dlq, false, true, false, false, nil); err != nil || queue.Messages != 0 {
+		t.Errorf("Expected %s to be empty, got %d messages: %v", dlq, queue.Messages, err)
+	}
+}
+
+func TestDLRShowsAMQPDeadLetterHistory(t *testing.T) {
+	t.Parallel()
+	// Test to verify that dlr renders the x-death header of a dead-lettered message
+	// and leaves the message in the queue on quit
+	broker := amqpTestURL(t)
+	connection, err := amqp.Dial(broker)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", broker, err)
+	}
+	defer connection.Close()
+	channel, err := connection.Channel()
+	if err != nil {
+		t.Fatalf("Failed to open a channel: %v", err)
+	}
+
+	suffix := time.Now().Format("20060102150405.000000")
+	work := "replay-e2e-dlr-work-" + suffix
+	dlq := "replay-e2e-dlr-dlq-" + suffix
+	if _, err := channel.QueueDeclare(dlq, false, true, false, false, nil); err != nil {
+		t.Fatalf("Failed to declare %s: %v", dlq, err)
+	}
+	if _, err := channel.QueueDeclare(work, false, true, false, false, amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": dlq,
+	}); err != nil {
+		t.Fatalf("Failed to declare %s: %v", work, err)
+	}
+	t.Cleanup(func() {
+		channel.QueueDelete(work, false, false, false)
+		channel.QueueDelete(dlq, false, false, false)
+	})
+	deadLetterAMQPMessages(t, channel, work, dlq, 1)
+
+	stdin, err := testhelpers.NewStdinSimulator("q\n")
+	if err != nil {
+		t.Fatalf("Failed to create stdin simulator: %v", err)
+	}
+	defer stdin.Cleanup()
+	args := []string{
+		"dlr",
+		"--source-type", constants.BrokerTypeAMQPQueue,
+		"--destination-type", constants.BrokerTypeAMQPExchange,
+		"--source", amqpAddress(broker, url.Values{"queue": {dlq}}),
+		"--destination", amqpAddress(broker, url.Values{"exchange": {""}, "routing-key": {work}}),
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	expected := fmt.Sprintf("from queue %s (rejected, count 1) via exchange \"\" with routing keys %s", work, work)
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+	}
+
+	if queue, err := channel.QueueDeclarePassive(dlq, false, true, false, false, nil); err != nil || queue.Messages != 1 {
+		t.Errorf("Expected the message to stay in %s, got %d messages: %v", dlq, queue.Messages, err)
+	}
+}
+
+func TestMoveRejectsAMQPLoop(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move refuses to publish messages through the default
+	// exchange straight back into the queue they were taken from
+	broker := amqpTestURL(t)
+	connection, err := amqp.Dial(broker)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", broker, err)
+	}
+	defer connection.Close()
+	channel, err := connection.Channel()
+	if err != nil {
+		t.Fatalf("Failed to open a channel: %v", err)
+	}
+
+	dlq := "replay-e2e-loop-dlq-" + time.Now().Format("20060102150405.000000")
+	if _, err := channel.QueueDeclare(dlq, false, true, false, false, nil); err != nil {
+		t.Fatalf("Failed to declare %s: %v", dlq, err)
+	}
+	t.Cleanup(func() {
+		channel.QueueDelete(dlq, false, false, false)
+	})
+	err = channel.PublishWithContext(context.Background(), "", dlq, false, false, amqp.Publishing{
+		Body: []byte("AMQP Loop Test message"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to publish to %s: %v", dlq, err)
+	}
+
+	destination := amqpAddress(broker, url.Values{"exchange": {""}, "routing-key": {dlq}})
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeAMQPQueue,
+		"--destination-type", constants.BrokerTypeAMQPExchange,
+		"--source", amqpAddress(broker, url.Values{"queue": {dlq}}),
+		"--destination", destination,
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	expected := fmt.Sprintf("destination %s routes to the source queue %s", destination, dlq)
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+	}
+
+	if queue, err := channel.QueueDeclarePassive(dlq, false, true, false, false, nil); err != nil || queue.Messages != 1 {
+		t.Errorf("Expected the message to stay in %s, got %d messages: %v", dlq, queue.Messages, err)
+	}
+}
@@ -0,0 +1,329 @@
+package cmd_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// awsTestConfig returns the configuration for an SQS-compatible stand-in such as
+// LocalStack, skipping the test unless AWS_ENDPOINT_URL points at one
+func awsTestConfig(t *testing.T) aws.Config {
+	t.Helper()
+	if os.Getenv("AWS_ENDPOINT_URL") == "" {
+		t.Skip("AWS_ENDPOINT_URL is not set")
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return cfg
+}
+
+// createSQSQueue creates a queue that is deleted when the test ends and returns its URL
+func createSQSQueue(t *testing.T, client *sqs.Client, name string) string {
+	t.Helper()
+	attributes := map[string]string{}
+	if strings.HasSuffix(name, ".fifo") {
+		attributes["FifoQueue"] = "true"
+	}
+	output, err := client.CreateQueue(context.Background(), &sqs.CreateQueueInput{QueueName: aws.String(name), Attributes: attributes})
+	if err != nil {
+		t.Fatalf("Failed to create queue %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		client.DeleteQueue(context.Background(), &sqs.DeleteQueueInput{QueueUrl: output.QueueUrl})
+	})
+	return aws.ToString(output.QueueUrl)
+}
+
+// receiveSQSMessages receives up to expected messages from a queue, deleting them
+func receiveSQSMessages(t *testing.T, client *sqs.Client, queueURL string, expected int) []sqstypes.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), constants.TestShortPollTimeout)
+	defer cancel()
+	var messages []sqstypes.Message
+	for len(messages) < expected && ctx.Err() == nil {
+		output, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    aws.String(queueURL),
+			MaxNumberOfMessages:         10,
+			WaitTimeSeconds:             1,
+			MessageAttributeNames:       []string{"All"},
+			MessageSystemAttributeNames: []sqstypes.MessageSystemAttributeName{sqstypes.MessageSystemAttributeNameAll},
+		})
+		if err != nil {
+			break
+		}
+		for _, message := range output.Messages {
+			client.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: message.ReceiptHandle})
+		}
+		messages = append(messages, output.Messages...)
+	}
+	return messages
+}
+
+func TestMoveBetweenSQSQueues(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move keeps bodies and message attributes between SQS queues
+	// and deletes moved messages from the source
+	client := sqs.NewFromConfig(awsTestConfig(t))
+	suffix := time.Now().Format("20060102150405")
+	dlq := createSQSQueue(t, client, "replay-e2e-dlq-"+suffix)
+	queue := createSQSQueue(t, client, "replay-e2e-orders-"+suffix)
+	for i := 0; i < 3; i++ {
+		_, err := client.SendMessage(context.Background(), &sqs.SendMessageInput{
+			QueueUrl:    aws.String(dlq),
+			MessageBody: aws.String(fmt.Sprintf("SQS Test message %d", i)),
+			MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+				"origin": {DataType: aws.String("String"), StringValue: aws.String("sqs-test")},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to send to %s: %v", dlq, err)
+		}
+	}
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeAWSSQSQueue,
+		"--destination-type", constants.BrokerTypeAWSSQSQueue,
+		"--source", dlq,
+		"--destination", queue,
+		"--polling-timeout-seconds", "3",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 3") {
+		t.Fatalf("Expected 3 messages to be moved. Full output:\n%s", actual)
+	}
+
+	messages := receiveSQSMessages(t, client, queue, 3)
+	if len(messages) != 3 {
+		t.Fatalf("Expected 3 messages in the destination, got %d", len(messages))
+	}
+	for _, message := range messages {
+		if !strings.HasPrefix(aws.ToString(message.Body), "SQS Test message") {
+			t.Errorf("Unexpected message body %q", aws.ToString(message.Body))
+		}
+		if got := aws.ToString(message.MessageAttributes["origin"].StringValue); got != "sqs-test" {
+			t.Errorf("Expected the origin attribute to be kept, got %q", got)
+		}
+		if got := aws.ToString(message.MessageAttributes["replay_redrive_count"].StringValue); got != "1" {
+			t.Errorf("Expected replay_redrive_count 1, got %q", got)
+		}
+	}
+	if remaining := receiveSQSMessages(t, client, dlq, 1); len(remaining) != 0 {
+		t.Errorf("Expected the source to be empty, got %d messages", len(remaining))
+	}
+}
+
+func TestMoveFoldsSQSAttributesBeyondLimit(t *testing.T) {
+	t.Parallel()
+	// Test to verify that a message already carrying the 10 message attributes SQS
+	// allows still moves once replay_redrive_count is added, with the attributes
+	// beyond the limit sent together in replay_attributes
+	client := sqs.NewFromConfig(awsTestConfig(t))
+	suffix := time.Now().Format("20060102150405")
+	dlq := createSQSQueue(t, client, "replay-e2e-full-dlq-"+suffix)
+	queue := createSQSQueue(t, client, "replay-e2e-full-orders-"+suffix)
+	attributes := map[string]sqstypes.MessageAttributeValue{}
+	for i := 0; i < 10; i++ {
+		attributes[fmt.Sprintf("attr%d", i)] = sqstypes.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(fmt.Sprint(i))}
+	}
+	_, err := client.SendMessage(context.Background(), &sqs.SendMessageInput{
+		QueueUrl:          aws.String(dlq),
+		MessageBody:       aws.String("SQS Attribute Limit Test message"),
+		MessageAttributes: attributes,
+	})
+	if err != nil {
+		t.Fatalf("Failed to send to %s: %v", dlq, err)
+	}
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeAWSSQSQueue,
+		"--destination-type", constants.BrokerTypeAWSSQSQueue,
+		"--source", dlq,
+		"--destination", queue,
+		"--polling-timeout-seconds", "3",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 1") {
+		t.Fatalf("Expected 1 message to be moved. Full output:\n%s", actual)
+	}
+
+	messages := receiveSQSMessages(t, client, queue, 1)
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message in the destination, got %d", len(messages))
+	}
+	received := messages[0].MessageAttributes
+	if len(received) != 10 {
+		t.Errorf("Expected 10 message attributes, got %d", len(received))
+	}
+	if got := aws.ToString(received["replay_redrive_count"].StringValue); got != "1" {
+		t.Errorf("Expected replay_redrive_count 1, got %q", got)
+	}
+	if got := aws.ToString(received["replay_attributes"].StringValue); got != `{"attr8":"8","attr9":"9"}` {
+		t.Errorf("Expected attr8 and attr9 in replay_attributes, got %q", got)
+	}
+}
+
+func TestMoveBetweenSQSFIFOQueues(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move keeps the message group IDs of FIFO queues
+	client := sqs.NewFromConfig(awsTestConfig(t))
+	suffix := time.Now().Format("20060102150405")
+	dlq := createSQSQueue(t, client, "replay-e2e-dlq-"+suffix+".fifo")
+	queue := createSQSQueue(t, client, "replay-e2e-orders-"+suffix+".fifo")
+	for i := 0; i < 4; i++ {
+		_, err := client.SendMessage(context.Background(), &sqs.SendMessageInput{
+			QueueUrl:               aws.String(dlq),
+			MessageBody:            aws.String(fmt.Sprintf("SQS FIFO Test message %d", i)),
+			MessageGroupId:         aws.String(fmt.Sprintf("customer-%d", i%2)),
+			MessageDeduplicationId: aws.String(fmt.Sprintf("dedup-%d", i)),
+		})
+		if err != nil {
+			t.Fatalf("Failed to send to %s: %v", dlq, err)
+		}
+	}
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeAWSSQSQueue,
+		"--destination-type", constants.BrokerTypeAWSSQSQueue,
+		"--source", dlq,
+		"--destination", queue,
+		"--polling-timeout-seconds", "3",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 4") {
+		t.Fatalf("Expected 4 messages to be moved. Full output:\n%s", actual)
+	}
+
+	messages := receiveSQSMessages(t, client, queue, 4)
+	if len(messages) != 4 {
+		t.Fatalf("Expected 4 messages in the destination, got %d", len(messages))
+	}
+	for _, message := range messages {
+		var i int
+		fmt.Sscanf(aws.ToString(message.Body), "SQS FIFO Test message %d", &i)
+		want := fmt.Sprintf("customer-%d", i%2)
+		if got := message.Attributes[string(sqstypes.MessageSystemAttributeNameMessageGroupId)]; got != want {
+			t.Errorf("Message %d: expected group %q, got %q", i, want, got)
+		}
+	}
+}
+
+func TestMoveFromSQSToSNSTopic(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move publishes to an SNS topic with message attributes
+	cfg := awsTestConfig(t)
+	sqsClient := sqs.NewFromConfig(cfg)
+	snsClient := sns.NewFromConfig(cfg)
+	suffix := time.Now().Format("20060102150405")
+	dlq := createSQSQueue(t, sqsClient, "replay-e2e-sns-dlq-"+suffix)
+	subscriber := createSQSQueue(t, sqsClient, "replay-e2e-sns-subscriber-"+suffix)
+
+	topic, err := snsClient.CreateTopic(context.Background(), &sns.CreateTopicInput{Name: aws.String("replay-e2e-topic-" + suffix)})
+	if err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	t.Cleanup(func() {
+		snsClient.DeleteTopic(context.Background(), &sns.DeleteTopicInput{TopicArn: topic.TopicArn})
+	})
+	subscriberAttributes, err := sqsClient.GetQueueAttributes(context.Background(), &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(subscriber),
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		t.Fatalf("Failed to look up %s: %v", subscriber, err)
+	}
+	_, err = snsClient.Subscribe(context.Background(), &sns.SubscribeInput{
+		TopicArn:   topic.TopicArn,
+		Protocol:   aws.String("sqs"),
+		Endpoint:   aws.String(subscriberAttributes.Attributes[string(sqstypes.QueueAttributeNameQueueArn)]),
+		Attributes: map[string]string{"RawMessageDelivery": "true"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to subscribe %s: %v", subscriber, err)
+	}
+
+	_, err = sqsClient.SendMessage(context.Background(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String(dlq),
+		MessageBody: aws.String("SNS Test message"),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			"origin": {DataType: aws.String("String"), StringValue: aws.String("sns-test")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send to %s: %v", dlq, err)
+	}
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeAWSSQSQueue,
+		"--destination-type", constants.BrokerTypeAWSSNSTopic,
+		"--source", dlq,
+		"--destination", aws.ToString(topic.TopicArn),
+		"--polling-timeout-seconds", "3",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 1") {
+		t.Fatalf("Expected 1 message to be moved. Full output:\n%s", actual)
+	}
+
+	messages := receiveSQSMessages(t, sqsClient, subscriber, 1)
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message delivered through the topic, got %d", len(messages))
+	}
+	testhelpers.AssertMessageContent(t, aws.ToString(messages[0].Body), "SNS Test message")
+	if got := aws.ToString(messages[0].MessageAttributes["origin"].StringValue); got != "sns-test" {
+		t.Errorf("Expected the origin attribute to be kept, got %q", got)
+	}
+}
+
+func TestMoveRejectsInvalidSQSQueue(t *testing.T) {
+	t.Parallel()
+	// Test to verify that a malformed SQS source is rejected before connecting
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeAWSSQSQueue,
+		"--destination-type", constants.BrokerTypeAWSSNSTopic,
+		"--source", "https://sqs.eu-west-1.amazonaws.com/orders-dlq",
+		"--destination", "arn:aws:sns:eu-west-1:123456789012:orders",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	expected := "invalid SQS queue \"https://sqs.eu-west-1.amazonaws.com/orders-dlq\""
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,90 @@
+package cmd_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestDLRArchivesDiscardedMessages(t *testing.T) {
+	t.Parallel()
+	// Test to verify that discarded messages are written to a JSONL archive before being acked
+	baseTest := testhelpers.NewBaseE2ETest(t, "dlr_archive")
+
+	archiveFile, err := baseTest.CreateTempFile("dlr_archive_*.jsonl")
+	if err != nil {
+		t.Fatalf("Failed to create archive file: %v", err)
+	}
+
+	messages := baseTest.CreateTestMessages(2, "DLR Archive Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"dlr",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"--archive-type", constants.ArchiveTypeJSONLFile,
+		"--archive", archiveFile.Name(),
+	}
+
+	// Simulate user inputs: "m" for message 1, "d" with a reason for message 2
+	actual, err := baseTest.RunDLRCommandWithArgs(args, "m\nd\nDuplicate order\n")
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	if !strings.Contains(actual, "Message 2 archived to "+archiveFile.Name()) {
+		t.Fatalf("Expected archive confirmation not found. Full output:\n%s", actual)
+	}
+	if !strings.Contains(actual, "Dead-lettered messages review completed. Total messages processed: 2") {
+		t.Fatalf("Expected summary with 2 processed messages not found")
+	}
+
+	// Verify the archive holds exactly the discarded message
+	file, err := os.Open(archiveFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to open archive file: %v", err)
+	}
+	defer file.Close()
+
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Archive line is not valid JSON: %v", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 archive record, got %d", len(records))
+	}
+
+	record := records[0]
+	if record["decision"] != "discard" {
+		t.Errorf("Expected decision 'discard', got %v", record["decision"])
+	}
+	if record["reason"] != "Duplicate order" {
+		t.Errorf("Expected reason 'Duplicate order', got %v", record["reason"])
+	}
+	if record["reviewer"] == "" || record["timestamp"] == "" {
+		t.Errorf("Expected reviewer and timestamp to be recorded, got %v", record)
+	}
+	if record["source"] != baseTest.Setup.GetSourceSubscriptionName() {
+		t.Errorf("Expected source %s, got %v", baseTest.Setup.GetSourceSubscriptionName(), record["source"])
+	}
+
+	// Verify nothing remains in the source subscription
+	if err := baseTest.VerifyMessagesInSource(0); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestDLRBulkRuleDiscardsMatchingMessages(t *testing.T) {
+	t.Parallel()
+	// Test to verify that an "all matching" rule is applied to later messages without prompting
+	baseTest := testhelpers.NewBaseE2ETest(t, "dlr_bulk_rule")
+
+	// Three messages share the same error field, the last one has a different cause.
+	messages := baseTest.CreateTestMessages(4, "DLR Bulk Rule Test message")
+	messages[0].Data = []byte(`{"order":1,"error":"timeout"}`)
+	messages[1].Data = []byte(`{"order":2,"error":"timeout"}`)
+	messages[2].Data = []byte(`{"order":3,"error":"timeout"}`)
+	messages[3].Data = []byte(`{"order":4,"error":"bad_schema"}`)
+
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	// Simulate user inputs:
+	// For message 1: "a" (all matching), "d" (discard), "4" (data field error), "y" (confirm)
+	// Messages 2 and 3 match the rule and are discarded without a prompt
+	// For message 4: "m" (move)
+	// Candidates are listed as attributes parallelIndex, testName, testRun, then data fields error, order.
+	inputs := "a\nd\n4\ny\nm\n"
+
+	actual, err := baseTest.RunDLRCommand(inputs)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expectedSubstrings := []string{
+		`Rule: discard all remaining messages where data field error = "timeout"`,
+		`Message 2 matched rule: discard all remaining messages where data field error = "timeout"`,
+		`Message 3 matched rule: discard all remaining messages where data field error = "timeout"`,
+		"Message 4 moved successfully",
+		"Dead-lettered messages review completed. Total messages processed: 4",
+	}
+	for _, expected := range expectedSubstrings {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+		}
+	}
+
+	// Only the first and last messages should have been prompted for
+	if promptCount := strings.Count(actual, "Choose action ([m]ove / [d]iscard / [a]ll matching / [q]uit): "); promptCount != 2 {
+		t.Fatalf("Expected 2 action prompts, got %d", promptCount)
+	}
+	if discardedCount := strings.Count(actual, "discarded (acked)"); discardedCount != 3 {
+		t.Fatalf("Expected 3 'discarded (acked)' messages, got %d", discardedCount)
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	// Verify only the non-matching message reached the destination
+	received, err := baseTest.GetMessagesFromDestination(1)
+	if err != nil {
+		t.Fatalf("Error receiving messages from destination: %v", err)
+	}
+	if len(received) != 1 || string(received[0].Data) != `{"order":4,"error":"bad_schema"}` {
+		t.Fatalf("Unexpected messages in destination: %v", received)
+	}
+
+	// Verify nothing remains in the source subscription
+	if err := baseTest.VerifyMessagesInSource(0); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestDLRBulkRuleKeepsLargeIDsApart(t *testing.T) {
+	t.Parallel()
+	// Test to verify that a rule on a large integer ID does not match the adjacent ID,
+	// which is the same number once both are rounded to floats
+	baseTest := testhelpers.NewBaseE2ETest(t, "dlr_bulk_rule_large_ids")
+
+	messages := baseTest.CreateTestMessages(2, "DLR Bulk Rule Large ID Test message")
+	messages[0].Data = []byte(`{"id":9007199254740993}`)
+	messages[1].Data = []byte(`{"id":9007199254740992}`)
+
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	// Simulate user inputs:
+	// For message 1: "a" (all matching), "d" (discard), "4" (data field id), "y" (confirm)
+	// For message 2, which the rule must not match: "m" (move)
+	inputs := "a\nd\n4\ny\nm\n"
+
+	actual, err := baseTest.RunDLRCommand(inputs)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expectedSubstrings := []string{
+		"Rule: discard all remaining messages where data field id = 9007199254740993",
+		"Message 2 moved successfully",
+	}
+	for _, expected := range expectedSubstrings {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+		}
+	}
+	if strings.Contains(actual, "Message 2 matched rule") {
+		t.Fatalf("Expected message 2 not to match the rule. Full output:\n%s", actual)
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	received, err := baseTest.GetMessagesFromDestination(1)
+	if err != nil {
+		t.Fatalf("Error receiving messages from destination: %v", err)
+	}
+	if len(received) != 1 || string(received[0].Data) != `{"id":9007199254740992}` {
+		t.Fatalf("Unexpected messages in destination: %v", received)
+	}
+}
@@ -44,7 +44,7 @@ func TestDLRInvalidInputHandling(t *testing.T) {
 		"DLR Invalid Input Test message 1",
 		"DLR Invalid Input Test message 2",
 		fmt.Sprintf("Attributes: map[parallelIndex:%d testName:%s testRun:%s]", baseTest.TestContext.ParallelIndex, t.Name(), baseTest.TestRunID),
-		"Invalid input. Please enter 'm', 'd', or 'q'.", // Should appear 3 times total
+		"Invalid input. Please enter 'm', 'd', 'a', or 'q'.", // Should appear 3 times total
 		"moved successfully",
 		"discarded (acked)",
 		"Dead-lettered messages review completed. Total messages processed: 2",
@@ -58,7 +58,7 @@ func TestDLRInvalidInputHandling(t *testing.T) {
 	}
 
 	// Verify that we have exactly 3 invalid input messages (1 for first message, 2 for second)
-	invalidInputCount := strings.Count(actual, "Invalid input. Please enter 'm', 'd', or 'q'.")
+	invalidInputCount := strings.Count(actual, "Invalid input. Please enter 'm', 'd', 'a', or 'q'.")
 	if invalidInputCount != 3 {
 		t.Errorf("Expected 3 'Invalid input' messages, but found %d", invalidInputCount)
 	}
@@ -0,0 +1,52 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestDLRNamedDestinationChoice(t *testing.T) {
+	t.Parallel()
+	// Test to verify that the reviewer is prompted to choose between named destinations
+	baseTest := testhelpers.NewBaseE2ETest(t, "dlr_named_destination")
+
+	messages := baseTest.CreateTestMessages(1, "DLR Named Destination Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"dlr",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"--named-destination", "retry=" + baseTest.Setup.GetDestTopicName(),
+	}
+
+	// Simulate user inputs: "m" (move), then "2" (the retry destination)
+	actual, err := baseTest.RunDLRCommandWithArgs(args, "m\n2\n")
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expectedSubstrings := []string{
+		"Choose destination ([1] default / [2] retry, blank to cancel): ",
+		"Message 1 moved successfully to retry",
+		"Dead-lettered messages review completed. Total messages processed: 1",
+	}
+	for _, expected := range expectedSubstrings {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+		}
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInDestination(1); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
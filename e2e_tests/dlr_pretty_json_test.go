@@ -78,7 +78,7 @@ func TestDLRWithPrettyJSON(t *testing.T) {
 		"Data (pretty JSON):",
 		string(prettyJSON),
 		fmt.Sprintf("Attributes: map[parallelIndex:%d testName:%s testRun:%s]", baseTest.TestContext.ParallelIndex, t.Name(), baseTest.TestRunID),
-		"Choose action ([m]ove / [d]iscard / [q]uit): Message 1 moved successfully",
+		"Choose action ([m]ove / [d]iscard / [a]ll matching / [q]uit): Message 1 moved successfully",
 		"",
 		"Dead-lettered messages review completed. Total messages processed: 1",
 	}
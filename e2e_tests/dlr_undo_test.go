@@ -0,0 +1,64 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestDLRUndoRevertsLastDecision(t *testing.T) {
+	t.Parallel()
+	// Test to verify that an undone discard is reviewed again instead of being acked
+	baseTest := testhelpers.NewBaseE2ETest(t, "dlr_undo")
+
+	messages := baseTest.CreateTestMessages(2, "DLR Undo Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"dlr",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"--undo-depth", "5",
+	}
+
+	// Simulate user inputs:
+	// For message 1: "d" (discard by mistake)
+	// For message 2: "u" (undo), which presents message 1 again
+	// For message 1: "m" (move), then message 2: "m" (move)
+	actual, err := baseTest.RunDLRCommandWithArgs(args, "d\nu\nm\nm\n")
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expectedSubstrings := []string{
+		"Message 1 queued for discard (press u at the next prompt to undo)",
+		"Undid discard of message 1",
+		"Message 1 queued for move (press u at the next prompt to undo)",
+		"Message 1 moved successfully",
+		"Message 2 moved successfully",
+		"Dead-lettered messages review completed. Total messages processed: 2",
+	}
+	for _, expected := range expectedSubstrings {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+		}
+	}
+	if strings.Contains(actual, "discarded (acked)") {
+		t.Fatalf("Undone discard should not have been committed. Full output:\n%s", actual)
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInDestination(2); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := baseTest.VerifyMessagesInSource(0); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestDoctorPassesForAccessibleResources(t *testing.T) {
+	t.Parallel()
+	// Test to verify that doctor passes for the test's own subscription and topic
+	baseTest := testhelpers.NewBaseE2ETest(t, "doctor")
+
+	args := []string{
+		"doctor",
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", baseTest.Setup.GetDestTopicName(),
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "All 3 checks passed") {
+		t.Fatalf("Expected all checks to pass. Full output:\n%s", actual)
+	}
+}
+
+func TestDoctorReportsMissingTopic(t *testing.T) {
+	t.Parallel()
+	// Test to verify that doctor reports a topic that does not exist with a remediation
+	baseTest := testhelpers.NewBaseE2ETest(t, "doctor_missing")
+
+	missing := baseTest.Setup.GetDestTopicName() + "-missing"
+	args := []string{
+		"doctor",
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", missing,
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expected := []string{
+		"[FAIL] Topic " + missing + ": topic does not exist",
+		"Fix: Check the name",
+		"1 of 3 checks failed",
+	}
+	for _, line := range expected {
+		if !strings.Contains(actual, line) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", line, actual)
+		}
+	}
+}
+
+func TestDoctorReportsBadDestinationCredentials(t *testing.T) {
+	t.Parallel()
+	// Test to verify that destination credentials are checked separately and that
+	// topics are not checked with credentials that do not work
+	baseTest := testhelpers.NewBaseE2ETest(t, "doctor_credentials")
+
+	args := []string{
+		"doctor",
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"--destination-credentials-file", "does-not-exist.json",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expected := []string{
+		"[OK]   Credentials:",
+		"[FAIL] Destination credentials: service account key file does-not-exist.json",
+		"1 of 3 checks failed",
+	}
+	for _, line := range expected {
+		if !strings.Contains(actual, line) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", line, actual)
+		}
+	}
+	if strings.Contains(actual, "Topic "+baseTest.Setup.GetDestTopicName()) {
+		t.Fatalf("Expected the destination topic not to be checked. Full output:\n%s", actual)
+	}
+}
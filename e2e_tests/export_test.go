@@ -0,0 +1,159 @@
+package cmd_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+// exportedRecord mirrors the JSON Lines export format
+type exportedRecord struct {
+	ID          string            `json:"id"`
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes"`
+	OrderingKey string            `json:"ordering_key"`
+}
+
+func readExportedRecords(t *testing.T, path string) []exportedRecord {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open export file: %v", err)
+	}
+	defer file.Close()
+
+	var records []exportedRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record exportedRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Export line is not valid JSON: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestExportDrainsSubscription(t *testing.T) {
+	t.Parallel()
+	// Test to verify that exported messages are written to a JSON Lines file and acknowledged
+	baseTest := testhelpers.NewBaseE2ETest(t, "export_drain")
+
+	exportFile := filepath.Join(t.TempDir(), "export.jsonl")
+
+	numMessages := 3
+	messages := baseTest.CreateTestMessages(numMessages, "Export Test message")
+	expectedData := map[string]bool{}
+	for _, msg := range messages {
+		expectedData[string(msg.Data)] = true
+	}
+
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"export",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--output", exportFile,
+	}
+	if _, err := baseTest.RunMoveCommandWithArgs(args); err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	records := readExportedRecords(t, exportFile)
+	if len(records) != numMessages {
+		t.Fatalf("Expected %d exported records, got %d", numMessages, len(records))
+	}
+	for _, record := range records {
+		if !expectedData[string(record.Data)] {
+			t.Errorf("Unexpected exported data %q", record.Data)
+		}
+		if record.ID == "" {
+			t.Errorf("Expected message ID to be exported")
+		}
+		if record.Attributes["testName"] != t.Name() {
+			t.Errorf("Expected testName attribute to be exported, got %v", record.Attributes)
+		}
+		if record.OrderingKey != "test-ordering-key" {
+			t.Errorf("Expected ordering key to be exported, got %q", record.OrderingKey)
+		}
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInSource(0); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestExportNoAckKeepsMessages(t *testing.T) {
+	t.Parallel()
+	// Test to verify that --no-ack copies messages and leaves them in the source
+	baseTest := testhelpers.NewBaseE2ETest(t, "export_no_ack")
+
+	exportFile := filepath.Join(t.TempDir(), "export_no_ack.jsonl")
+
+	numMessages := 2
+	messages := baseTest.CreateTestMessages(numMessages, "Export No Ack Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"export",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--output", exportFile,
+		"--count", "2",
+		"--no-ack",
+	}
+	if _, err := baseTest.RunMoveCommandWithArgs(args); err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	records := readExportedRecords(t, exportFile)
+	if len(records) != numMessages {
+		t.Fatalf("Expected %d exported records, got %d", numMessages, len(records))
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInSource(numMessages); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestExportRefusesExistingOutput(t *testing.T) {
+	t.Parallel()
+	// Test to verify that export leaves an earlier export alone unless --overwrite is given
+	output := filepath.Join(t.TempDir(), "export.jsonl")
+	if err := os.WriteFile(output, []byte("{}\n"), 0600); err != nil {
+		t.Fatalf("Failed to write earlier export: %v", err)
+	}
+
+	args := []string{
+		"export",
+		"--source-type", constants.BrokerTypeKafkaTopic,
+		"--source", "kafka://127.0.0.1:1/orders-dlq",
+		"--output", output,
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	expected := "output file " + output + " already exists, use --overwrite to replace it"
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+	}
+	if content, _ := os.ReadFile(output); string(content) != "{}\n" {
+		t.Errorf("Expected the earlier export to be kept, got %q", content)
+	}
+}
@@ -0,0 +1,136 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestGrepReleasesScannedMessages(t *testing.T) {
+	t.Parallel()
+	// Test to verify that grep prints matching messages and leaves every message in the source
+	baseTest := testhelpers.NewBaseE2ETest(t, "grep")
+
+	numMessages := 3
+	messages := baseTest.CreateTestMessages(numMessages, "Grep Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"grep",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--attribute", "testName=" + t.Name(),
+		"message 1$",
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expectedSubstrings := []string{
+		"--- Match 1",
+		"Data: Grep Test message 1",
+		"Search completed. Messages scanned: 3, matched: 1",
+	}
+	for _, expected := range expectedSubstrings {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+		}
+	}
+
+	if err := baseTest.VerifyMessagesInSource(numMessages); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestGrepThenMove(t *testing.T) {
+	t.Parallel()
+	// Test to verify that grep --then move moves only the matched messages
+	baseTest := testhelpers.NewBaseE2ETest(t, "grep_then_move")
+
+	numMessages := 3
+	messages := baseTest.CreateTestMessages(numMessages, "Grep Then Move Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"grep",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--then", "move",
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"message [12]$",
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expectedSubstrings := []string{
+		"Search completed. Messages scanned: 3, matched: 2",
+		"Matched messages processed with move: 2",
+	}
+	for _, expected := range expectedSubstrings {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+		}
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInDestination(2); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := baseTest.VerifyMessagesInSource(1); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestGrepThenMoveRefusesLoop(t *testing.T) {
+	t.Parallel()
+	// Test to verify that grep --then move refuses to move matched messages to the topic
+	// of the subscription they were found in, as move does
+	baseTest := testhelpers.NewBaseE2ETest(t, "grep_then_move_loop")
+
+	messages := baseTest.CreateTestMessages(2, "Grep Loop Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"grep",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--then", "move",
+		"--destination", baseTest.Setup.GetSourceTopicName(),
+		"message",
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expected := []string{
+		"is the topic of " + baseTest.Setup.GetSourceSubscriptionName(),
+		"Use --allow-loop to move anyway",
+	}
+	for _, line := range expected {
+		if !strings.Contains(actual, line) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", line, actual)
+		}
+	}
+	if strings.Contains(actual, "Search completed") {
+		t.Fatalf("Expected nothing to be scanned. Full output:\n%s", actual)
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInSource(2); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
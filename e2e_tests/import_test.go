@@ -0,0 +1,82 @@
+package cmd_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestImportPublishesRecords(t *testing.T) {
+	t.Parallel()
+	// Test to verify that records from a JSON Lines file are published and bad lines are reported
+	baseTest := testhelpers.NewBaseE2ETest(t, "import")
+
+	inputFile, err := baseTest.CreateTempFile("import_*.jsonl")
+	if err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+
+	numMessages := 2
+	messages := baseTest.CreateTestMessages(numMessages, "Import Test message")
+	for i, msg := range messages {
+		line, err := json.Marshal(map[string]interface{}{
+			"id":         fmt.Sprintf("original-%d", i),
+			"data":       msg.Data,
+			"attributes": msg.Attributes,
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode record: %v", err)
+		}
+		if _, err := inputFile.Write(append(line, '\n')); err != nil {
+			t.Fatalf("Failed to write input file: %v", err)
+		}
+		if i == 0 {
+			// A malformed line between the records is reported and skipped
+			if _, err := inputFile.WriteString("not json\n"); err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+		}
+	}
+
+	args := []string{
+		"import",
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"--input", inputFile.Name(),
+		"--add-import-attributes",
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expectedSubstrings := []string{
+		"Line 2: failed to read record",
+		"Failed lines: 2",
+		"Import completed. Total messages published: 2, failed: 1, skipped: 0",
+	}
+	for _, expected := range expectedSubstrings {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+		}
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	received, err := baseTest.GetMessagesFromDestination(numMessages)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, msg := range received {
+		if !strings.HasPrefix(msg.Attributes["replay_original_message_id"], "original-") {
+			t.Errorf("Expected original message ID attribute, got %v", msg.Attributes)
+		}
+		if msg.Attributes["replay_imported_at"] == "" {
+			t.Errorf("Expected imported-at attribute, got %v", msg.Attributes)
+		}
+	}
+}
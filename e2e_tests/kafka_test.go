@@ -0,0 +1,202 @@
+package cmd_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// newKafkaCluster starts an in-process single-broker Kafka cluster with the given
+// single-partition topics and returns its address
+func newKafkaCluster(t *testing.T, topics ...string) string {
+	t.Helper()
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, topics...))
+	if err != nil {
+		t.Fatalf("Failed to start Kafka cluster: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+	return cluster.ListenAddrs()[0]
+}
+
+// produceKafkaRecords produces records with a key and a header to a topic
+func produceKafkaRecords(t *testing.T, broker, topic string, count int) {
+	t.Helper()
+	client, err := kgo.NewClient(kgo.SeedBrokers(broker))
+	if err != nil {
+		t.Fatalf("Failed to create Kafka client: %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < count; i++ {
+		record := &kgo.Record{
+			Topic:   topic,
+			Key:     []byte(fmt.Sprintf("key-%d", i)),
+			Value:   []byte(fmt.Sprintf("Kafka Test message %d", i)),
+			Headers: []kgo.RecordHeader{{Key: "origin", Value: []byte("kafka-test")}},
+		}
+		if err := client.ProduceSync(context.Background(), record).FirstErr(); err != nil {
+			t.Fatalf("Failed to produce to %s: %v", topic, err)
+		}
+	}
+}
+
+// consumeKafkaRecords reads the records of a topic from the start
+func consumeKafkaRecords(t *testing.T, broker, topic string, expected int) []*kgo.Record {
+	t.Helper()
+	client, err := kgo.NewClient(kgo.SeedBrokers(broker), kgo.ConsumeTopics(topic), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	if err != nil {
+		t.Fatalf("Failed to create Kafka client: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), constants.TestShortPollTimeout)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < expected && ctx.Err() == nil {
+		records = append(records, client.PollFetches(ctx).Records()...)
+	}
+	return records
+}
+
+func TestMoveBetweenKafkaTopics(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move preserves keys, headers and values between Kafka topics,
+	// and commits the source offsets so the next run does not move them again
+	broker := newKafkaCluster(t, "orders-dlq", "orders")
+	produceKafkaRecords(t, broker, "orders-dlq", 3)
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeKafkaTopic,
+		"--destination-type", constants.BrokerTypeKafkaTopic,
+		"--source", "kafka://" + broker + "/orders-dlq?group=replay-test",
+		"--destination", "kafka://" + broker + "/orders",
+		"--polling-timeout-seconds", "3",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 3") {
+		t.Fatalf("Expected 3 messages to be moved. Full output:\n%s", actual)
+	}
+
+	records := consumeKafkaRecords(t, broker, "orders", 3)
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records in the destination, got %d", len(records))
+	}
+	for i, record := range records {
+		if got, want := string(record.Key), fmt.Sprintf("key-%d", i); got != want {
+			t.Errorf("Record %d: expected key %q, got %q", i, want, got)
+		}
+		testhelpers.AssertMessageContent(t, string(record.Value), fmt.Sprintf("Kafka Test message %d", i))
+		headers := map[string]string{}
+		for _, header := range record.Headers {
+			headers[header.Key] = string(header.Value)
+		}
+		if headers["origin"] != "kafka-test" || headers["replay_redrive_count"] != "1" {
+			t.Errorf("Record %d: expected origin and replay_redrive_count headers, got %v", i, headers)
+		}
+	}
+
+	// The committed offsets leave nothing to move
+	actual, err = testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 0") {
+		t.Fatalf("Expected no messages to be moved again. Full output:\n%s", actual)
+	}
+}
+
+func TestMoveKafkaOffsetRange(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move reads only the given offset range of a partition
+	broker := newKafkaCluster(t, "payments-dlq", "payments")
+	produceKafkaRecords(t, broker, "payments-dlq", 5)
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeKafkaTopic,
+		"--destination-type", constants.BrokerTypeKafkaTopic,
+		"--source", "kafka://" + broker + "/payments-dlq?partitions=0&start=1&end=3",
+		"--destination", "kafka://" + broker + "/payments?partitioner=round-robin",
+		"--polling-timeout-seconds", "3",
+	}
+	start := time.Now()
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 2") {
+		t.Fatalf("Expected 2 messages to be moved. Full output:\n%s", actual)
+	}
+	if elapsed := time.Since(start); elapsed > 2*constants.TestShortPollTimeout {
+		t.Errorf("Expected the move to stop at the end offset, but it took %v", elapsed)
+	}
+
+	records := consumeKafkaRecords(t, broker, "payments", 2)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records in the destination, got %d", len(records))
+	}
+	for i, record := range records {
+		testhelpers.AssertMessageContent(t, string(record.Value), fmt.Sprintf("Kafka Test message %d", i+1))
+	}
+}
+
+func TestMoveRejectsInvalidKafkaTopic(t *testing.T) {
+	t.Parallel()
+	// Test to verify that a malformed Kafka source is rejected before connecting
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeKafkaTopic,
+		"--destination-type", constants.BrokerTypeKafkaTopic,
+		"--source", "kafka://localhost:9092/orders?start=5",
+		"--destination", "kafka://localhost:9092/orders-retry",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	expected := "start and end offsets in \"kafka://localhost:9092/orders?start=5\" require partitions"
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+	}
+}
+
+func TestMoveRejectsKafkaModesLeavingMessages(t *testing.T) {
+	t.Parallel()
+	// Test to verify that modes leaving messages in a Kafka source are refused, as they
+	// would hold back the committed offset and move later messages again next run
+	tests := []struct {
+		flags    []string
+		expected string
+	}{
+		{[]string{"--delay", "30m"}, "--delay is not supported with a Kafka source"},
+		{[]string{"--max-redrives", "3"}, "--max-redrives requires --quarantine with a Kafka source"},
+	}
+	for _, tt := range tests {
+		args := append([]string{
+			"move",
+			"--source-type", constants.BrokerTypeKafkaTopic,
+			"--destination-type", constants.BrokerTypeKafkaTopic,
+			"--source", "kafka://localhost:9092/orders-dlq",
+			"--destination", "kafka://localhost:9092/orders",
+		}, tt.flags...)
+		actual, err := testhelpers.RunCLICommand(args)
+		if err != nil {
+			t.Fatalf("Error running CLI command: %v", err)
+		}
+		if !strings.Contains(actual, tt.expected) {
+			t.Errorf("Expected output to contain %q. Full output:\n%s", tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package cmd_test
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestMoveWritesAuditLog(t *testing.T) {
+	t.Parallel()
+	// Test to verify that every moved message produces an NDJSON audit entry
+	baseTest := testhelpers.NewBaseE2ETest(t, "move_audit")
+
+	auditFile, err := baseTest.CreateTempFile("move_audit_*.ndjson")
+	if err != nil {
+		t.Fatalf("Failed to create audit file: %v", err)
+	}
+
+	numMessages := 2
+	messages := baseTest.CreateTestMessages(numMessages, "Move Audit Test message")
+	expectedHashes := map[string]bool{}
+	for _, msg := range messages {
+		sum := sha256.Sum256(msg.Data)
+		expectedHashes[hex.EncodeToString(sum[:])] = true
+	}
+
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"--audit-log", auditFile.Name(),
+	}
+	if _, err := baseTest.RunMoveCommandWithArgs(args); err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	file, err := os.Open(auditFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to open audit file: %v", err)
+	}
+	defer file.Close()
+
+	entries := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Audit line is not valid JSON: %v", err)
+		}
+		entries++
+
+		if entry["action"] != "move" {
+			t.Errorf("Expected action 'move', got %v", entry["action"])
+		}
+		if entry["source"] != baseTest.Setup.GetSourceSubscriptionName() {
+			t.Errorf("Expected source %s, got %v", baseTest.Setup.GetSourceSubscriptionName(), entry["source"])
+		}
+		if entry["destination"] != baseTest.Setup.GetDestTopicName() {
+			t.Errorf("Expected destination %s, got %v", baseTest.Setup.GetDestTopicName(), entry["destination"])
+		}
+		if entry["message_id"] == nil || entry["user"] == nil || entry["host"] == nil {
+			t.Errorf("Expected message ID, user and host to be recorded, got %v", entry)
+		}
+		hash, _ := entry["payload_sha256"].(string)
+		if !expectedHashes[hash] {
+			t.Errorf("Unexpected payload hash %s", hash)
+		}
+	}
+	if entries != numMessages {
+		t.Fatalf("Expected %d audit entries, got %d", numMessages, entries)
+	}
+}
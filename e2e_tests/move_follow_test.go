@@ -0,0 +1,52 @@
+package cmd_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestMoveFollowStopsAfterCount(t *testing.T) {
+	t.Parallel()
+	// Test to verify that --follow moves messages with streaming pull and stops once --count is reached
+	baseTest := testhelpers.NewBaseE2ETest(t, "move_follow")
+
+	numMessages := 3
+	messages := baseTest.CreateTestMessages(numMessages, "Follow Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"--follow",
+		"--count", fmt.Sprint(numMessages),
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expected := []string{
+		"Following " + baseTest.Setup.GetSourceSubscriptionName(),
+		fmt.Sprintf("Follow stopped. Total messages moved: %d", numMessages),
+	}
+	for _, line := range expected {
+		if !strings.Contains(actual, line) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", line, actual)
+		}
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInDestination(numMessages); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestMoveRefusesLoop(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move refuses to publish to the topic its source subscription is attached to
+	baseTest := testhelpers.NewBaseE2ETest(t, "move_loop")
+
+	numMessages := 2
+	messages := baseTest.CreateTestMessages(numMessages, "Loop Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", baseTest.Setup.GetSourceTopicName(),
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expected := []string{
+		"is the topic of " + baseTest.Setup.GetSourceSubscriptionName(),
+		"Use --allow-loop to move anyway",
+		"Total messages moved: 0",
+	}
+	for _, line := range expected {
+		if !strings.Contains(actual, line) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", line, actual)
+		}
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInSource(numMessages); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestMoveRefusesQuarantineLoopWithKafkaDestination(t *testing.T) {
+	t.Parallel()
+	// Test to verify that a Pub/Sub source moving to another kind of destination is still
+	// checked for a quarantine that feeds the source subscription
+	baseTest := testhelpers.NewBaseE2ETest(t, "move_loop_kafka")
+	broker := newKafkaCluster(t, "orders")
+
+	messages := baseTest.CreateTestMessages(1, "Loop Kafka Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeKafkaTopic,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", "kafka://" + broker + "/orders",
+		"--max-redrives", "3",
+		"--quarantine", baseTest.Setup.GetSourceTopicName(),
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expected := "quarantine " + baseTest.Setup.GetSourceTopicName() + " is the topic of " + baseTest.Setup.GetSourceSubscriptionName()
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInSource(1); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestMoveStampsRedriveCount(t *testing.T) {
+	t.Parallel()
+	// Test to verify that moved messages get their replay_redrive_count attribute incremented
+	baseTest := testhelpers.NewBaseE2ETest(t, "move_redrive_count")
+
+	numMessages := 2
+	messages := baseTest.CreateTestMessages(numMessages, "Redrive Count Test message")
+	messages[1].Attributes = withRedriveCount(messages[1].Attributes, "4")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	if _, err := baseTest.RunMoveCommand(0); err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	received, err := baseTest.GetMessagesFromDestination(numMessages)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := map[string]string{
+		"Redrive Count Test message 1": "1",
+		"Redrive Count Test message 2": "5",
+	}
+	for _, msg := range received {
+		if got := msg.Attributes["replay_redrive_count"]; got != expected[string(msg.Data)] {
+			t.Errorf("Expected %q to have redrive count %q, got %q", msg.Data, expected[string(msg.Data)], got)
+		}
+	}
+}
+
+func TestMoveMaxRedrivesLeavesMessagesInSource(t *testing.T) {
+	t.Parallel()
+	// Test to verify that messages redriven --max-redrives times are left in the source
+	baseTest := testhelpers.NewBaseE2ETest(t, "move_max_redrives")
+
+	numMessages := 3
+	messages := baseTest.CreateTestMessages(numMessages, "Max Redrives Test message")
+	messages[0].Attributes = withRedriveCount(messages[0].Attributes, "3")
+	messages[1].Attributes = withRedriveCount(messages[1].Attributes, "3")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"--max-redrives", "3",
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expected := []string{
+		"Left 2 messages that reached --max-redrives 3 in the source",
+		"Move operation completed. Total messages moved: 1",
+	}
+	for _, line := range expected {
+		if !strings.Contains(actual, line) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", line, actual)
+		}
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInDestination(1); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := baseTest.VerifyMessagesInSource(2); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+// withRedriveCount copies attributes, adding a replay_redrive_count
+func withRedriveCount(attributes map[string]string, count string) map[string]string {
+	copied := map[string]string{"replay_redrive_count": count}
+	for key, value := range attributes {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,106 @@
+package cmd_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+
+	pubsubpb "cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+)
+
+func TestMoveToSubscription(t *testing.T) {
+	t.Parallel()
+	// Test to verify that messages moved to a subscription are published to its topic
+	// with the routing attribute naming the subscription
+	baseTest := testhelpers.NewBaseE2ETest(t, "move_subscription")
+
+	numMessages := 2
+	messages := baseTest.CreateTestMessages(numMessages, "Subscription Destination Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	destination := baseTest.Setup.GetDestSubscriptionName()
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", destination,
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	expected := "Routing messages to " + destination + " through its topic " + baseTest.Setup.GetDestTopicName()
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	received, err := baseTest.GetMessagesFromDestination(numMessages)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	testhelpers.AssertMessageCount(t, received, numMessages)
+	for _, msg := range received {
+		if got := msg.Attributes["replay_target_subscription"]; got != destination {
+			t.Errorf("Expected %q to be routed to %q, got %q", msg.Data, destination, got)
+		}
+	}
+}
+
+func TestMoveToSubscriptionRefusesFanout(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move refuses to route messages to a subscription when a
+	// sibling subscription's filter would let them through as well
+	baseTest := testhelpers.NewBaseE2ETest(t, "move_subscription_fanout")
+	setup := baseTest.Setup
+
+	sibling := fmt.Sprintf("projects/%s/subscriptions/%s", setup.ProjectID,
+		setup.TestContext.GenerateResourceName("sub", "events_audit"))
+	_, err := setup.Client.SubscriptionAdminClient.CreateSubscription(setup.Context, &pubsubpb.Subscription{
+		Name:   sibling,
+		Topic:  setup.GetDestTopicName(),
+		Filter: "attributes:replay_target_subscription",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create sibling subscription %s: %v", sibling, err)
+	}
+	setup.TestContext.TrackSubscription(sibling)
+	t.Cleanup(func() {
+		if err := setup.Client.SubscriptionAdminClient.DeleteSubscription(setup.Context, &pubsubpb.DeleteSubscriptionRequest{
+			Subscription: sibling,
+		}); err != nil {
+			t.Logf("Failed to delete sibling subscription %s: %v", sibling, err)
+		}
+	})
+
+	messages := baseTest.CreateTestMessages(1, "Subscription Fanout Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--source", setup.GetSourceSubscriptionName(),
+		"--destination", setup.GetDestSubscriptionName(),
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	expected := "would also be delivered to " + sibling
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+	}
+	if err := baseTest.VerifyMessagesInSource(1); err != nil {
+		t.Errorf("Expected the message to stay in the source: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package cmd_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+
+	pubsubpb "cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"google.golang.org/api/iterator"
+)
+
+func TestMoveFromTopicSource(t *testing.T) {
+	t.Parallel()
+	// Test to verify that a topic source is read through a temporary subscription
+	// that only sees messages published after it was created, and is deleted on exit
+	baseTest := testhelpers.NewBaseE2ETest(t, "move_topic_source")
+
+	numMessages := 2
+	messages := baseTest.CreateTestMessages(numMessages, "Topic Source Test message")
+
+	// Publish once the temporary subscription exists
+	published := make(chan error, 1)
+	go func() {
+		time.Sleep(constants.TestWaitMedium)
+		published <- baseTest.PublishMessages(messages)
+	}()
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeGCPPubSubTopic,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", baseTest.Setup.GetSourceTopicName(),
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"--count", fmt.Sprint(numMessages),
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if err := <-published; err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	expected := []string{
+		"Created temporary subscription",
+		"Deleted temporary subscription",
+		fmt.Sprintf("Total messages moved: %d", numMessages),
+	}
+	for _, line := range expected {
+		if !strings.Contains(actual, line) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", line, actual)
+		}
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInDestination(numMessages); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Only the test's own subscription is left on the topic
+	it := baseTest.Setup.Client.TopicAdminClient.ListTopicSubscriptions(baseTest.Setup.Context, &pubsubpb.ListTopicSubscriptionsRequest{
+		Topic: baseTest.Setup.GetSourceTopicName(),
+	})
+	for {
+		name, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to list subscriptions: %v", err)
+		}
+		if name != baseTest.Setup.GetSourceSubscriptionName() {
+			t.Errorf("Expected the temporary subscription to be deleted, found %s", name)
+		}
+	}
+}
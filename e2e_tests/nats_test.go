@@ -0,0 +1,255 @@
+package cmd_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// newNATSServer starts an in-process NATS server with JetStream and the given
+// streams, each storing the subjects under its lower-case name, and returns its
+// address and a JetStream client
+func newNATSServer(t *testing.T, streams ...string) (string, jetstream.JetStream) {
+	t.Helper()
+	natsServer, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create NATS server: %v", err)
+	}
+	natsServer.Start()
+	t.Cleanup(natsServer.Shutdown)
+	if !natsServer.ReadyForConnections(5 * time.Second) {
+		t.Fatalf("NATS server did not start")
+	}
+
+	connection, err := nats.Connect(natsServer.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	t.Cleanup(connection.Close)
+	js, err := jetstream.New(connection)
+	if err != nil {
+		t.Fatalf("Failed to create JetStream client: %v", err)
+	}
+	for _, stream := range streams {
+		_, err := js.CreateStream(context.Background(), jetstream.StreamConfig{
+			Name:     stream,
+			Subjects: []string{strings.ToLower(stream) + ".>"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create stream %s: %v", stream, err)
+		}
+	}
+	return strings.TrimPrefix(natsServer.ClientURL(), "nats://"), js
+}
+
+// publishNATSMessages publishes messages with a header and a message ID to a subject
+func publishNATSMessages(t *testing.T, js jetstream.JetStream, subject string, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		msg := nats.NewMsg(subject)
+		msg.Data = []byte(fmt.Sprintf("NATS Test message %d", i))
+		msg.Header.Set("origin", "nats-test")
+		if _, err := js.PublishMsg(context.Background(), msg, jetstream.WithMsgID(fmt.Sprintf("nats-%d", i))); err != nil {
+			t.Fatalf("Failed to publish to %s: %v", subject, err)
+		}
+	}
+}
+
+// streamMessages returns the messages stored in a stream
+func streamMessages(t *testing.T, js jetstream.JetStream, name string) []*jetstream.RawStreamMsg {
+	t.Helper()
+	stream, err := js.Stream(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Failed to look up stream %s: %v", name, err)
+	}
+	info, err := stream.Info(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to look up stream %s: %v", name, err)
+	}
+	var messages []*jetstream.RawStreamMsg
+	for sequence := info.State.FirstSeq; sequence <= info.State.LastSeq && info.State.Msgs > 0; sequence++ {
+		message, err := stream.GetMsg(context.Background(), sequence)
+		if err != nil {
+			t.Fatalf("Failed to get message %d of %s: %v", sequence, name, err)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func TestMoveBetweenNATSStreams(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move keeps data, headers and message IDs between JetStream
+	// streams, and acks moved messages so the next run does not move them again
+	address, js := newNATSServer(t, "DLQ", "ORDERS")
+	publishNATSMessages(t, js, "dlq.orders.created", 3)
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeNATSJetStream,
+		"--destination-type", constants.BrokerTypeNATSJetStream,
+		"--source", "nats://" + address + "/DLQ",
+		"--destination", "nats://" + address + "/orders.created",
+		"--polling-timeout-seconds", "2",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 3") {
+		t.Fatalf("Expected 3 messages to be moved. Full output:\n%s", actual)
+	}
+
+	messages := streamMessages(t, js, "ORDERS")
+	if len(messages) != 3 {
+		t.Fatalf("Expected 3 messages in the destination, got %d", len(messages))
+	}
+	for i, message := range messages {
+		testhelpers.AssertMessageContent(t, string(message.Data), fmt.Sprintf("NATS Test message %d", i))
+		if message.Subject != "orders.created" {
+			t.Errorf("Message %d: expected subject orders.created, got %s", i, message.Subject)
+		}
+		if got := message.Header.Get(jetstream.MsgIDHeader); got != fmt.Sprintf("nats-%d:redrive-1", i) {
+			t.Errorf("Message %d: expected message ID nats-%d:redrive-1, got %q", i, i, got)
+		}
+		if message.Header.Get("origin") != "nats-test" || message.Header.Get("replay_redrive_count") != "1" {
+			t.Errorf("Message %d: expected origin and replay_redrive_count headers, got %v", i, message.Header)
+		}
+	}
+
+	// The durable consumer has acked everything
+	actual, err = testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 0") {
+		t.Fatalf("Expected no messages to be moved again. Full output:\n%s", actual)
+	}
+}
+
+// publishNATSRedrive publishes a message with the ID nats-redrive to a subject,
+// as if it had been redriven the given number of times before
+func publishNATSRedrive(t *testing.T, js jetstream.JetStream, subject string, redrives int) {
+	t.Helper()
+	msg := nats.NewMsg(subject)
+	msg.Data = []byte("NATS Redrive Test message")
+	if redrives > 0 {
+		msg.Header.Set("replay_redrive_count", fmt.Sprint(redrives))
+	}
+	if _, err := js.PublishMsg(context.Background(), msg, jetstream.WithMsgID("nats-redrive")); err != nil {
+		t.Fatalf("Failed to publish to %s: %v", subject, err)
+	}
+}
+
+// moveNATSStream moves a stream to the subject orders.created and returns the output
+func moveNATSStream(t *testing.T, address, stream string) string {
+	t.Helper()
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeNATSJetStream,
+		"--destination-type", constants.BrokerTypeNATSJetStream,
+		"--source", "nats://" + address + "/" + stream,
+		"--destination", "nats://" + address + "/orders.created",
+		"--polling-timeout-seconds", "2",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	return actual
+}
+
+func TestMoveRedrivesNATSMessageAgain(t *testing.T) {
+	t.Parallel()
+	// Test to verify that a message redriven again within the duplicate window of the
+	// destination stream is stored again rather than dropped as a duplicate
+	address, js := newNATSServer(t, "DLQ", "PARKED", "ORDERS")
+	publishNATSRedrive(t, js, "dlq.orders.created", 0)
+	publishNATSRedrive(t, js, "parked.orders.created", 1)
+
+	for _, stream := range []string{"DLQ", "PARKED"} {
+		if actual := moveNATSStream(t, address, stream); !strings.Contains(actual, "Total messages moved: 1") {
+			t.Fatalf("Expected 1 message to be moved from %s. Full output:\n%s", stream, actual)
+		}
+	}
+
+	messages := streamMessages(t, js, "ORDERS")
+	if len(messages) != 2 {
+		t.Fatalf("Expected both redrives in the destination, got %d messages", len(messages))
+	}
+	for i, message := range messages {
+		if got := message.Header.Get(jetstream.MsgIDHeader); got != fmt.Sprintf("nats-redrive:redrive-%d", i+1) {
+			t.Errorf("Message %d: expected message ID nats-redrive:redrive-%d, got %q", i, i+1, got)
+		}
+	}
+}
+
+func TestMoveDedupesRepeatedNATSRedrive(t *testing.T) {
+	t.Parallel()
+	// Test to verify that publishing the same redrive twice stores it once, and that
+	// the duplicate is reported and left in the source instead of being acked
+	address, js := newNATSServer(t, "DLQ", "PARKED", "ORDERS")
+	publishNATSRedrive(t, js, "dlq.orders.created", 0)
+	publishNATSRedrive(t, js, "parked.orders.created", 0)
+
+	if actual := moveNATSStream(t, address, "DLQ"); !strings.Contains(actual, "Total messages moved: 1") {
+		t.Fatalf("Expected 1 message to be moved. Full output:\n%s", actual)
+	}
+	actual := moveNATSStream(t, address, "PARKED")
+	if !strings.Contains(actual, "already stored message ID nats-redrive:redrive-1") {
+		t.Fatalf("Expected the duplicate to be reported. Full output:\n%s", actual)
+	}
+
+	if messages := streamMessages(t, js, "ORDERS"); len(messages) != 1 {
+		t.Errorf("Expected exactly one stored message, got %d", len(messages))
+	}
+	consumer, err := js.Consumer(context.Background(), "PARKED", "replay")
+	if err != nil {
+		t.Fatalf("Failed to look up the consumer of PARKED: %v", err)
+	}
+	if info, err := consumer.Info(context.Background()); err != nil || info.AckFloor.Stream != 0 {
+		t.Errorf("Expected the duplicate to stay unacked in the source, got %+v: %v", info.AckFloor, err)
+	}
+}
+
+func TestMoveRejectsNATSLoop(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move refuses a destination subject stored by the source stream
+	address, js := newNATSServer(t, "DLQ")
+	publishNATSMessages(t, js, "dlq.orders.created", 1)
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeNATSJetStream,
+		"--destination-type", constants.BrokerTypeNATSJetStream,
+		"--source", "nats://" + address + "/DLQ",
+		"--destination", "nats://" + address + "/dlq.orders.retry",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	expected := fmt.Sprintf("destination nats://%s/dlq.orders.retry is stored by the source stream DLQ", address)
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+	}
+	if messages := streamMessages(t, js, "DLQ"); len(messages) != 1 {
+		t.Errorf("Expected the source to be left alone, got %d messages", len(messages))
+	}
+}
@@ -0,0 +1,83 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestPurgeAcknowledgesMatchingMessages(t *testing.T) {
+	t.Parallel()
+	// Test to verify that purge acknowledges matching messages once the name is confirmed
+	baseTest := testhelpers.NewBaseE2ETest(t, "purge")
+
+	numMessages := 3
+	messages := baseTest.CreateTestMessages(numMessages, "Purge Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	subscription := baseTest.Setup.GetSourceSubscriptionName()
+	args := []string{
+		"purge",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--source", subscription,
+		"--pattern", "message [12]$",
+	}
+
+	// Type the short subscription name to confirm
+	shortName := subscription[strings.LastIndex(subscription, "/")+1:]
+	actual, err := baseTest.RunDLRCommandWithArgs(args, shortName+"\n")
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expectedSubstrings := []string{
+		"Type the subscription name (" + shortName + ") to confirm: ",
+		"Purged 2 messages, kept 1",
+	}
+	for _, expected := range expectedSubstrings {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+		}
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInSource(1); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestPurgeRequiresConfirmation(t *testing.T) {
+	t.Parallel()
+	// Test to verify that nothing is purged when the subscription name does not match
+	baseTest := testhelpers.NewBaseE2ETest(t, "purge_unconfirmed")
+
+	numMessages := 2
+	messages := baseTest.CreateTestMessages(numMessages, "Purge Unconfirmed Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"purge",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--confirm", "some-other-subscription",
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	if !strings.Contains(actual, "Subscription name does not match. Nothing was purged.") {
+		t.Fatalf("Expected purge to be refused. Full output:\n%s", actual)
+	}
+
+	if err := baseTest.VerifyMessagesInSource(numMessages); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
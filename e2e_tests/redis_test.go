@@ -0,0 +1,179 @@
+package cmd_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedisServer starts an in-process Redis server with the given empty streams
+// and returns its address and a client
+func newRedisServer(t *testing.T, streams ...string) (string, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	for _, stream := range streams {
+		if err := client.XGroupCreateMkStream(context.Background(), stream, "setup", "$").Err(); err != nil {
+			t.Fatalf("Failed to create stream %s: %v", stream, err)
+		}
+	}
+	return server.Addr(), client
+}
+
+// addRedisEntries adds entries with data and an attribute field to a stream
+func addRedisEntries(t *testing.T, client *redis.Client, stream string, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		err := client.XAdd(context.Background(), &redis.XAddArgs{
+			Stream: stream,
+			Values: []string{"data", fmt.Sprintf("Redis Test message %d", i), "origin", "redis-test"},
+		}).Err()
+		if err != nil {
+			t.Fatalf("Failed to add to %s: %v", stream, err)
+		}
+	}
+}
+
+// redisEntries returns the entries of a stream
+func redisEntries(t *testing.T, client *redis.Client, stream string) []redis.XMessage {
+	t.Helper()
+	entries, err := client.XRange(context.Background(), stream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", stream, err)
+	}
+	return entries
+}
+
+func TestMoveBetweenRedisStreams(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move keeps data and attribute fields between Redis streams,
+	// and acks moved entries so the next run does not move them again
+	address, client := newRedisServer(t, "orders")
+	addRedisEntries(t, client, "orders-dlq", 3)
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeRedisStream,
+		"--destination-type", constants.BrokerTypeRedisStream,
+		"--source", "redis://" + address + "/orders-dlq",
+		"--destination", "redis://" + address + "/orders",
+		"--polling-timeout-seconds", "1",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 3") {
+		t.Fatalf("Expected 3 messages to be moved. Full output:\n%s", actual)
+	}
+
+	entries := redisEntries(t, client, "orders")
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries in the destination, got %d", len(entries))
+	}
+	for i, entry := range entries {
+		testhelpers.AssertMessageContent(t, fmt.Sprint(entry.Values["data"]), fmt.Sprintf("Redis Test message %d", i))
+		if entry.Values["origin"] != "redis-test" || entry.Values["replay_redrive_count"] != "1" {
+			t.Errorf("Entry %d: expected origin and replay_redrive_count fields, got %v", i, entry.Values)
+		}
+	}
+	if pending, err := client.XPending(context.Background(), "orders-dlq", "replay").Result(); err != nil || pending.Count != 0 {
+		t.Errorf("Expected no pending entries in the source, got %v: %v", pending, err)
+	}
+
+	// The consumer group has acked everything
+	actual, err = testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 0") {
+		t.Fatalf("Expected no messages to be moved again. Full output:\n%s", actual)
+	}
+}
+
+func TestMoveClaimsPendingRedisEntries(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move with pending-only claims the entries a crashed worker
+	// left pending in its group, and leaves entries no worker has read yet alone
+	address, client := newRedisServer(t, "jobs-retry")
+	addRedisEntries(t, client, "jobs", 2)
+	if err := client.XGroupCreate(context.Background(), "jobs", "workers", "0").Err(); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	err := client.XReadGroup(context.Background(), &redis.XReadGroupArgs{
+		Group:    "workers",
+		Consumer: "worker-1",
+		Streams:  []string{"jobs", ">"},
+		Count:    2,
+	}).Err()
+	if err != nil {
+		t.Fatalf("Failed to read as a worker: %v", err)
+	}
+	addRedisEntries(t, client, "jobs", 1)
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeRedisStream,
+		"--destination-type", constants.BrokerTypeRedisStream,
+		"--source", "redis://" + address + "/jobs?group=workers&min-idle=1ms&pending-only=true",
+		"--destination", "redis://" + address + "/jobs-retry",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Total messages moved: 2") {
+		t.Fatalf("Expected 2 messages to be moved. Full output:\n%s", actual)
+	}
+
+	if entries := redisEntries(t, client, "jobs-retry"); len(entries) != 2 {
+		t.Errorf("Expected 2 entries in the destination, got %d", len(entries))
+	}
+	group, err := client.XInfoGroups(context.Background(), "jobs").Result()
+	if err != nil || len(group) != 1 || group[0].Pending != 0 {
+		t.Errorf("Expected no pending entries left in the group, got %v: %v", group, err)
+	}
+	unread, err := client.XReadGroup(context.Background(), &redis.XReadGroupArgs{
+		Group:    "workers",
+		Consumer: "worker-2",
+		Streams:  []string{"jobs", ">"},
+		Count:    10,
+	}).Result()
+	if err != nil || len(unread) != 1 || len(unread[0].Messages) != 1 {
+		t.Errorf("Expected the unread entry to be left for the workers, got %v: %v", unread, err)
+	}
+}
+
+func TestMoveRejectsRedisLoop(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move refuses to move entries back to their own stream
+	address, client := newRedisServer(t)
+	addRedisEntries(t, client, "orders-dlq", 1)
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeRedisStream,
+		"--destination-type", constants.BrokerTypeRedisStream,
+		"--source", "redis://" + address + "/orders-dlq?group=retries",
+		"--destination", "redis://" + address + "/orders-dlq",
+	}
+	actual, err := testhelpers.RunCLICommand(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	expected := fmt.Sprintf("destination redis://%s/orders-dlq is the source stream", address)
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+	}
+	if entries := redisEntries(t, client, "orders-dlq"); len(entries) != 1 {
+		t.Errorf("Expected the source to be left alone, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,73 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestMoveAcceptsShortNamesAndURIs(t *testing.T) {
+	t.Parallel()
+	// Test to verify that move accepts a short subscription name with --project and a pubsub:// topic URI
+	baseTest := testhelpers.NewBaseE2ETest(t, "resource_names")
+
+	numMessages := 2
+	messages := baseTest.CreateTestMessages(numMessages, "Resource Names Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	// projects/<project>/subscriptions/<id>
+	sourceParts := strings.Split(baseTest.Setup.GetSourceSubscriptionName(), "/")
+	project, subscriptionID := sourceParts[1], sourceParts[3]
+	destinationURI := "pubsub://" + strings.TrimPrefix(baseTest.Setup.GetDestTopicName(), "projects/")
+
+	args := []string{
+		"move",
+		"--project", project,
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", subscriptionID,
+		"--destination", destinationURI,
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expected := "Moving messages from " + baseTest.Setup.GetSourceSubscriptionName() + " to " + baseTest.Setup.GetDestTopicName()
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInDestination(numMessages); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestMoveRejectsTopicAsSource(t *testing.T) {
+	t.Parallel()
+	// Test to verify that a topic given as the source subscription is rejected with a clear error
+	baseTest := testhelpers.NewBaseE2ETest(t, "resource_names_mismatch")
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", baseTest.Setup.GetSourceTopicName(),
+		"--destination", baseTest.Setup.GetDestTopicName(),
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expected := "is a topic, but a subscription is expected here"
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,96 @@
+package cmd_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestMoveDelayLeavesRecentMessages(t *testing.T) {
+	t.Parallel()
+	// Test to verify that --delay leaves messages published more recently than the delay in the source
+	baseTest := testhelpers.NewBaseE2ETest(t, "move_delay")
+
+	numMessages := 2
+	messages := baseTest.CreateTestMessages(numMessages, "Delay Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"--delay", "1h",
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expected := []string{
+		"Left 2 messages published less than 1h0m0s ago in the source",
+		"Move operation completed. Total messages moved: 0",
+	}
+	for _, line := range expected {
+		if !strings.Contains(actual, line) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", line, actual)
+		}
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInSource(numMessages); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestScheduleAtRunsOnce(t *testing.T) {
+	t.Parallel()
+	// Test to verify that schedule --at moves messages once and records the run in its state file
+	baseTest := testhelpers.NewBaseE2ETest(t, "schedule_at")
+
+	numMessages := 2
+	messages := baseTest.CreateTestMessages(numMessages, "Schedule Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"schedule",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"--at", time.Now().Add(2 * time.Second).Format(time.RFC3339),
+		"--state-file", filepath.Join(t.TempDir(), "schedule.json"),
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Schedule finished after 1 runs. Total messages moved: 2") {
+		t.Fatalf("Expected the scheduled run to move all messages. Full output:\n%s", actual)
+	}
+
+	// Running the same schedule again does nothing
+	actual, err = baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Scheduled move already ran") {
+		t.Fatalf("Expected the finished schedule not to run again. Full output:\n%s", actual)
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInDestination(numMessages); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
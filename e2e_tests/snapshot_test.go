@@ -0,0 +1,64 @@
+package cmd_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestMoveSnapshotBeforeCanBeRolledBack(t *testing.T) {
+	t.Parallel()
+	// Test to verify that --snapshot-before allows rolling a move back with seek
+	baseTest := testhelpers.NewBaseE2ETest(t, "snapshot_before")
+
+	numMessages := 2
+	messages := baseTest.CreateTestMessages(numMessages, "Snapshot Before Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	source := baseTest.Setup.GetSourceSubscriptionName()
+	args := []string{
+		"move",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--destination-type", constants.BrokerTypeGCPPubSubTopic,
+		"--source", source,
+		"--destination", baseTest.Setup.GetDestTopicName(),
+		"--snapshot-before",
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	match := regexp.MustCompile(`Created snapshot (\S+)\.`).FindStringSubmatch(actual)
+	if match == nil {
+		t.Fatalf("Expected output to name the snapshot. Full output:\n%s", actual)
+	}
+	snapshot := match[1]
+	t.Cleanup(func() {
+		_, _ = testhelpers.RunCLICommand([]string{"snapshot", "delete", "--name", snapshot})
+	})
+
+	if err := baseTest.VerifyMessagesInDestination(numMessages); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Roll the source back to before the move
+	actual, err = testhelpers.RunCLICommand([]string{"seek", "--source", source, "--to-snapshot", snapshot})
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+	if !strings.Contains(actual, "Seeked "+source+" to snapshot "+snapshot) {
+		t.Fatalf("Expected seek to succeed. Full output:\n%s", actual)
+	}
+
+	baseTest.WaitForMessagePropagation()
+
+	if err := baseTest.VerifyMessagesInSource(numMessages); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"replay/constants"
+	"replay/e2e_tests/testhelpers"
+)
+
+func TestStatsDoesNotConsumeMessages(t *testing.T) {
+	t.Parallel()
+	// Test to verify that stats reports a breakdown of sampled messages and releases them
+	baseTest := testhelpers.NewBaseE2ETest(t, "stats")
+
+	numMessages := 3
+	messages := baseTest.CreateTestMessages(numMessages, "Stats Test message")
+	if err := baseTest.PublishAndWait(messages); err != nil {
+		t.Fatalf("Failed to publish test messages: %v", err)
+	}
+
+	args := []string{
+		"stats",
+		"--source-type", constants.BrokerTypeGCPPubSubSubscription,
+		"--source", baseTest.Setup.GetSourceSubscriptionName(),
+		"--count", "3",
+	}
+	actual, err := baseTest.RunMoveCommandWithArgs(args)
+	if err != nil {
+		t.Fatalf("Error running CLI command: %v", err)
+	}
+
+	expectedSubstrings := []string{
+		"Sampled messages: 3",
+		"Payload types:",
+		"text            3 (100%)",
+		"Payload sizes:",
+		"Delivery attempts:",
+		"testName: on 3 (100%) of messages, 1 distinct values",
+	}
+	for _, expected := range expectedSubstrings {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("Expected output to contain %q. Full output:\n%s", expected, actual)
+		}
+	}
+
+	if err := baseTest.VerifyMessagesInSource(numMessages); err != nil {
+		t.Fatalf("%v", err)
+	}
+}